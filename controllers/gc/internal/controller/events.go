@@ -0,0 +1,6 @@
+package controller
+
+// Reasons of the events recorded on the Sessions whose pods are collected, next to the ones of the session controller
+
+const POD_REAPED_REASON = "PodReaped"
+const POD_KEPT_FOR_REUSE_REASON = "PodKeptForReuse"
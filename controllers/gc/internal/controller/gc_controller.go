@@ -6,6 +6,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	gcv1alpha1 "mr.telepresence/gc/api/v1alpha1"
 	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -16,12 +17,14 @@ import (
 
 type GCReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=gc.mr.telepresence,resources=gcregistrations,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core.mr.telepresence,resources=sessions,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 func (r *GCReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
@@ -87,6 +90,9 @@ func (r *GCReconciler) handleExpiredRegistration(
 			logger.Error(err, "unable to delete pod")
 			return err
 		}
+		reaps.WithLabelValues(string(registration.Spec.Type)).Inc()
+		r.Recorder.Eventf(session, corev1.EventTypeNormal, POD_REAPED_REASON, "Deleted idle pod %s", pod.Name)
+
 		if err := r.Delete(ctx, registration); err != nil && !errors.IsNotFound(err) {
 			logger.Error(err, "unable to delete registration")
 			return err
@@ -97,6 +103,8 @@ func (r *GCReconciler) handleExpiredRegistration(
 			logger.Error(err, "unable to update registration spec")
 			return err
 		}
+		r.Recorder.Eventf(session, corev1.EventTypeNormal, POD_KEPT_FOR_REUSE_REASON,
+			"Idle pod %s kept for reuse for %ds", pod.Name, session.Spec.ReutilizeTimeoutSeconds)
 	}
 	return nil
 }
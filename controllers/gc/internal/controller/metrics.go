@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// The metrics are served along with the controller-runtime ones by the metrics server of the manager
+
+var reaps = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "mr_telepresence",
+	Subsystem: "gc",
+	Name:      "reaps_total",
+	Help:      "Idle pods deleted by the garbage collector, by the type of their expired registration.",
+}, []string{"type"})
+
+func init() {
+	metrics.Registry.MustRegister(reaps)
+}
@@ -0,0 +1,7 @@
+package controller
+
+// Reasons of the events recorded on the pods the network controller publishes, next to the ones of the session
+// controller
+
+const SERVICE_CREATED_REASON = "ServiceCreated"
+const POD_ROUTED_REASON = "PodRouted"
@@ -5,7 +5,6 @@ import (
 	"strings"
 
 	"k8s.io/apimachinery/pkg/types"
-	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	corev1 "k8s.io/api/core/v1"
@@ -15,7 +14,7 @@ import (
 func (r *NetworkReconciler) reconcileIngress(
 	ctx context.Context,
 	servicesMap map[string]*corev1.Service,
-) (ctrl.Result, error) {
+) (*netv1.Ingress, error) {
 
 	logger := log.FromContext(ctx)
 
@@ -23,7 +22,7 @@ func (r *NetworkReconciler) reconcileIngress(
 	namespacedName := types.NamespacedName{Name: "ingress", Namespace: "default"}
 	if err := r.Client.Get(ctx, namespacedName, &ingress); err != nil {
 		logger.Error(err, "unable to get ingress resource")
-		return ctrl.Result{}, err
+		return nil, err
 	}
 
 	ingressPodsSet, ingressUpdatedByGC := ingressGarbageCollection(&ingress, servicesMap)
@@ -32,11 +31,11 @@ func (r *NetworkReconciler) reconcileIngress(
 	if ingressUpdatedByGC || ingressUpdatedByPub {
 		if err := r.Update(ctx, &ingress); err != nil {
 			logger.Error(err, "unable to update ingress")
-			return ctrl.Result{}, err
+			return nil, err
 		}
 	}
 
-	return ctrl.Result{}, nil
+	return &ingress, nil
 }
 
 func ingressGarbageCollection(
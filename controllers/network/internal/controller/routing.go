@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"mr.telepresence/network/internal/tracing"
+)
+
+const (
+	// RoutedAnnotation is set on a pod once its service and ingress paths have been published.
+	// The session controller waits for it before reporting the pod as ready.
+	RoutedAnnotation = "mr.telepresence/routed"
+)
+
+func (r *NetworkReconciler) markRoutedPods(
+	ctx context.Context,
+	pods []corev1.Pod,
+	servicesMap map[string]*corev1.Service,
+	ingress *netv1.Ingress,
+) error {
+
+	logger := log.FromContext(ctx)
+	routedPodsSet := ingressRoutedPods(ingress)
+
+	for _, pod := range pods {
+		if pod.Annotations[RoutedAnnotation] == "true" {
+			continue
+		}
+
+		if _, ok := servicesMap[pod.Name+"-svc"]; !ok {
+			continue
+		}
+
+		if _, ok := routedPodsSet[pod.Name]; !ok {
+			continue
+		}
+
+		if err := r.markRoutedPod(ctx, &pod); err != nil {
+			logger.Error(err, "unable to mark pod as routed", "pod", pod.Name)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markRoutedPod sets the routed annotation of the pod, in a span linked to the request the pod was spawned for
+func (r *NetworkReconciler) markRoutedPod(ctx context.Context, pod *corev1.Pod) (err error) {
+	ctx, span := tracing.Start(ctx, "RoutePod", tracing.LinkOption(pod.Annotations),
+		trace.WithAttributes(attribute.String("pod", pod.Name)))
+	defer func() { tracing.End(span, err) }()
+
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string)
+	}
+	pod.Annotations[RoutedAnnotation] = "true"
+
+	if err := r.Patch(ctx, pod, patch); err != nil {
+		return err
+	}
+	r.Recorder.Event(pod, corev1.EventTypeNormal, POD_ROUTED_REASON, "Published the service and ingress paths")
+
+	return nil
+}
+
+func ingressRoutedPods(ingress *netv1.Ingress) map[string]struct{} {
+	routedPodsSet := make(map[string]struct{})
+
+	for _, path := range ingress.Spec.Rules[0].HTTP.Paths {
+		if path.Path == "/session-manager(/|$)(.*)" {
+			continue
+		}
+
+		routedPodsSet[strings.Split(path.Path, "/")[1]] = struct{}{}
+	}
+
+	return routedPodsSet
+}
@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/client-go/rest"
+)
+
+// Traces are exported over OTLP/gRPC once an endpoint is set in OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, the exporter reading the rest of its settings from the standard OTEL_*
+// variables. Without an endpoint, spans are neither recorded nor exported.
+
+const (
+	tracerName = "mr.telepresence/network"
+
+	// TraceParentAnnotation is copied by the session controller from the session to its pods, the routing of a pod
+	// is linked to the session-manager request it names
+	TraceParentAnnotation = "mr.telepresence/traceparent"
+)
+
+// Setup installs the tracer provider and the W3C trace context propagator, and returns the function flushing the
+// spans left on shutdown
+func Setup(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence over the service name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// InstrumentConfig traces the calls to the API server made by the clients built from the config
+func InstrumentConfig(cfg *rest.Config) {
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(rt, otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+			return "kubernetes " + req.Method
+		}))
+	})
+}
+
+// Start starts a span, to be ended by the caller
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// End records the error the span ended with, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// LinkOption links a span to be started to the session-manager request whose traceparent is in the annotations of
+// an object
+func LinkOption(annotations map[string]string) trace.SpanStartOption {
+	if link, ok := requestLink(annotations); ok {
+		return trace.WithLinks(link)
+	}
+
+	return trace.WithLinks()
+}
+
+func requestLink(annotations map[string]string) (trace.Link, bool) {
+	traceParent, ok := annotations[TraceParentAnnotation]
+	if !ok {
+		return trace.Link{}, false
+	}
+
+	carrier := propagation.MapCarrier{"traceparent": traceParent}
+	spanContext := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+	if !spanContext.IsValid() {
+		return trace.Link{}, false
+	}
+
+	return trace.Link{SpanContext: spanContext}, true
+}
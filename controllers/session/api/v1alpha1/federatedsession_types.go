@@ -0,0 +1,101 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type FederatedClient struct {
+	// Member cluster the client pods run in
+	Cluster   string `json:"cluster"`
+	Connected bool   `json:"connected"`
+}
+
+// FederatedSessionSpec defines the desired state of FederatedSession.
+type FederatedSessionSpec struct {
+	// Member cluster that runs the session pods, the only member whose Session holds the session pod templates
+	// +optional
+	SessionPodsCluster string `json:"sessionPodsCluster,omitempty"`
+
+	// Member clusters the session is propagated to. Every member cluster when empty.
+	// +optional
+	Clusters []string `json:"clusters,omitempty"`
+
+	SessionPodTemplates     corev1.PodTemplateList `json:"sessionPodTemplates"`
+	ClientPodTemplates      ClientPodTemplateList  `json:"clientPodTemplates"`
+	TimeoutSeconds          int                    `json:"timeoutSeconds"`
+	ReutilizeTimeoutSeconds int                    `json:"reutilizeTimeoutSeconds"`
+
+	// +optional
+	HeartbeatTimeoutSeconds int `json:"heartbeatTimeoutSeconds,omitempty"`
+
+	// +optional
+	Clients map[string]FederatedClient `json:"clients,omitempty"`
+
+	// +optional
+	Upgrade *UpgradeStrategy `json:"upgrade,omitempty"`
+
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxClients int `json:"maxClients,omitempty"`
+}
+
+type MemberStatus struct {
+	// Whether the member Session matches the spec of the FederatedSession
+	Synced bool `json:"synced"`
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// FederatedSessionStatus defines the observed state of FederatedSession, aggregated from the member Sessions.
+type FederatedSessionStatus struct {
+	SessionPods SessionPodsStatus       `json:"sessionPods,omitempty"`
+	Clients     map[string]ClientStatus `json:"clients,omitempty"`
+	Members     map[string]MemberStatus `json:"members,omitempty"`
+	Conditions  []metav1.Condition      `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// Outdated pods of every member Session
+	// +optional
+	OutdatedPods []string `json:"outdatedPods,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// FederatedSession is the Schema for the federatedsessions API.
+type FederatedSession struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FederatedSessionSpec   `json:"spec,omitempty"`
+	Status FederatedSessionStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// FederatedSessionList contains a list of FederatedSession.
+type FederatedSessionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FederatedSession `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FederatedSession{}, &FederatedSessionList{})
+}
@@ -21,6 +21,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// TraceParentAnnotation holds the W3C traceparent of the last session-manager request that changed a session, and is
+// copied to the pods spawned for it, so the reconciles and the routing of the pods link back to that request
+const TraceParentAnnotation = "mr.telepresence/traceparent"
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 // SessionSpec defines the desired state of Session.
@@ -37,16 +41,53 @@ type ClientPodTemplateList struct {
 }
 
 type ClientPodTemplate struct {
-	MaxClients         int `json:"maxClients"`
+	MaxClients int `json:"maxClients"`
+
+	// Integer template parameter overriding MaxClients, resolved by the session-manager when the session is created
+	// +optional
+	MaxClientsParameter string `json:"maxClientsParameter,omitempty"`
+
 	corev1.PodTemplate `json:",inline"`
 }
 
+type UpgradeWindow struct {
+	// Daily start of the window, HH:MM in UTC
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+
+	// Daily end of the window, HH:MM in UTC. The window spans midnight when it ends before it starts.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	End string `json:"end"`
+}
+
+// UpgradeStrategy lets the controller replace the pods whose spec no longer matches the session templates. Session
+// pods are replaced when no client is connected, and client pods when none of their clients is connected.
+type UpgradeStrategy struct {
+	// Window during which pods are also replaced while clients are connected
+	// +optional
+	Window *UpgradeWindow `json:"window,omitempty"`
+}
+
 type SessionSpec struct {
 	SessionPodTemplates     corev1.PodTemplateList `json:"sessionPodTemplates"`
 	ClientPodTemplates      ClientPodTemplateList  `json:"clientPodTemplates"`
 	TimeoutSeconds          int                    `json:"timeoutSeconds"`
 	ReutilizeTimeoutSeconds int                    `json:"reutilizeTimeoutSeconds"`
 	Clients                 map[string]bool        `json:"clients"`
+
+	// Seconds without a heartbeat after which the session-manager marks a client as disconnected.
+	// Zero disables heartbeat monitoring.
+	// +optional
+	HeartbeatTimeoutSeconds int `json:"heartbeatTimeoutSeconds,omitempty"`
+
+	// Pods running an outdated spec are left alone when unset
+	// +optional
+	Upgrade *UpgradeStrategy `json:"upgrade,omitempty"`
+
+	// Clients the session-manager admits into the session, zero for no limit
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxClients int `json:"maxClients,omitempty"`
 }
 
 type PodStatus struct {
@@ -58,6 +99,10 @@ type ClientStatus struct {
 	LastSeenAt metav1.Time          `json:"lastSeenAt"`
 	Ready      bool                 `json:"ready"`
 	PodStatus  map[string]PodStatus `json:"podStatus"`
+
+	// When the client joined, cleared once its pods are ready for the first time
+	// +optional
+	PendingSince *metav1.Time `json:"pendingSince,omitempty"`
 }
 
 type SessionPodsStatus struct {
@@ -69,6 +114,10 @@ type SessionPodsStatus struct {
 type SessionStatus struct {
 	SessionPods SessionPodsStatus       `json:"sessionPods,omitempty"`
 	Clients     map[string]ClientStatus `json:"clients,omitempty"`
+
+	// Pods whose spec no longer matches the session templates and that are waiting to be replaced
+	// +optional
+	OutdatedPods []string `json:"outdatedPods,omitempty"`
 }
 
 // +kubebuilder:object:root=true
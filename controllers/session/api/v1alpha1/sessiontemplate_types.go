@@ -0,0 +1,111 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:validation:Enum=string;integer;boolean
+type TemplateParameterType string
+
+const (
+	StringParameter  TemplateParameterType = "string"
+	IntegerParameter TemplateParameterType = "integer"
+	BooleanParameter TemplateParameterType = "boolean"
+)
+
+// TemplateParameter is a per-session value substituted for ${params.<name>} in the env values, args, images and
+// annotations of the pod templates when a session is created
+type TemplateParameter struct {
+	// +kubebuilder:validation:Pattern=`^[A-Za-z_][A-Za-z0-9_]*$`
+	Name string `json:"name"`
+
+	// +kubebuilder:default=string
+	// +optional
+	Type TemplateParameterType `json:"type,omitempty"`
+
+	// Parameters without a default are required
+	// +optional
+	Default *string `json:"default,omitempty"`
+
+	// +optional
+	Description string `json:"description,omitempty"`
+}
+
+// SessionTemplateSpec defines the Session spec the session-manager creates sessions from.
+type SessionTemplateSpec struct {
+	SessionPodTemplates     corev1.PodTemplateList `json:"sessionPodTemplates"`
+	ClientPodTemplates      ClientPodTemplateList  `json:"clientPodTemplates"`
+	TimeoutSeconds          int                    `json:"timeoutSeconds"`
+	ReutilizeTimeoutSeconds int                    `json:"reutilizeTimeoutSeconds"`
+
+	// +optional
+	HeartbeatTimeoutSeconds int `json:"heartbeatTimeoutSeconds,omitempty"`
+
+	// +optional
+	Parameters []TemplateParameter `json:"parameters,omitempty"`
+
+	// Clients the session-manager admits into each session of the template, zero for no limit
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxClients int `json:"maxClients,omitempty"`
+
+	// Sessions of the template the session-manager lets exist at once, zero for no limit
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxSessions int `json:"maxSessions,omitempty"`
+}
+
+type SessionTemplateVersion struct {
+	Version int                 `json:"version"`
+	Spec    SessionTemplateSpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Version",type=integer,JSONPath=`.version`
+
+// SessionTemplate is the Schema for the sessiontemplates API.
+type SessionTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SessionTemplateSpec `json:"spec,omitempty"`
+
+	// Version of Spec, bumped by the session-manager each time the spec changes
+	// +optional
+	Version int `json:"version,omitempty"`
+
+	// Previous versions of the spec, kept so new sessions can still be pinned to them
+	// +optional
+	History []SessionTemplateVersion `json:"history,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SessionTemplateList contains a list of SessionTemplate.
+type SessionTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SessionTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SessionTemplate{}, &SessionTemplateList{})
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"os"
@@ -29,8 +30,10 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -40,6 +43,7 @@ import (
 	gcv1alpha1 "mr.telepresence/gc/api/v1alpha1"
 	corev1alpha1 "mr.telepresence/session/api/v1alpha1"
 	"mr.telepresence/session/internal/controller"
+	"mr.telepresence/session/internal/tracing"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -64,6 +68,8 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var enableFederation bool
+	var memberKubeconfig, localMemberName string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -82,6 +88,12 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.BoolVar(&enableFederation, "enable-federation", false,
+		"If set, FederatedSessions are propagated to the member clusters. Only enable it in the main cluster.")
+	flag.StringVar(&memberKubeconfig, "member-kubeconfig", "",
+		"Kubeconfig file whose contexts are the member clusters the FederatedSessions are propagated to.")
+	flag.StringVar(&localMemberName, "local-member-name", "main",
+		"The member cluster name of the cluster the manager runs in.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -179,7 +191,16 @@ func main() {
 		})
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	shutdownTracing, err := tracing.Setup(context.Background(), "session-controller")
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
+	restConfig := ctrl.GetConfigOrDie()
+	tracing.InstrumentConfig(restConfig)
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsServerOptions,
 		WebhookServer:          webhookServer,
@@ -204,12 +225,30 @@ func main() {
 	}
 
 	if err = (&controller.SessionReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("session-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Session")
 		os.Exit(1)
 	}
+	if enableFederation {
+		members, err := setupMemberClusters(mgr, memberKubeconfig, localMemberName)
+		if err != nil {
+			setupLog.Error(err, "unable to set up member clusters")
+			os.Exit(1)
+		}
+
+		if err = (&controller.FederatedSessionReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Recorder: mgr.GetEventRecorderFor("federatedsession-controller"),
+			Members:  members,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "FederatedSession")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if metricsCertWatcher != nil {
@@ -238,8 +277,56 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctrl.SetupSignalHandler())
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		setupLog.Error(err, "unable to flush the remaining spans")
+	}
+
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// setupMemberClusters builds a cluster for each context of the member kubeconfig and adds it to the manager so its
+// cache is started along with it. The cluster the manager runs in is registered as localMemberName.
+func setupMemberClusters(mgr ctrl.Manager, kubeconfigPath string, localMemberName string) (map[string]cluster.Cluster,
+	error) {
+
+	members := map[string]cluster.Cluster{localMemberName: mgr}
+	if kubeconfigPath == "" {
+		return members, nil
+	}
+
+	apiConfig, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for contextName := range apiConfig.Contexts {
+		if contextName == localMemberName {
+			continue
+		}
+
+		cfg, err := clientcmd.NewNonInteractiveClientConfig(*apiConfig, contextName, &clientcmd.ConfigOverrides{},
+			nil).ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		member, err := cluster.New(cfg, func(o *cluster.Options) { o.Scheme = mgr.GetScheme() })
+		if err != nil {
+			return nil, err
+		}
+
+		if err := mgr.Add(member); err != nil {
+			return nil, err
+		}
+
+		setupLog.Info("added member cluster", "cluster", contextName)
+		members[contextName] = member
+	}
+
+	return members, nil
+}
@@ -11,6 +11,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
@@ -43,7 +44,7 @@ func (r *SessionReconciler) ReconcileClientPods(
 	session *sessionv1alpha1.Session,
 	gcRegistrations []gcv1alpha1.GCRegistration,
 	ingressServiceExternalIp *string,
-) ([]corev1.Pod, error) {
+) ([]corev1.Pod, []corev1.Pod, error) {
 
 	logger := log.FromContext(ctx)
 	now := metav1.NewTime(time.Now())
@@ -54,7 +55,22 @@ func (r *SessionReconciler) ReconcileClientPods(
 
 	if err := r.List(ctx, &clientPods, client.InNamespace(namespace), fieldSelector); err != nil {
 		logger.Error(err, "unable to get client pods", "session", session.Name)
-		return nil, err
+		return nil, nil, err
+	}
+
+	clientTemplates := make(map[string]*corev1.PodSpec, len(session.Spec.ClientPodTemplates.Items))
+	for i := range session.Spec.ClientPodTemplates.Items {
+		template := &session.Spec.ClientPodTemplates.Items[i]
+		clientTemplates[template.Name] = &template.Template.Spec
+	}
+
+	for i := range clientPods.Items {
+		pod := &clientPods.Items[i]
+		if spec, ok := clientTemplates[clientPodTemplateName(session.Name, pod.Name)]; ok {
+			if err := r.stampTemplateHash(ctx, pod, spec); err != nil {
+				return nil, nil, err
+			}
+		}
 	}
 
 	if session.Status.Clients == nil {
@@ -62,7 +78,10 @@ func (r *SessionReconciler) ReconcileClientPods(
 	}
 
 	// Remove clients from the status if their reconnection grace period has expired
-	cleanExpiredClientsFromStatus(now, session.Status.Clients, session.Spec.TimeoutSeconds)
+	for _, clientId := range cleanExpiredClientsFromStatus(now, session.Status.Clients, session.Spec.TimeoutSeconds) {
+		r.Recorder.Eventf(session, corev1.EventTypeNormal, utils.CLIENT_EXPIRED_REASON,
+			"Client %s removed, it did not reconnect within %ds", clientId, session.Spec.TimeoutSeconds)
+	}
 
 	// Check for new clients and lost connections
 	newClients := handleClientChanges(now, session.Spec.Clients, session.Status.Clients)
@@ -71,7 +90,8 @@ func (r *SessionReconciler) ReconcileClientPods(
 	// The corresponding value is an object containing the pod template and a list of pods
 	// currently running in the cluster that were created from that template
 	allocationMap := initAllocationMap(session.Spec.ClientPodTemplates.Items)
-	templatePodToReutilizeMap := templatePodMapping(clientPods.Items)
+	templatePodMap := templatePodMapping(session.Name, clientPods.Items)
+	templatePodToReutilizeMap := templatePodMapping(session.Name, clientPods.Items)
 
 	for clientId, clientStatus := range session.Status.Clients {
 		if _, ok := session.Spec.Clients[clientId]; !ok {
@@ -80,36 +100,48 @@ func (r *SessionReconciler) ReconcileClientPods(
 		} else {
 			// client may be connected to the session
 			isClientConnected := defaultTime.Unix() == clientStatus.LastSeenAt.Unix()
-			buildAllocationMap(clientId, &clientStatus, isClientConnected, allocationMap, templatePodToReutilizeMap)
+			buildAllocationMap(session.Name, clientId, &clientStatus, isClientConnected, allocationMap,
+				templatePodToReutilizeMap)
 		}
 	}
 
+	// move the clients of outdated pods to pods spawned from the current templates, before new clients are allocated
+	podsToDelete := upgradeClientPods(session, allocationMap, templatePodMap, templatePodToReutilizeMap, now.Time)
+
 	// allocate the new clients
 	if len(newClients) != 0 {
 		// sort pods in the allocation map so that new clients are allocated to the least empty ones
 		sortAllocationMap(allocationMap)
-		allocateClients(allocationMap, newClients, session, templatePodToReutilizeMap)
+		allocateClients(allocationMap, newClients, session, templatePodToReutilizeMap, now, r.Recorder)
 	}
 
 	// creates and deletes gc registrations for pods to be handled by the gc controller
-	templatePodMap := templatePodMapping(clientPods.Items)
 	manageGCRegistrations(ctx, r.Client, session, allocationMap, templatePodToReutilizeMap, gcRegistrations)
 
 	// reconcile workload
 	podsToSpawn := reconcilePods(allocationMap, session.Status.Clients, templatePodMap, ingressServiceExternalIp)
-	return podsToSpawn, nil
+	observeReadyClients(ctx, session, clientPods.Items, now)
+
+	return podsToSpawn, podsToDelete, nil
 }
 
+// cleanExpiredClientsFromStatus removes the clients whose reconnection grace period has expired and returns them
 func cleanExpiredClientsFromStatus(
 	now metav1.Time,
 	clients map[string]sessionv1alpha1.ClientStatus,
 	timeoutSeconds int,
-) {
+) []string {
+	expired := []string{}
+
 	for k, v := range clients {
 		if clientHasExpired(now, v.LastSeenAt, timeoutSeconds) {
 			delete(clients, k)
+			expired = append(expired, k)
 		}
 	}
+
+	sort.Strings(expired)
+	return expired
 }
 
 func clientHasExpired(now metav1.Time, lastSeen metav1.Time, timeoutSeconds int) bool {
@@ -157,11 +189,21 @@ func initAllocationMap(clientPodTemplates []sessionv1alpha1.ClientPodTemplate) m
 	return allocationMap
 }
 
-func templatePodMapping(pods []corev1.Pod) map[string]map[string]corev1.Pod {
+// clientPodTemplateName returns the name of the template of a client pod, named
+// <session name>-<template name>-<suffix>. Session and template names may both contain dashes.
+func clientPodTemplateName(sessionName string, podName string) string {
+	templateName := strings.TrimPrefix(podName, sessionName+"-")
+	if i := strings.LastIndex(templateName, "-"); i != -1 {
+		templateName = templateName[:i]
+	}
+	return templateName
+}
+
+func templatePodMapping(sessionName string, pods []corev1.Pod) map[string]map[string]corev1.Pod {
 	templatePodMap := make(map[string]map[string]corev1.Pod)
 
 	for _, pod := range pods {
-		templateName := strings.Split(pod.Name, "-")[2]
+		templateName := clientPodTemplateName(sessionName, pod.Name)
 
 		if _, ok := templatePodMap[templateName]; !ok {
 			templatePodMap[templateName] = map[string]corev1.Pod{pod.Name: pod}
@@ -173,6 +215,7 @@ func templatePodMapping(pods []corev1.Pod) map[string]map[string]corev1.Pod {
 }
 
 func buildAllocationMap(
+	sessionName string,
 	clientId string,
 	clientStatus *sessionv1alpha1.ClientStatus,
 	isClientConnected bool,
@@ -182,7 +225,7 @@ func buildAllocationMap(
 	client := podClient{Id: clientId, Connected: isClientConnected}
 
 	for podName := range clientStatus.PodStatus {
-		podTemplateName := strings.Split(podName, "-")[2]
+		podTemplateName := clientPodTemplateName(sessionName, podName)
 		pods := allocationMap[podTemplateName].Pods
 		delete(templatePodToReutilizeMap[podTemplateName], podName)
 
@@ -234,6 +277,8 @@ func allocateClients(
 	newClients []string,
 	session *sessionv1alpha1.Session,
 	templatePodToReutilizeMap map[string]map[string]corev1.Pod,
+	now metav1.Time,
+	recorder record.EventRecorder,
 ) {
 	for _, clientId := range newClients {
 		pods := map[string]sessionv1alpha1.PodStatus{}
@@ -248,8 +293,12 @@ func allocateClients(
 
 				if podName == "" {
 					podName = session.Name + "-" + podTemplateName + "-" + uuid.New().String()[:4]
+					clientPodAllocations.WithLabelValues(podTemplateName, podSourceSpawned).Inc()
 				} else {
 					delete(templatePodToReutilizeMap[podTemplateName], podName)
+					clientPodAllocations.WithLabelValues(podTemplateName, podSourceReused).Inc()
+					recorder.Eventf(session, corev1.EventTypeNormal, utils.POD_REUSED_REASON,
+						"Reused idle pod %s for client %s", podName, clientId)
 				}
 
 				allocValue.Pods = append(allocValue.Pods, pod{Name: podName, Clients: []podClient{client}})
@@ -261,12 +310,15 @@ func allocateClients(
 
 			allocationMap[podTemplateName] = allocValue
 			pods[podName] = buildPodStatus(podName, allocValue.PodTemplate.Template.Spec)
+			recorder.Eventf(session, corev1.EventTypeNormal, utils.CLIENT_ALLOCATED_REASON,
+				"Client %s allocated to pod %s", clientId, podName)
 		}
 
 		session.Status.Clients[clientId] = sessionv1alpha1.ClientStatus{
-			LastSeenAt: defaultTime,
-			Ready:      false,
-			PodStatus:  pods,
+			LastSeenAt:   defaultTime,
+			Ready:        false,
+			PodStatus:    pods,
+			PendingSince: &now,
 		}
 	}
 }
@@ -426,7 +478,7 @@ func reconcilePods(
 				// instance was found, we still have to check its status and report it
 				readyStatus := utils.ExtractReadyConditionStatusFromPod(&value)
 
-				if readyStatus == corev1.ConditionTrue && ingressServiceExternalIp != nil {
+				if readyStatus == corev1.ConditionTrue && utils.PodIsRouted(&value) && ingressServiceExternalIp != nil {
 					setClientStatusReadiness(true, pod.Name, pod.Clients, statusClients, *ingressServiceExternalIp)
 				} else {
 					setClientStatusReadiness(false, pod.Name, pod.Clients, statusClients, "")
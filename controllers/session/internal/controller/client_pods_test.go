@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	gcv1alpha1 "mr.telepresence/gc/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+	"mr.telepresence/session/internal/controller/utils"
+)
+
+func TestClientPodTemplateName(t *testing.T) {
+	tests := []struct {
+		name     string
+		session  string
+		pod      string
+		template string
+	}{
+		{"generated session name", "demo-1a2b3c4d5e6f", "demo-1a2b3c4d5e6f-viewer-aaaa", "viewer"},
+		{"session name without dash", "lobby", "lobby-viewer-aaaa", "viewer"},
+		{"session name with several dashes", "my-lobby-1", "my-lobby-1-viewer-aaaa", "viewer"},
+		{"template name with dashes", "lobby", "lobby-hd-viewer-aaaa", "hd-viewer"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if template := clientPodTemplateName(test.session, test.pod); template != test.template {
+				t.Errorf("expected template %q, got %q", test.template, template)
+			}
+		})
+	}
+}
+
+// A new client shares the pod of the clients already allocated to the template, whatever the dashes of the session
+// name
+func TestReconcileClientPodsSessionNames(t *testing.T) {
+	for _, sessionName := range []string{"lobby", "my-lobby-1"} {
+		t.Run(sessionName, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+			_ = gcv1alpha1.AddToScheme(scheme)
+
+			podName := sessionName + "-viewer-aaaa"
+			existing := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Name:      podName,
+				Namespace: "default",
+				Labels:    map[string]string{"type": "client"},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: sessionv1alpha1.GroupVersion.String(),
+					Kind:       "Session",
+					Name:       sessionName,
+					Controller: func() *bool { controller := true; return &controller }(),
+				}},
+			}}
+
+			reconciler := &SessionReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing).
+					WithIndex(&corev1.Pod{}, utils.PodOwnerField, func(o client.Object) []string {
+						return []string{metav1.GetControllerOf(o).Name}
+					}).
+					WithIndex(&corev1.Pod{}, utils.PodTypeField, func(o client.Object) []string {
+						return []string{o.GetLabels()["type"]}
+					}).
+					Build(),
+				Scheme:   scheme,
+				Recorder: record.NewFakeRecorder(10),
+			}
+
+			session := &sessionv1alpha1.Session{
+				ObjectMeta: metav1.ObjectMeta{Name: sessionName, Namespace: "default"},
+				Spec: sessionv1alpha1.SessionSpec{
+					Clients: map[string]bool{"alice": true, "bob": true},
+					ClientPodTemplates: sessionv1alpha1.ClientPodTemplateList{
+						Items: []sessionv1alpha1.ClientPodTemplate{{
+							MaxClients:  2,
+							PodTemplate: corev1.PodTemplate{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}},
+						}},
+					},
+					TimeoutSeconds: 60,
+				},
+				Status: sessionv1alpha1.SessionStatus{Clients: map[string]sessionv1alpha1.ClientStatus{
+					"alice": {
+						LastSeenAt: defaultTime,
+						PodStatus:  map[string]sessionv1alpha1.PodStatus{podName: {Ready: true}},
+						Ready:      true,
+					},
+				}},
+			}
+
+			podsToSpawn, _, err := reconciler.ReconcileClientPods(context.Background(), "default", session, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(podsToSpawn) != 0 {
+				t.Errorf("expected no pod to be spawned, got %s", podsToSpawn[0].Name)
+			}
+			if _, ok := session.Status.Clients["bob"].PodStatus[podName]; !ok {
+				t.Errorf("expected bob to be allocated to %s, got %v", podName, session.Status.Clients["bob"].PodStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	stdErrors "errors"
+	"fmt"
+	"sort"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+	"mr.telepresence/session/internal/controller/utils"
+	"mr.telepresence/session/internal/tracing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// Label set on the member Sessions, holding the name of the FederatedSession they were propagated from
+	FederatedSessionLabel = "mr.telepresence/federated-session"
+
+	federatedSessionFinalizer = "mr.telepresence/federated-session-cleanup"
+)
+
+// FederatedSessionReconciler propagates FederatedSessions to member Sessions in the worker clusters and
+// aggregates their statuses back
+type FederatedSessionReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Member clusters by name, the cluster the manager runs in included
+	Members map[string]cluster.Cluster
+}
+
+// +kubebuilder:rbac:groups=core.mr.telepresence,resources=federatedsessions,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core.mr.telepresence,resources=federatedsessions/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core.mr.telepresence,resources=federatedsessions/finalizers,verbs=update
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+// Reconcile creates, updates and deletes the member Sessions of a FederatedSession. The member in
+// SessionPodsCluster is the only one holding the session pod templates, and each member only holds the clients
+// placed in its cluster.
+func (r *FederatedSessionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	logger := log.FromContext(ctx)
+	logger.Info("controller triggered", "name", req.Name, "namespace", req.Namespace)
+
+	ctx, span := tracing.Start(ctx, "Reconcile FederatedSession",
+		trace.WithAttributes(attribute.String("session", req.Name), attribute.String("namespace", req.Namespace)))
+	defer func() { tracing.End(span, err) }()
+
+	var federatedSession sessionv1alpha1.FederatedSession
+	if err := r.Get(ctx, req.NamespacedName, &federatedSession); err != nil && errors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+
+	} else if err != nil {
+		logger.Error(err, "unable to get federated session resource")
+		reconcileErrors.WithLabelValues("federatedsession", "get").Inc()
+		return ctrl.Result{}, err
+	}
+
+	tracing.Link(span, federatedSession.Annotations)
+
+	if !federatedSession.DeletionTimestamp.IsZero() {
+		if err := r.finalize(ctx, &federatedSession); err != nil {
+			reconcileErrors.WithLabelValues("federatedsession", "finalize").Inc()
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(&federatedSession, federatedSessionFinalizer) {
+		controllerutil.AddFinalizer(&federatedSession, federatedSessionFinalizer)
+		if err := r.Update(ctx, &federatedSession); err != nil {
+			logger.Error(err, "unable to add finalizer", "federatedSession", federatedSession.Name)
+			reconcileErrors.WithLabelValues("federatedsession", "finalizer").Inc()
+			return ctrl.Result{}, err
+		}
+	}
+
+	desiredClusters := r.desiredClusters(&federatedSession)
+	memberSessions := make(map[string]*sessionv1alpha1.Session, len(desiredClusters))
+	membersStatus := make(map[string]sessionv1alpha1.MemberStatus, len(desiredClusters))
+	var errs []error
+
+	for _, clusterName := range desiredClusters {
+		session, err := r.syncMemberSession(ctx, clusterName, &federatedSession)
+		if err != nil {
+			logger.Error(err, "unable to sync member session", "cluster", clusterName)
+			r.Recorder.Eventf(&federatedSession, corev1.EventTypeWarning, utils.SYNC_MEMBER_FAILED_REASON,
+				"Failed to sync the member session in cluster %s: %v", clusterName, err)
+			membersStatus[clusterName] = sessionv1alpha1.MemberStatus{Synced: false, Error: err.Error()}
+			errs = append(errs, err)
+			continue
+		}
+
+		membersStatus[clusterName] = sessionv1alpha1.MemberStatus{Synced: true}
+		memberSessions[clusterName] = session
+	}
+
+	for clusterName := range r.Members {
+		if _, ok := membersStatus[clusterName]; ok {
+			continue
+		}
+
+		if err := r.deleteMemberSession(ctx, clusterName, &federatedSession); err != nil {
+			logger.Error(err, "unable to delete member session", "cluster", clusterName)
+			errs = append(errs, err)
+		}
+	}
+
+	oldStatus := federatedSession.Status.DeepCopy()
+	aggregateMemberStatuses(&federatedSession, memberSessions, membersStatus)
+
+	if !equality.Semantic.DeepEqual(oldStatus, &federatedSession.Status) {
+		if err := r.Status().Update(ctx, &federatedSession); err != nil {
+			logger.Error(err, "unable to update federated session resource", "federatedSession", federatedSession.Name)
+			reconcileErrors.WithLabelValues("federatedsession", "status").Inc()
+			return ctrl.Result{}, err
+		}
+	}
+
+	if len(errs) > 0 {
+		reconcileErrors.WithLabelValues("federatedsession", "members").Inc()
+	}
+
+	return ctrl.Result{}, stdErrors.Join(errs...)
+}
+
+// desiredClusters returns the clusters listed in the spec, or every member cluster when none is listed. The session
+// pods cluster and the clusters clients were placed in are always included.
+func (r *FederatedSessionReconciler) desiredClusters(federatedSession *sessionv1alpha1.FederatedSession) []string {
+	clusters := make(map[string]struct{})
+
+	if len(federatedSession.Spec.Clusters) == 0 {
+		for clusterName := range r.Members {
+			clusters[clusterName] = struct{}{}
+		}
+	}
+
+	for _, clusterName := range federatedSession.Spec.Clusters {
+		clusters[clusterName] = struct{}{}
+	}
+
+	if len(federatedSession.Spec.SessionPodTemplates.Items) > 0 {
+		clusters[federatedSession.Spec.SessionPodsCluster] = struct{}{}
+	}
+
+	for _, federatedClient := range federatedSession.Spec.Clients {
+		clusters[federatedClient.Cluster] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(clusters))
+	for clusterName := range clusters {
+		sorted = append(sorted, clusterName)
+	}
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+func (r *FederatedSessionReconciler) syncMemberSession(
+	ctx context.Context,
+	clusterName string,
+	federatedSession *sessionv1alpha1.FederatedSession,
+) (*sessionv1alpha1.Session, error) {
+
+	member, ok := r.Members[clusterName]
+	if !ok {
+		return nil, fmt.Errorf("cluster %s not configured", clusterName)
+	}
+	memberClient := member.GetClient()
+
+	desiredSpec := memberSessionSpec(clusterName, federatedSession)
+	key := types.NamespacedName{Name: federatedSession.Name, Namespace: federatedSession.Namespace}
+
+	// the member reconciles link back to the request that last changed the federated session
+	traceParent, traced := federatedSession.Annotations[sessionv1alpha1.TraceParentAnnotation]
+
+	var session sessionv1alpha1.Session
+	err := memberClient.Get(ctx, key, &session)
+
+	if err != nil && errors.IsNotFound(err) {
+		session = sessionv1alpha1.Session{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      federatedSession.Name,
+				Namespace: federatedSession.Namespace,
+				Labels:    map[string]string{FederatedSessionLabel: federatedSession.Name},
+			},
+			Spec: desiredSpec,
+		}
+		if traced {
+			session.Annotations = map[string]string{sessionv1alpha1.TraceParentAnnotation: traceParent}
+		}
+
+		if err := memberClient.Create(ctx, &session); err != nil {
+			return nil, err
+		}
+		r.Recorder.Eventf(federatedSession, corev1.EventTypeNormal, utils.MEMBER_SESSION_CREATED_REASON,
+			"Created the member session in cluster %s", clusterName)
+		return &session, nil
+
+	} else if err != nil {
+		return nil, err
+	}
+
+	if session.Labels[FederatedSessionLabel] != federatedSession.Name {
+		return nil, fmt.Errorf("session %s in cluster %s is not managed by the federated session", session.Name,
+			clusterName)
+	}
+
+	traceChanged := traced && session.Annotations[sessionv1alpha1.TraceParentAnnotation] != traceParent
+
+	if !equality.Semantic.DeepEqual(session.Spec, desiredSpec) || traceChanged {
+		session.Spec = desiredSpec
+		if traced {
+			if session.Annotations == nil {
+				session.Annotations = make(map[string]string)
+			}
+			session.Annotations[sessionv1alpha1.TraceParentAnnotation] = traceParent
+		}
+
+		if err := memberClient.Update(ctx, &session); err != nil {
+			return nil, err
+		}
+	}
+
+	return &session, nil
+}
+
+func memberSessionSpec(
+	clusterName string,
+	federatedSession *sessionv1alpha1.FederatedSession,
+) sessionv1alpha1.SessionSpec {
+
+	spec := sessionv1alpha1.SessionSpec{
+		SessionPodTemplates:     corev1.PodTemplateList{Items: []corev1.PodTemplate{}},
+		ClientPodTemplates:      federatedSession.Spec.ClientPodTemplates,
+		TimeoutSeconds:          federatedSession.Spec.TimeoutSeconds,
+		ReutilizeTimeoutSeconds: federatedSession.Spec.ReutilizeTimeoutSeconds,
+		HeartbeatTimeoutSeconds: federatedSession.Spec.HeartbeatTimeoutSeconds,
+		Clients:                 make(map[string]bool),
+		Upgrade:                 federatedSession.Spec.Upgrade,
+		MaxClients:              federatedSession.Spec.MaxClients,
+	}
+
+	if clusterName == federatedSession.Spec.SessionPodsCluster {
+		spec.SessionPodTemplates = federatedSession.Spec.SessionPodTemplates
+	}
+
+	for clientId, federatedClient := range federatedSession.Spec.Clients {
+		if federatedClient.Cluster == clusterName {
+			spec.Clients[clientId] = federatedClient.Connected
+		}
+	}
+
+	return spec
+}
+
+// deleteMemberSession deletes the member Session of a cluster, leaving alone sessions not managed by the
+// federated session
+func (r *FederatedSessionReconciler) deleteMemberSession(
+	ctx context.Context,
+	clusterName string,
+	federatedSession *sessionv1alpha1.FederatedSession,
+) error {
+
+	memberClient := r.Members[clusterName].GetClient()
+	key := types.NamespacedName{Name: federatedSession.Name, Namespace: federatedSession.Namespace}
+
+	var session sessionv1alpha1.Session
+	if err := memberClient.Get(ctx, key, &session); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if session.Labels[FederatedSessionLabel] != federatedSession.Name {
+		return nil
+	}
+
+	if err := memberClient.Delete(ctx, &session); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.Recorder.Eventf(federatedSession, corev1.EventTypeNormal, utils.MEMBER_SESSION_DELETED_REASON,
+		"Deleted the member session in cluster %s", clusterName)
+
+	return nil
+}
+
+func (r *FederatedSessionReconciler) finalize(
+	ctx context.Context,
+	federatedSession *sessionv1alpha1.FederatedSession,
+) error {
+
+	logger := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(federatedSession, federatedSessionFinalizer) {
+		return nil
+	}
+
+	for clusterName := range r.Members {
+		if err := r.deleteMemberSession(ctx, clusterName, federatedSession); err != nil {
+			logger.Error(err, "unable to delete member session", "cluster", clusterName)
+			return err
+		}
+	}
+
+	controllerutil.RemoveFinalizer(federatedSession, federatedSessionFinalizer)
+	if err := r.Update(ctx, federatedSession); err != nil {
+		logger.Error(err, "unable to remove finalizer", "federatedSession", federatedSession.Name)
+		return err
+	}
+
+	return nil
+}
+
+// aggregateMemberStatuses takes the session pods status from the session pods cluster, and the status of each client
+// from the cluster it was placed in
+func aggregateMemberStatuses(
+	federatedSession *sessionv1alpha1.FederatedSession,
+	memberSessions map[string]*sessionv1alpha1.Session,
+	membersStatus map[string]sessionv1alpha1.MemberStatus,
+) {
+
+	federatedSession.Status.Members = membersStatus
+	federatedSession.Status.SessionPods = sessionv1alpha1.SessionPodsStatus{}
+
+	if session, ok := memberSessions[federatedSession.Spec.SessionPodsCluster]; ok {
+		federatedSession.Status.SessionPods = *session.Status.SessionPods.DeepCopy()
+	}
+
+	federatedSession.Status.Clients = make(map[string]sessionv1alpha1.ClientStatus)
+	for clientId, federatedClient := range federatedSession.Spec.Clients {
+		session, ok := memberSessions[federatedClient.Cluster]
+		if !ok {
+			continue
+		}
+
+		if status, ok := session.Status.Clients[clientId]; ok {
+			federatedSession.Status.Clients[clientId] = *status.DeepCopy()
+		}
+	}
+
+	federatedSession.Status.OutdatedPods = nil
+	for _, session := range memberSessions {
+		federatedSession.Status.OutdatedPods = append(federatedSession.Status.OutdatedPods, session.Status.OutdatedPods...)
+	}
+	sort.Strings(federatedSession.Status.OutdatedPods)
+
+	synced := true
+	for _, memberStatus := range membersStatus {
+		synced = synced && memberStatus.Synced
+	}
+
+	condition := metav1.Condition{
+		Type:    string(utils.TYPE_SYNCED),
+		Status:  metav1.ConditionTrue,
+		Reason:  utils.MEMBERS_SYNCED_REASON,
+		Message: utils.MEMBERS_SYNCED_MESSAGE,
+	}
+
+	if !synced {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = utils.MEMBERS_NOT_SYNCED_REASON
+		condition.Message = utils.MEMBERS_NOT_SYNCED_MESSAGE
+	}
+
+	meta.SetStatusCondition(&federatedSession.Status.Conditions, condition)
+}
+
+// SetupWithManager sets up the controller with the Manager. Member Sessions trigger the FederatedSession they were
+// propagated from.
+func (r *FederatedSessionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	mapMemberSession := handler.TypedEnqueueRequestsFromMapFunc(
+		func(ctx context.Context, session *sessionv1alpha1.Session) []reconcile.Request {
+			name, ok := session.Labels[FederatedSessionLabel]
+			if !ok {
+				return nil
+			}
+
+			return []reconcile.Request{{
+				NamespacedName: types.NamespacedName{Name: name, Namespace: session.Namespace},
+			}}
+		})
+
+	federated := predicate.NewTypedPredicateFuncs(func(session *sessionv1alpha1.Session) bool {
+		_, ok := session.Labels[FederatedSessionLabel]
+		return ok
+	})
+
+	bldr := ctrl.NewControllerManagedBy(mgr).
+		For(&sessionv1alpha1.FederatedSession{})
+
+	for _, member := range r.Members {
+		bldr = bldr.WatchesRawSource(
+			source.Kind(member.GetCache(), &sessionv1alpha1.Session{}, mapMemberSession, federated))
+	}
+
+	return bldr.Named("federatedsession").Complete(r)
+}
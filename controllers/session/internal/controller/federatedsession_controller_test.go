@@ -0,0 +1,249 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	stdErrors "errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	corev1alpha1 "mr.telepresence/session/api/v1alpha1"
+	"mr.telepresence/session/internal/controller/utils"
+)
+
+// memberCluster is a member cluster backed by a fake client, the only part of the cluster the reconciler uses
+type memberCluster struct {
+	cluster.Cluster
+	client client.Client
+}
+
+func (c *memberCluster) GetClient() client.Client {
+	return c.client
+}
+
+func newMemberClient(funcs interceptor.Funcs) client.Client {
+	scheme := runtime.NewScheme()
+	Expect(corev1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&corev1alpha1.Session{}).
+		WithInterceptorFuncs(funcs).
+		Build()
+}
+
+var _ = Describe("FederatedSession Controller", func() {
+	const resourceName = "federated-demo"
+
+	ctx := context.Background()
+	key := types.NamespacedName{Name: resourceName, Namespace: "default"}
+
+	var (
+		east, west       client.Client
+		failMemberDelete bool
+		reconciler       *FederatedSessionReconciler
+	)
+
+	reconcileOnce := func() error {
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		return err
+	}
+
+	memberSession := func(member client.Client) (*corev1alpha1.Session, error) {
+		session := &corev1alpha1.Session{}
+		return session, member.Get(ctx, key, session)
+	}
+
+	BeforeEach(func() {
+		failMemberDelete = false
+		east = newMemberClient(interceptor.Funcs{})
+		west = newMemberClient(interceptor.Funcs{
+			Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+				if failMemberDelete {
+					return stdErrors.New("member cluster unreachable")
+				}
+				return c.Delete(ctx, obj, opts...)
+			},
+		})
+
+		reconciler = &FederatedSessionReconciler{
+			Client:   k8sClient,
+			Scheme:   k8sClient.Scheme(),
+			Recorder: record.NewFakeRecorder(100),
+			Members: map[string]cluster.Cluster{
+				"east": &memberCluster{client: east},
+				"west": &memberCluster{client: west},
+			},
+		}
+
+		resource := &corev1alpha1.FederatedSession{
+			ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+			Spec: corev1alpha1.FederatedSessionSpec{
+				SessionPodsCluster: "east",
+				Clusters:           []string{"east"},
+				SessionPodTemplates: corev1.PodTemplateList{Items: []corev1.PodTemplate{{
+					ObjectMeta: metav1.ObjectMeta{Name: "server"},
+					Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "server", Image: "server:1"}},
+					}},
+				}}},
+				ClientPodTemplates:      corev1alpha1.ClientPodTemplateList{Items: []corev1alpha1.ClientPodTemplate{}},
+				TimeoutSeconds:          60,
+				ReutilizeTimeoutSeconds: 30,
+				MaxClients:              4,
+				Clients: map[string]corev1alpha1.FederatedClient{
+					"alice": {Cluster: "east", Connected: true},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		resource := &corev1alpha1.FederatedSession{}
+		if err := k8sClient.Get(ctx, key, resource); errors.IsNotFound(err) {
+			return
+		}
+
+		controllerutil.RemoveFinalizer(resource, federatedSessionFinalizer)
+		Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, resource))).To(Succeed())
+	})
+
+	It("creates the member sessions of the desired clusters only", func() {
+		Expect(reconcileOnce()).To(Succeed())
+
+		resource := &corev1alpha1.FederatedSession{}
+		Expect(k8sClient.Get(ctx, key, resource)).To(Succeed())
+		Expect(controllerutil.ContainsFinalizer(resource, federatedSessionFinalizer)).To(BeTrue())
+
+		session, err := memberSession(east)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(session.Labels).To(HaveKeyWithValue(FederatedSessionLabel, resourceName))
+		Expect(session.Spec).To(Equal(memberSessionSpec("east", resource)))
+		Expect(session.Spec.SessionPodTemplates.Items).To(HaveLen(1))
+		Expect(session.Spec.Clients).To(Equal(map[string]bool{"alice": true}))
+		Expect(session.Spec.MaxClients).To(Equal(4))
+
+		_, err = memberSession(west)
+		Expect(errors.IsNotFound(err)).To(BeTrue(), "west is not a desired cluster")
+	})
+
+	It("propagates the session to the clusters clients are placed in", func() {
+		Expect(reconcileOnce()).To(Succeed())
+
+		resource := &corev1alpha1.FederatedSession{}
+		Expect(k8sClient.Get(ctx, key, resource)).To(Succeed())
+		resource.Spec.Clients["bob"] = corev1alpha1.FederatedClient{Cluster: "west", Connected: true}
+		Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+		Expect(reconcileOnce()).To(Succeed())
+
+		session, err := memberSession(west)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(session.Spec.SessionPodTemplates.Items).To(BeEmpty(), "only east runs the session pods")
+		Expect(session.Spec.Clients).To(Equal(map[string]bool{"bob": true}))
+
+		session, err = memberSession(east)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(session.Spec.Clients).To(Equal(map[string]bool{"alice": true}))
+	})
+
+	It("aggregates the statuses of the member sessions", func() {
+		Expect(reconcileOnce()).To(Succeed())
+
+		session, err := memberSession(east)
+		Expect(err).NotTo(HaveOccurred())
+		session.Status = corev1alpha1.SessionStatus{
+			SessionPods: corev1alpha1.SessionPodsStatus{
+				PodsStatus: map[string]corev1alpha1.PodStatus{"federated-demo-server": {Ready: true, Paths: []string{}}},
+			},
+			Clients: map[string]corev1alpha1.ClientStatus{
+				"alice": {Ready: true, PodStatus: map[string]corev1alpha1.PodStatus{}},
+				"ghost": {Ready: true, PodStatus: map[string]corev1alpha1.PodStatus{}},
+			},
+			OutdatedPods: []string{"federated-demo-viewer-aaaa"},
+		}
+		Expect(east.Status().Update(ctx, session)).To(Succeed())
+
+		Expect(reconcileOnce()).To(Succeed())
+
+		resource := &corev1alpha1.FederatedSession{}
+		Expect(k8sClient.Get(ctx, key, resource)).To(Succeed())
+		Expect(resource.Status.Members).To(Equal(map[string]corev1alpha1.MemberStatus{"east": {Synced: true}}))
+		Expect(resource.Status.SessionPods.PodsStatus).To(HaveKey("federated-demo-server"))
+		Expect(resource.Status.Clients).To(HaveKey("alice"))
+		Expect(resource.Status.Clients).NotTo(HaveKey("ghost"), "only the clients of the spec are aggregated")
+		Expect(resource.Status.OutdatedPods).To(Equal([]string{"federated-demo-viewer-aaaa"}))
+
+		synced := meta.FindStatusCondition(resource.Status.Conditions, string(utils.TYPE_SYNCED))
+		Expect(synced).NotTo(BeNil())
+		Expect(synced.Status).To(Equal(metav1.ConditionTrue))
+	})
+
+	It("deletes the member sessions before releasing the finalizer", func() {
+		resource := &corev1alpha1.FederatedSession{}
+		Expect(k8sClient.Get(ctx, key, resource)).To(Succeed())
+		resource.Spec.Clusters = nil
+		Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+		Expect(reconcileOnce()).To(Succeed())
+		_, err := memberSession(east)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = memberSession(west)
+		Expect(err).NotTo(HaveOccurred(), "every member is desired when no cluster is listed")
+
+		Expect(k8sClient.Get(ctx, key, resource)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+		// the finalizer is kept as long as a member session could not be deleted
+		failMemberDelete = true
+		Expect(reconcileOnce()).NotTo(Succeed())
+
+		Expect(k8sClient.Get(ctx, key, resource)).To(Succeed())
+		Expect(resource.DeletionTimestamp.IsZero()).To(BeFalse())
+		Expect(controllerutil.ContainsFinalizer(resource, federatedSessionFinalizer)).To(BeTrue())
+		_, err = memberSession(west)
+		Expect(err).NotTo(HaveOccurred())
+
+		failMemberDelete = false
+		Expect(reconcileOnce()).To(Succeed())
+
+		_, err = memberSession(east)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		_, err = memberSession(west)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+
+		err = k8sClient.Get(ctx, key, resource)
+		Expect(errors.IsNotFound(err)).To(BeTrue(), "the federated session is gone once the finalizer is released")
+	})
+})
@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// The metrics are served along with the controller-runtime ones by the metrics server of the manager. Counters and
+// histograms are updated as the sessions are reconciled, the gauges are computed from the cached sessions on scrape.
+
+const (
+	metricsNamespace = "mr_telepresence"
+
+	// Label set by the session-manager, holding the template a session was created from
+	templateLabel = "mr.telepresence/template"
+
+	// Sources of the client pods new clients are allocated to
+	podSourceReused  = "reused"
+	podSourceSpawned = "spawned"
+
+	// Time given to the session listing of a scrape
+	collectTimeout = 5 * time.Second
+)
+
+var (
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_errors_total",
+		Help:      "Reconciliations that failed, by controller and the phase they failed in.",
+	}, []string{"controller", "phase"})
+
+	clientPodAllocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "client_pod_allocations_total",
+		Help: "Client pods allocated to new clients, by pod template and whether an idle pod was reused or a new " +
+			"one spawned.",
+	}, []string{"pod_template", "source"})
+
+	clientReadySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "client_ready_seconds",
+		Help:      "Time from a client joining a session to its client pods being ready, by session template.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"template"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(reconcileErrors, clientPodAllocations, clientReadySeconds)
+}
+
+// observeReadyClients records how long the clients that just became ready waited for their pods, in the metrics and
+// in a span
+func observeReadyClients(ctx context.Context, session *sessionv1alpha1.Session, pods []corev1.Pod, now metav1.Time) {
+	for clientId, clientStatus := range session.Status.Clients {
+		if !clientStatus.Ready || clientStatus.PendingSince == nil {
+			continue
+		}
+
+		clientReadySeconds.WithLabelValues(session.Labels[templateLabel]).
+			Observe(now.Sub(clientStatus.PendingSince.Time).Seconds())
+		traceClientReady(ctx, session, clientId, &clientStatus, pods, now.Time)
+
+		clientStatus.PendingSince = nil
+		session.Status.Clients[clientId] = clientStatus
+	}
+}
+
+var (
+	sessionsDesc = prometheus.NewDesc(metricsNamespace+"_sessions",
+		"Sessions, by namespace and session template.",
+		[]string{"namespace", "template"}, nil)
+
+	sessionClientsDesc = prometheus.NewDesc(metricsNamespace+"_session_clients",
+		"Clients of each session, by whether they are connected or within their reconnection grace period.",
+		[]string{"namespace", "session", "template", "state"}, nil)
+
+	sessionMaxClientsDesc = prometheus.NewDesc(metricsNamespace+"_session_max_clients",
+		"Clients each session admits, for the sessions having a limit.",
+		[]string{"namespace", "session", "template"}, nil)
+
+	clientPodsDesc = prometheus.NewDesc(metricsNamespace+"_client_pods",
+		"Client pods of each session, by pod template.",
+		[]string{"namespace", "session", "template", "pod_template"}, nil)
+
+	clientPodClientsDesc = prometheus.NewDesc(metricsNamespace+"_client_pod_clients",
+		"Clients allocated to the client pods of each session, by pod template.",
+		[]string{"namespace", "session", "template", "pod_template"}, nil)
+
+	clientPodCapacityDesc = prometheus.NewDesc(metricsNamespace+"_client_pod_capacity",
+		"Clients the client pods of each session can hold, their count times the maxClients of their pod template.",
+		[]string{"namespace", "session", "template", "pod_template"}, nil)
+)
+
+// sessionCollector computes the gauges of the sessions from the cache of the manager
+type sessionCollector struct {
+	reader client.Reader
+}
+
+func newSessionCollector(reader client.Reader) *sessionCollector {
+	return &sessionCollector{reader: reader}
+}
+
+func (c *sessionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sessionsDesc
+	ch <- sessionClientsDesc
+	ch <- sessionMaxClientsDesc
+	ch <- clientPodsDesc
+	ch <- clientPodClientsDesc
+	ch <- clientPodCapacityDesc
+}
+
+func (c *sessionCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	var sessions sessionv1alpha1.SessionList
+	if err := c.reader.List(ctx, &sessions); err != nil {
+		ch <- prometheus.NewInvalidMetric(sessionsDesc, err)
+		return
+	}
+
+	type sessionsKey struct{ namespace, template string }
+	sessionCounts := make(map[sessionsKey]int)
+
+	for _, session := range sessions.Items {
+		template := session.Labels[templateLabel]
+		sessionCounts[sessionsKey{session.Namespace, template}]++
+
+		labels := []string{session.Namespace, session.Name, template}
+		connected := countConnectedClients(session.Spec.Clients)
+
+		ch <- prometheus.MustNewConstMetric(sessionClientsDesc, prometheus.GaugeValue, float64(connected),
+			append(labels, "connected")...)
+		ch <- prometheus.MustNewConstMetric(sessionClientsDesc, prometheus.GaugeValue,
+			float64(len(session.Spec.Clients)-connected), append(labels, "disconnected")...)
+
+		if session.Spec.MaxClients > 0 {
+			ch <- prometheus.MustNewConstMetric(sessionMaxClientsDesc, prometheus.GaugeValue,
+				float64(session.Spec.MaxClients), labels...)
+		}
+
+		for _, podTemplate := range session.Spec.ClientPodTemplates.Items {
+			pods, clients := clientPodOccupancy(&session, podTemplate.Name)
+			podLabels := append(labels[:len(labels):len(labels)], podTemplate.Name)
+
+			ch <- prometheus.MustNewConstMetric(clientPodsDesc, prometheus.GaugeValue, float64(pods), podLabels...)
+			ch <- prometheus.MustNewConstMetric(clientPodClientsDesc, prometheus.GaugeValue, float64(clients),
+				podLabels...)
+			ch <- prometheus.MustNewConstMetric(clientPodCapacityDesc, prometheus.GaugeValue,
+				float64(pods*podTemplate.MaxClients), podLabels...)
+		}
+	}
+
+	for key, count := range sessionCounts {
+		ch <- prometheus.MustNewConstMetric(sessionsDesc, prometheus.GaugeValue, float64(count), key.namespace,
+			key.template)
+	}
+}
+
+// clientPodOccupancy counts the client pods of the pod template the clients in the status are allocated to, and the
+// clients allocated to them
+func clientPodOccupancy(session *sessionv1alpha1.Session, podTemplateName string) (int, int) {
+	prefix := session.Name + "-" + podTemplateName + "-"
+	pods := make(map[string]struct{})
+	clients := 0
+
+	for _, clientStatus := range session.Status.Clients {
+		for podName := range clientStatus.PodStatus {
+			if strings.HasPrefix(podName, prefix) {
+				pods[podName] = struct{}{}
+				clients++
+			}
+		}
+	}
+
+	return len(pods), clients
+}
@@ -18,26 +18,34 @@ package controller
 
 import (
 	"context"
+	"sort"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	gcv1alpha1 "mr.telepresence/gc/api/v1alpha1"
 	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
 	"mr.telepresence/session/internal/controller/utils"
+	"mr.telepresence/session/internal/tracing"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 // SessionReconciler reconciles a Session object
 type SessionReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=core.mr.telepresence,resources=sessions,verbs=get;list;watch;create;update;patch;delete
@@ -47,6 +55,7 @@ type SessionReconciler struct {
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -57,49 +66,70 @@ type SessionReconciler struct {
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.19.4/pkg/reconcile
-func (r *SessionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *SessionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	logger := log.FromContext(ctx)
 	logger.Info("controller triggered", "name", req.Name, "namespace", req.Namespace)
 
+	ctx, span := tracing.Start(ctx, "Reconcile Session",
+		trace.WithAttributes(attribute.String("session", req.Name), attribute.String("namespace", req.Namespace)))
+	defer func() { tracing.End(span, err) }()
+
 	var session sessionv1alpha1.Session
 	if err := r.Get(ctx, req.NamespacedName, &session); err != nil && errors.IsNotFound(err) {
 		return ctrl.Result{}, nil
 
 	} else if err != nil {
 		logger.Error(err, "unable to get session resource")
+		reconcileErrors.WithLabelValues("session", "get").Inc()
 		return ctrl.Result{}, err
 	}
 
+	// the reconcile links back to the session-manager request that last changed the session
+	tracing.Link(span, session.Annotations)
+
 	var gcRegistrations gcv1alpha1.GCRegistrationList
 	opts := client.MatchingFields{utils.GCRegistrationSessionField: session.Name}
 
 	if err := r.List(ctx, &gcRegistrations, client.InNamespace(gcNamespace), opts); err != nil {
 		logger.Error(err, "unable to get GC registrations", "session", session.Name)
+		reconcileErrors.WithLabelValues("session", "gcRegistrations").Inc()
 		return ctrl.Result{}, err
 	}
 
 	ingessServiceExternalIp := getIngressServiceExternalIp(ctx, r.Client)
 
+	// outdated pods are reported again by the reconciliation of the session and client pods
+	session.Status.OutdatedPods = nil
+
 	if len(session.Spec.SessionPodTemplates.Items) > 0 {
-		if err := r.ReconcileSessionPods(ctx, req.Namespace, &session, gcRegistrations.Items,
-			ingessServiceExternalIp); err != nil {
+		sessionPodsCtx, sessionPodsSpan := tracing.Start(ctx, "ReconcileSessionPods")
+		err := r.ReconcileSessionPods(sessionPodsCtx, req.Namespace, &session, gcRegistrations.Items,
+			ingessServiceExternalIp)
+		tracing.End(sessionPodsSpan, err)
 
+		if err != nil {
 			r.Status().Update(ctx, &session)
+			reconcileErrors.WithLabelValues("session", "sessionPods").Inc()
 			return ctrl.Result{}, err
 		}
 	}
 
-	var clientPodsToSpawn []corev1.Pod
-	if len(session.Spec.ClientPodTemplates.Items) > 0 {
+	var clientPodsToSpawn, clientPodsToDelete []corev1.Pod
+	if len(session.Spec.ClientPodTemplates.Items) > 0 || len(session.Status.Clients) > 0 {
+		clientPodsCtx, clientPodsSpan := tracing.Start(ctx, "ReconcileClientPods")
 		var err error
-		clientPodsToSpawn, err = r.ReconcileClientPods(ctx, req.Namespace, &session, gcRegistrations.Items,
-			ingessServiceExternalIp)
+		clientPodsToSpawn, clientPodsToDelete, err = r.ReconcileClientPods(clientPodsCtx, req.Namespace, &session,
+			gcRegistrations.Items, ingessServiceExternalIp)
+		tracing.End(clientPodsSpan, err)
 
 		if err != nil {
+			reconcileErrors.WithLabelValues("session", "clientPods").Inc()
 			return ctrl.Result{}, err
 		}
 	}
 
+	sort.Strings(session.Status.OutdatedPods)
+
 	oldStatusHash := session.Annotations["statusHash"]
 	newStatusHash := utils.HashStatus(&session.Status)
 
@@ -108,20 +138,48 @@ func (r *SessionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 
 		if err := r.Status().Update(ctx, &session); err != nil {
 			logger.Error(err, errStr, "session", session.Name)
+			reconcileErrors.WithLabelValues("session", "status").Inc()
 			return ctrl.Result{}, err
 		}
 
 		utils.SetStatusHashAnnotation(newStatusHash, &session)
 		if err := r.Update(ctx, &session); err != nil {
 			logger.Error(err, errStr, "session", session.Name)
+			reconcileErrors.WithLabelValues("session", "status").Inc()
 			return ctrl.Result{}, err
 		}
 	}
 
+	// outdated pods are deleted once their clients were re-pointed in the status
+	for _, pod := range clientPodsToDelete {
+		if err := r.Delete(ctx, &pod); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "unable to delete outdated client pod", "session", session.Name, "pod", pod.Name)
+			reconcileErrors.WithLabelValues("session", "deletePods").Inc()
+			return ctrl.Result{}, err
+		}
+		r.Recorder.Eventf(&session, corev1.EventTypeNormal, utils.POD_REPLACED_REASON, "Deleted outdated pod %s",
+			pod.Name)
+	}
+
 	for _, pod := range clientPodsToSpawn {
-		if err := utils.SpawnPod(ctx, r.Client, r.Scheme, &session, &pod); err != nil {
+		spawnCtx, spawnSpan := tracing.Start(ctx, "SpawnPod", trace.WithAttributes(attribute.String("pod", pod.Name)))
+		err := utils.SpawnPod(spawnCtx, r.Client, r.Scheme, &session, &pod)
+		tracing.End(spawnSpan, err)
+
+		if err != nil {
+			r.Recorder.Eventf(&session, corev1.EventTypeWarning, utils.SPAWN_POD_FAILED_REASON,
+				"Failed to spawn pod %s: %v", pod.Name, err)
+			reconcileErrors.WithLabelValues("session", "spawnPods").Inc()
 			return ctrl.Result{}, err
 		}
+		r.Recorder.Eventf(&session, corev1.EventTypeNormal, utils.POD_SPAWNED_REASON, "Spawned pod %s", pod.Name)
+	}
+
+	// pods waiting for the upgrade window are replaced when it opens, idle pods when the clients disconnect
+	if len(session.Status.OutdatedPods) > 0 && session.Spec.Upgrade != nil {
+		if requeueAfter := untilWindowOpens(session.Spec.Upgrade.Window, time.Now()); requeueAfter > 0 {
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
 	}
 
 	return ctrl.Result{}, nil
@@ -154,6 +212,10 @@ func (r *SessionReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	if err := metrics.Registry.Register(newSessionCollector(mgr.GetClient())); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&sessionv1alpha1.Session{}, builder.WithPredicates(predicate.Funcs{
 			CreateFunc: func(e event.CreateEvent) bool { return true },
@@ -2,11 +2,13 @@ package controller
 
 import (
 	"context"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	gcv1alpha1 "mr.telepresence/gc/api/v1alpha1"
 	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
 	"mr.telepresence/session/internal/controller/utils"
@@ -36,6 +38,13 @@ func (r *SessionReconciler) ReconcileSessionPods(
 	}
 
 	connectedClients := countConnectedClients(session.Spec.Clients)
+
+	remainingPods, err := r.upgradeSessionPods(ctx, session, sessionPods.Items, connectedClients, time.Now())
+	if err != nil {
+		return err
+	}
+	sessionPods.Items = remainingPods
+
 	buildPodsStatus(session, session.Spec.SessionPodTemplates.Items, *ingressServiceExternalIp)
 	manageGCRegistrationsForSessionPods(ctx, r.Client, session, connectedClients, sessionPods.Items, gcRegistrations)
 
@@ -50,7 +59,7 @@ func (r *SessionReconciler) ReconcileSessionPods(
 				utils.PODS_NOT_READY_MESSAGE)
 		}
 	} else if connectedClients > 0 {
-		if err := restorePods(ctx, r.Client, r.Scheme, session, sessionPods.Items,
+		if err := restorePods(ctx, r.Client, r.Scheme, r.Recorder, session, sessionPods.Items,
 			session.Spec.SessionPodTemplates.Items); err != nil {
 
 			utils.SetReadyCondition(session, metav1.ConditionFalse, utils.PODS_NOT_READY_REASON,
@@ -69,6 +78,7 @@ func restorePods(
 	ctx context.Context,
 	rClient client.Client,
 	scheme *runtime.Scheme,
+	recorder record.EventRecorder,
 	session *sessionv1alpha1.Session,
 	foundPods []corev1.Pod,
 	podTemplates []corev1.PodTemplate,
@@ -96,8 +106,11 @@ func restorePods(
 			}
 
 			if err := utils.SpawnPod(ctx, rClient, scheme, session, pod); err != nil {
+				recorder.Eventf(session, corev1.EventTypeWarning, utils.SPAWN_POD_FAILED_REASON,
+					"Failed to spawn pod %s: %v", pod.Name, err)
 				return err
 			}
+			recorder.Eventf(session, corev1.EventTypeNormal, utils.POD_SPAWNED_REASON, "Spawned pod %s", pod.Name)
 		}
 	}
 
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+	"mr.telepresence/session/internal/tracing"
+)
+
+// traceClientReady records the wait of a client that just became ready as a span linked to the session-manager
+// request that last changed the session. The pods spawned for the client get child spans for their scheduling and
+// their startup, reused pods being ready before the client joined.
+func traceClientReady(
+	ctx context.Context,
+	session *sessionv1alpha1.Session,
+	clientId string,
+	clientStatus *sessionv1alpha1.ClientStatus,
+	pods []corev1.Pod,
+	now time.Time,
+) {
+	joinedAt := clientStatus.PendingSince.Time
+
+	clientCtx, span := tracing.Start(ctx, "ClientReady",
+		trace.WithNewRoot(),
+		trace.WithTimestamp(joinedAt),
+		tracing.LinkOption(session.Annotations),
+		trace.WithAttributes(attribute.String("session", session.Name), attribute.String("client", clientId)))
+	defer span.End(trace.WithTimestamp(now))
+
+	for _, pod := range pods {
+		if _, ok := clientStatus.PodStatus[pod.Name]; !ok || pod.CreationTimestamp.Time.Before(joinedAt) {
+			continue
+		}
+
+		scheduledAt := podConditionTime(&pod, corev1.PodScheduled)
+		readyAt := podConditionTime(&pod, corev1.PodReady)
+		if scheduledAt.IsZero() || readyAt.IsZero() {
+			continue
+		}
+
+		podAttributes := trace.WithAttributes(attribute.String("pod", pod.Name))
+
+		_, scheduling := tracing.Start(clientCtx, "PodScheduling", trace.WithTimestamp(pod.CreationTimestamp.Time),
+			podAttributes)
+		scheduling.End(trace.WithTimestamp(scheduledAt))
+
+		_, startup := tracing.Start(clientCtx, "PodStartup", trace.WithTimestamp(scheduledAt), podAttributes)
+		startup.End(trace.WithTimestamp(readyAt))
+	}
+}
+
+// podConditionTime returns when the condition of the pod last became true, the zero time when it is not true
+func podConditionTime(pod *corev1.Pod, conditionType corev1.PodConditionType) time.Time {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return condition.LastTransitionTime.Time
+		}
+	}
+
+	return time.Time{}
+}
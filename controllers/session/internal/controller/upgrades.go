@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+	"mr.telepresence/session/internal/controller/utils"
+)
+
+// Pods are compared with the session templates through utils.TemplateHashAnnotation. Outdated pods are only replaced
+// when the session has an upgrade strategy, and only when nobody uses them or during the upgrade window. The others
+// are reported in the session status until then. Pods spawned before the annotation existed are stamped with the hash
+// of their current template instead of being replaced, as the spec they were spawned from is unknown.
+
+// upgradeAllowed tells whether pods running an outdated spec may be replaced now
+func upgradeAllowed(strategy *sessionv1alpha1.UpgradeStrategy, idle bool, now time.Time) bool {
+	if strategy == nil {
+		return false
+	}
+
+	return idle || windowIsOpen(strategy.Window, now)
+}
+
+func windowIsOpen(window *sessionv1alpha1.UpgradeWindow, now time.Time) bool {
+	if window == nil {
+		return false
+	}
+
+	start, startErr := parseWindowTime(window.Start)
+	end, endErr := parseWindowTime(window.End)
+	if startErr != nil || endErr != nil {
+		return false
+	}
+
+	now = now.UTC()
+	current := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+
+	if start <= end {
+		return start <= current && current < end
+	}
+
+	// the window spans midnight
+	return current >= start || current < end
+}
+
+// untilWindowOpens returns how long until the next start of the window, zero when there is no valid window
+func untilWindowOpens(window *sessionv1alpha1.UpgradeWindow, now time.Time) time.Duration {
+	if window == nil {
+		return 0
+	}
+
+	start, err := parseWindowTime(window.Start)
+	if err != nil {
+		return 0
+	}
+
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	next := midnight.Add(start)
+	if !next.After(now) {
+		next = next.Add(24 * time.Hour)
+	}
+
+	return next.Sub(now)
+}
+
+// parseWindowTime returns the time of day of an HH:MM string
+func parseWindowTime(value string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid upgrade window time %q: %w", value, err)
+	}
+
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// upgradeSessionPods deletes the outdated session pods that may be replaced, they are spawned again from the templates
+// once they are gone. It returns the session pods left running.
+func (r *SessionReconciler) upgradeSessionPods(
+	ctx context.Context,
+	session *sessionv1alpha1.Session,
+	foundPods []corev1.Pod,
+	connectedClients int,
+	now time.Time,
+) ([]corev1.Pod, error) {
+
+	logger := log.FromContext(ctx)
+
+	templatesMap := make(map[string]*corev1.PodSpec, len(session.Spec.SessionPodTemplates.Items))
+	for i := range session.Spec.SessionPodTemplates.Items {
+		template := &session.Spec.SessionPodTemplates.Items[i]
+		templatesMap[session.Name+"-"+template.Name] = &template.Template.Spec
+	}
+
+	allowed := upgradeAllowed(session.Spec.Upgrade, connectedClients == 0, now)
+	remainingPods := []corev1.Pod{}
+
+	for _, pod := range foundPods {
+		// pods of removed templates are outdated as well
+		spec, ok := templatesMap[pod.Name]
+		if ok {
+			if err := r.stampTemplateHash(ctx, &pod, spec); err != nil {
+				return nil, err
+			}
+		}
+
+		if ok && !utils.PodIsOutdated(&pod, spec) {
+			remainingPods = append(remainingPods, pod)
+			continue
+		}
+
+		if !allowed {
+			session.Status.OutdatedPods = append(session.Status.OutdatedPods, pod.Name)
+			remainingPods = append(remainingPods, pod)
+			continue
+		}
+
+		if err := r.Delete(ctx, &pod); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "unable to delete outdated session pod", "session", session.Name, "pod", pod.Name)
+			return nil, err
+		}
+		r.Recorder.Eventf(session, corev1.EventTypeNormal, utils.POD_REPLACED_REASON, "Deleted outdated pod %s",
+			pod.Name)
+
+		utils.SetReadyCondition(session, metav1.ConditionUnknown, utils.PODS_UPGRADING_REASON,
+			utils.PODS_UPGRADING_MESSAGE)
+	}
+
+	return remainingPods, nil
+}
+
+// stampTemplateHash records the hash of the template spec on a pod spawned before the hash annotation existed
+func (r *SessionReconciler) stampTemplateHash(ctx context.Context, pod *corev1.Pod, spec *corev1.PodSpec) error {
+	if utils.PodHasTemplateHash(pod) {
+		return nil
+	}
+
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string)
+	}
+	pod.Annotations[utils.TemplateHashAnnotation] = utils.HashPodSpec(spec)
+
+	if err := r.Patch(ctx, pod, patch); err != nil && !errors.IsNotFound(err) {
+		log.FromContext(ctx).Error(err, "unable to stamp the template hash", "pod", pod.Name)
+		return err
+	}
+
+	return nil
+}
+
+// upgradeClientPods moves the clients of the outdated client pods that may be replaced to new pods, re-pointing them
+// through the paths of their pod status, and returns the outdated pods to delete once the status is saved. Outdated
+// pods waiting to be reused are dropped so they are not handed to new clients.
+func upgradeClientPods(
+	session *sessionv1alpha1.Session,
+	allocationMap map[string]allocationValue,
+	templatePodMap map[string]map[string]corev1.Pod,
+	templatePodToReutilizeMap map[string]map[string]corev1.Pod,
+	now time.Time,
+) []corev1.Pod {
+
+	podsToDelete := []corev1.Pod{}
+
+	for podTemplateName, reusablePods := range templatePodToReutilizeMap {
+		allocValue, ok := allocationMap[podTemplateName]
+
+		for podName, reusablePod := range reusablePods {
+			if ok && allocValue.PodTemplate.Name != "" &&
+				!utils.PodIsOutdated(&reusablePod, &allocValue.PodTemplate.Template.Spec) {
+				continue
+			}
+
+			if session.Spec.Upgrade == nil {
+				session.Status.OutdatedPods = append(session.Status.OutdatedPods, podName)
+				continue
+			}
+
+			delete(reusablePods, podName)
+			podsToDelete = append(podsToDelete, reusablePod)
+		}
+	}
+
+	for podTemplateName, allocValue := range allocationMap {
+		// the template was removed from the session, its pods are dropped from the clients when allowed
+		removed := allocValue.PodTemplate.Name == ""
+		keptPods := []pod{}
+
+		for _, allocatedPod := range allocValue.Pods {
+			foundPod, ok := templatePodMap[podTemplateName][allocatedPod.Name]
+			if !removed && (!ok || !utils.PodIsOutdated(&foundPod, &allocValue.PodTemplate.Template.Spec)) {
+				keptPods = append(keptPods, allocatedPod)
+				continue
+			}
+
+			if !upgradeAllowed(session.Spec.Upgrade, podIsEmpty(&allocatedPod), now) {
+				session.Status.OutdatedPods = append(session.Status.OutdatedPods, allocatedPod.Name)
+				keptPods = append(keptPods, allocatedPod)
+				continue
+			}
+
+			if ok {
+				podsToDelete = append(podsToDelete, foundPod)
+			}
+
+			if removed {
+				repointClients(session.Status.Clients, allocatedPod, "", nil)
+				continue
+			}
+
+			podName := session.Name + "-" + podTemplateName + "-" + uuid.New().String()[:4]
+			repointClients(session.Status.Clients, allocatedPod, podName, &allocValue.PodTemplate.Template.Spec)
+
+			allocatedPod.Name = podName
+			keptPods = append(keptPods, allocatedPod)
+		}
+
+		if removed && len(keptPods) == 0 {
+			delete(allocationMap, podTemplateName)
+			continue
+		}
+
+		allocValue.Pods = keptPods
+		allocationMap[podTemplateName] = allocValue
+	}
+
+	return podsToDelete
+}
+
+// repointClients replaces the status of an outdated pod with the status of the pod replacing it in the status of
+// each of its clients, or only removes it when there is no replacement
+func repointClients(
+	statusClients map[string]sessionv1alpha1.ClientStatus,
+	outdatedPod pod,
+	podName string,
+	podSpec *corev1.PodSpec,
+) {
+	for _, client := range outdatedPod.Clients {
+		clientStatus, ok := statusClients[client.Id]
+		if !ok {
+			continue
+		}
+
+		delete(clientStatus.PodStatus, outdatedPod.Name)
+		if podSpec != nil {
+			clientStatus.PodStatus[podName] = buildPodStatus(podName, *podSpec)
+			clientStatus.Ready = false
+		}
+
+		statusClients[client.Id] = clientStatus
+	}
+}
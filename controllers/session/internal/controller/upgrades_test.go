@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+	"mr.telepresence/session/internal/controller/utils"
+)
+
+func at(hour int, minute int) time.Time {
+	return time.Date(2024, time.March, 10, hour, minute, 0, 0, time.UTC)
+}
+
+func TestWindowIsOpen(t *testing.T) {
+	day := &sessionv1alpha1.UpgradeWindow{Start: "09:00", End: "17:30"}
+	night := &sessionv1alpha1.UpgradeWindow{Start: "22:00", End: "04:00"}
+
+	tests := []struct {
+		name   string
+		window *sessionv1alpha1.UpgradeWindow
+		now    time.Time
+		open   bool
+	}{
+		{"no window", nil, at(12, 0), false},
+		{"before the window", day, at(8, 59), false},
+		{"at the start", day, at(9, 0), true},
+		{"within the window", day, at(12, 0), true},
+		{"at the end", day, at(17, 30), false},
+		{"after the window", day, at(20, 0), false},
+		{"before midnight in a window spanning it", night, at(23, 15), true},
+		{"after midnight in a window spanning it", night, at(1, 0), true},
+		{"at the end of a window spanning midnight", night, at(4, 0), false},
+		{"outside a window spanning midnight", night, at(12, 0), false},
+		{"other time zone", day, time.Date(2024, time.March, 10, 6, 0, 0, 0, time.FixedZone("UTC-4", -4*3600)), true},
+		{"invalid start", &sessionv1alpha1.UpgradeWindow{Start: "9h", End: "17:00"}, at(12, 0), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if open := windowIsOpen(test.window, test.now); open != test.open {
+				t.Errorf("expected open to be %t, got %t", test.open, open)
+			}
+		})
+	}
+}
+
+func TestUntilWindowOpens(t *testing.T) {
+	night := &sessionv1alpha1.UpgradeWindow{Start: "22:00", End: "04:00"}
+
+	tests := []struct {
+		name   string
+		window *sessionv1alpha1.UpgradeWindow
+		now    time.Time
+		delay  time.Duration
+	}{
+		{"no window", nil, at(12, 0), 0},
+		{"invalid start", &sessionv1alpha1.UpgradeWindow{Start: "25:00", End: "04:00"}, at(12, 0), 0},
+		{"later today", night, at(12, 0), 10 * time.Hour},
+		{"at the start", night, at(22, 0), 24 * time.Hour},
+		{"tomorrow", night, at(23, 30), 22*time.Hour + 30*time.Minute},
+		{"after midnight", night, at(1, 0), 21 * time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if delay := untilWindowOpens(test.window, test.now); delay != test.delay {
+				t.Errorf("expected %s, got %s", test.delay, delay)
+			}
+		})
+	}
+}
+
+func testPod(name string, spec *corev1.PodSpec, hash bool) corev1.Pod {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: map[string]string{}},
+		Spec:       *spec,
+	}
+	if hash {
+		pod.Annotations[utils.TemplateHashAnnotation] = utils.HashPodSpec(spec)
+	}
+
+	return pod
+}
+
+func podSpec(image string) *corev1.PodSpec {
+	return &corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: image}}}
+}
+
+// Outdated session pods are deleted when allowed, and pods without a template hash are stamped rather than replaced
+func TestUpgradeSessionPods(t *testing.T) {
+	current := podSpec("server:2")
+
+	tests := []struct {
+		name             string
+		pod              corev1.Pod
+		upgrade          *sessionv1alpha1.UpgradeStrategy
+		connectedClients int
+		deleted          bool
+		outdated         bool
+	}{
+		{"up to date", testPod("demo-server", current, true), &sessionv1alpha1.UpgradeStrategy{}, 1, false, false},
+		{"outdated and idle", testPod("demo-server", podSpec("server:1"), true), &sessionv1alpha1.UpgradeStrategy{},
+			0, true, false},
+		{"outdated and in use", testPod("demo-server", podSpec("server:1"), true), &sessionv1alpha1.UpgradeStrategy{},
+			1, false, true},
+		{"outdated without strategy", testPod("demo-server", podSpec("server:1"), true), nil, 0, false, true},
+		{"without hash", testPod("demo-server", podSpec("server:1"), false), &sessionv1alpha1.UpgradeStrategy{}, 0,
+			false, false},
+		{"of a removed template", testPod("demo-old", current, true), &sessionv1alpha1.UpgradeStrategy{}, 0, true,
+			false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			pod := test.pod
+			reconciler := &SessionReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(&pod).Build(),
+				Scheme:   scheme,
+				Recorder: record.NewFakeRecorder(10),
+			}
+
+			session := &sessionv1alpha1.Session{
+				ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+				Spec: sessionv1alpha1.SessionSpec{
+					SessionPodTemplates: corev1.PodTemplateList{Items: []corev1.PodTemplate{{
+						ObjectMeta: metav1.ObjectMeta{Name: "server"},
+						Template:   corev1.PodTemplateSpec{Spec: *current},
+					}}},
+					Upgrade: test.upgrade,
+				},
+			}
+
+			remaining, err := reconciler.upgradeSessionPods(context.Background(), session,
+				[]corev1.Pod{test.pod}, test.connectedClients, at(12, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if deleted := len(remaining) == 0; deleted != test.deleted {
+				t.Errorf("expected deleted to be %t, got %t", test.deleted, deleted)
+			}
+			if outdated := len(session.Status.OutdatedPods) > 0; outdated != test.outdated {
+				t.Errorf("expected outdated to be %t, got %v", test.outdated, session.Status.OutdatedPods)
+			}
+
+			var found corev1.Pod
+			err = reconciler.Get(context.Background(), types.NamespacedName{Name: pod.Name, Namespace: "default"},
+				&found)
+			if test.deleted {
+				if err == nil {
+					t.Error("the pod was not deleted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := found.Annotations[utils.TemplateHashAnnotation]; !ok {
+				t.Error("the pod was not stamped with the template hash")
+			}
+		})
+	}
+}
+
+// Clients of an outdated pod are moved to a new pod of the current template, in their status as well
+func TestUpgradeClientPods(t *testing.T) {
+	current := podSpec("client:2")
+	outdated := testPod("demo-viewer-aaaa", podSpec("client:1"), true)
+	unhashed := testPod("demo-viewer-bbbb", podSpec("client:1"), false)
+
+	session := &sessionv1alpha1.Session{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo"},
+		Spec:       sessionv1alpha1.SessionSpec{Upgrade: &sessionv1alpha1.UpgradeStrategy{}},
+		Status: sessionv1alpha1.SessionStatus{Clients: map[string]sessionv1alpha1.ClientStatus{
+			"alice": {PodStatus: map[string]sessionv1alpha1.PodStatus{outdated.Name: {Ready: true}}, Ready: true},
+			"bob":   {PodStatus: map[string]sessionv1alpha1.PodStatus{unhashed.Name: {Ready: true}}, Ready: true},
+		}},
+	}
+
+	template := sessionv1alpha1.ClientPodTemplate{MaxClients: 1, PodTemplate: corev1.PodTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "viewer"},
+		Template:   corev1.PodTemplateSpec{Spec: *current},
+	}}
+	allocationMap := map[string]allocationValue{"viewer": {PodTemplate: template, Pods: []pod{
+		{Name: outdated.Name, Clients: []podClient{{Id: "alice"}}},
+		{Name: unhashed.Name, Clients: []podClient{{Id: "bob"}}},
+	}}}
+	templatePodMap := map[string]map[string]corev1.Pod{
+		"viewer": {outdated.Name: outdated, unhashed.Name: unhashed},
+	}
+
+	podsToDelete := upgradeClientPods(session, allocationMap, templatePodMap, map[string]map[string]corev1.Pod{},
+		at(12, 0))
+
+	if len(podsToDelete) != 1 || podsToDelete[0].Name != outdated.Name {
+		t.Fatalf("expected only %s to be deleted, got %v", outdated.Name, podsToDelete)
+	}
+
+	alice := session.Status.Clients["alice"]
+	if _, ok := alice.PodStatus[outdated.Name]; ok || len(alice.PodStatus) != 1 || alice.Ready {
+		t.Errorf("expected alice to be re-pointed to a new pod, got %+v", alice)
+	}
+
+	bob := session.Status.Clients["bob"]
+	if _, ok := bob.PodStatus[unhashed.Name]; !ok || !bob.Ready {
+		t.Errorf("expected bob to keep the pod without hash, got %+v", bob)
+	}
+
+	if len(session.Status.OutdatedPods) != 0 {
+		t.Errorf("expected no outdated pod to be reported, got %v", session.Status.OutdatedPods)
+	}
+}
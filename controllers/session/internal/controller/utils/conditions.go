@@ -28,6 +28,9 @@ const PODS_NOT_READY_MESSAGE = "At least one session pod presents the ready cont
 const PODS_RECONCILED_REASON = "PodsHaveBeenReconciled"
 const PODS_RECONCILED_MESSAGE = "Pods have been reconciled successfully"
 
+const PODS_UPGRADING_REASON = "SessionPodsUpgrading"
+const PODS_UPGRADING_MESSAGE = "Session pods running an outdated spec are being replaced"
+
 func SetReadyCondition(
 	session *telepresencev1alpha1.Session,
 	status metav1.ConditionStatus,
@@ -77,3 +80,13 @@ func appendCondition(
 
 	session.Status.SessionPods.Conditions = append(session.Status.SessionPods.Conditions, condition)
 }
+
+const (
+	TYPE_SYNCED ConditionType = "Synced"
+)
+
+const MEMBERS_SYNCED_REASON = "MembersSynced"
+const MEMBERS_SYNCED_MESSAGE = "The session has been propagated to every member cluster"
+
+const MEMBERS_NOT_SYNCED_REASON = "MembersNotSynced"
+const MEMBERS_NOT_SYNCED_MESSAGE = "The session could not be propagated to at least one member cluster"
@@ -0,0 +1,16 @@
+package utils
+
+// Reasons of the events recorded on the Sessions and FederatedSessions, shown by kubectl describe. The gc and network
+// controllers record theirs under the same names when they act on the same pods.
+
+const CLIENT_ALLOCATED_REASON = "ClientAllocated"
+const CLIENT_EXPIRED_REASON = "ClientExpired"
+
+const POD_SPAWNED_REASON = "PodSpawned"
+const POD_REUSED_REASON = "PodReused"
+const POD_REPLACED_REASON = "PodReplaced"
+const SPAWN_POD_FAILED_REASON = "FailedSpawnPod"
+
+const MEMBER_SESSION_CREATED_REASON = "MemberSessionCreated"
+const MEMBER_SESSION_DELETED_REASON = "MemberSessionDeleted"
+const SYNC_MEMBER_FAILED_REASON = "FailedSyncMemberSession"
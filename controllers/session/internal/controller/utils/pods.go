@@ -2,6 +2,9 @@ package utils
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -21,6 +24,36 @@ func ExtractReadyConditionStatusFromPod(pod *corev1.Pod) corev1.ConditionStatus
 	return corev1.ConditionStatus("")
 }
 
+// RoutedAnnotation is set by the network controller once the pod service and ingress paths are published.
+const RoutedAnnotation = "mr.telepresence/routed"
+
+func PodIsRouted(pod *corev1.Pod) bool {
+	return pod.Annotations[RoutedAnnotation] == "true"
+}
+
+// TemplateHashAnnotation holds the hash of the template spec a pod was spawned from. Running pod specs are defaulted
+// by the API server, so they are compared with the templates through this hash.
+const TemplateHashAnnotation = "mr.telepresence/template-hash"
+
+func HashPodSpec(spec *corev1.PodSpec) string {
+	byteArray, _ := json.Marshal(*spec)
+	hasher := sha256.New()
+	hasher.Write(byteArray)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// PodIsOutdated tells whether a pod was spawned from another spec than the given template spec. The spec of the pods
+// spawned before the hash annotation existed is unknown, they are not reported as outdated.
+func PodIsOutdated(pod *corev1.Pod, spec *corev1.PodSpec) bool {
+	hash, ok := pod.Annotations[TemplateHashAnnotation]
+	return ok && hash != HashPodSpec(spec)
+}
+
+func PodHasTemplateHash(pod *corev1.Pod) bool {
+	_, ok := pod.Annotations[TemplateHashAnnotation]
+	return ok
+}
+
 func PodsAreReady(podList *corev1.PodList) bool {
 	for _, pod := range podList.Items {
 		status := ExtractReadyConditionStatusFromPod(&pod)
@@ -28,6 +61,10 @@ func PodsAreReady(podList *corev1.PodList) bool {
 		if status != "" && (status == corev1.ConditionFalse || status == corev1.ConditionUnknown) {
 			return false
 		}
+
+		if !PodIsRouted(&pod) {
+			return false
+		}
 	}
 
 	return true
@@ -46,6 +83,16 @@ func SpawnPod(
 	pod.Labels["svc"] = pod.Name
 	pod.Namespace = "default"
 
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string)
+	}
+	pod.Annotations[TemplateHashAnnotation] = HashPodSpec(&pod.Spec)
+
+	// the network controller links the routing of the pod to the request that led to its spawn
+	if traceParent, ok := session.Annotations[telepresencev1alpha1.TraceParentAnnotation]; ok {
+		pod.Annotations[telepresencev1alpha1.TraceParentAnnotation] = traceParent
+	}
+
 	// set controller reference for garbage collection
 	if err := ctrl.SetControllerReference(session, pod, scheme); err != nil {
 		logger.Error(err, "unable to set controller reference for pod", "session", session.Name, "pod", pod.Name)
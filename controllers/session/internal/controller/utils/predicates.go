@@ -2,6 +2,7 @@ package utils
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 )
@@ -14,6 +15,13 @@ func SessionUpdateFunc(e event.UpdateEvent) bool {
 		return true
 	}
 
+	// the session was rolled onto another template version
+	if !equality.Semantic.DeepEqual(oldObj.Spec.SessionPodTemplates, newObj.Spec.SessionPodTemplates) ||
+		!equality.Semantic.DeepEqual(oldObj.Spec.ClientPodTemplates, newObj.Spec.ClientPodTemplates) ||
+		!equality.Semantic.DeepEqual(oldObj.Spec.Upgrade, newObj.Spec.Upgrade) {
+		return true
+	}
+
 	for specClient, connected := range newObj.Spec.Clients {
 		if v, ok := oldObj.Spec.Clients[specClient]; ok {
 			if v != connected {
@@ -31,5 +39,6 @@ func PodUpdateFunc(e event.UpdateEvent) bool {
 	oldObj := e.ObjectOld.(*corev1.Pod)
 	newObj := e.ObjectNew.(*corev1.Pod)
 
-	return ExtractReadyConditionStatusFromPod(oldObj) != ExtractReadyConditionStatusFromPod(newObj)
+	return ExtractReadyConditionStatusFromPod(oldObj) != ExtractReadyConditionStatusFromPod(newObj) ||
+		PodIsRouted(oldObj) != PodIsRouted(newObj)
 }
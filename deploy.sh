@@ -23,6 +23,9 @@ for ctx in ${context_list[@]}; do
             --set controller.service.externalTrafficPolicy=Local \
             --kube-context "$ctx"
 
+    kubectl create configmap ping-server-config --from-literal=CLUSTER_NAME="$ctx" --dry-run=client -o yaml \
+     | kubectl apply -f - --kubeconfig "$kubeconfig" --context "$ctx"
+
     kubectl wait --namespace ingress-nginx --for=condition=Ready pod --selector=app.kubernetes.io/component=controller \
       --timeout=120s --kubeconfig "$kubeconfig" --context "$ctx"
 
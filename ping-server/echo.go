@@ -0,0 +1,32 @@
+package main
+
+import (
+	"time"
+
+	"mr.telepresence/ping-server/packet"
+)
+
+// echo builds the answer to a received payload. Versioned requests get a reply carrying the cluster name and the
+// server timestamps, unversioned payloads are echoed back verbatim to stay compatible with plain UDP echo clients.
+// Neither is larger than the payload, so the server cannot be used to amplify spoofed traffic.
+func echo(data []byte, receivedAt time.Time, clusterName string) ([]byte, bool) {
+	if !packet.IsVersioned(data) {
+		reply := make([]byte, len(data))
+		copy(reply, data)
+		return reply, true
+	}
+
+	request, err := packet.UnmarshalRequest(data)
+	if err != nil {
+		return nil, false
+	}
+
+	reply := packet.Reply{
+		Sequence:          request.Sequence,
+		ClientSendTime:    request.ClientSendTime,
+		ServerReceiveTime: receivedAt.UnixNano(),
+		ServerSendTime:    time.Now().UnixNano(),
+		ClusterName:       clusterName,
+	}
+	return reply.MarshalWithin(len(data)), true
+}
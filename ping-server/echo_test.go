@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"mr.telepresence/ping-server/packet"
+)
+
+// Replies are never larger than the requests, whatever the length of the cluster name
+func TestEchoDoesNotAmplify(t *testing.T) {
+	request := (&packet.Request{Sequence: 3, ClientSendTime: 10}).Marshal()
+	clusterName := strings.Repeat("c", packet.MaxClusterNameLength)
+
+	tests := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{"padded request", request, true},
+		{"request of the minimum size", request[:packet.MinRequestSize], true},
+		{"unpadded request", request[:14], false},
+		{"legacy payload", []byte("ping"), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reply, ok := echo(test.data, time.Now(), clusterName)
+			if ok != test.valid {
+				t.Fatalf("expected valid to be %t, got %t", test.valid, ok)
+			}
+			if len(reply) > len(test.data) {
+				t.Errorf("the %d bytes reply is larger than the %d bytes request", len(reply), len(test.data))
+			}
+		})
+	}
+}
+
+func TestEchoReply(t *testing.T) {
+	receivedAt := time.Unix(0, 500)
+
+	data, ok := echo((&packet.Request{Sequence: 3, ClientSendTime: 10}).Marshal(), receivedAt, "edge-1")
+	if !ok {
+		t.Fatal("expected the request to be answered")
+	}
+
+	reply, err := packet.UnmarshalReply(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Sequence != 3 || reply.ClientSendTime != 10 || reply.ServerReceiveTime != 500 ||
+		reply.ClusterName != "edge-1" {
+		t.Errorf("unexpected reply %+v", *reply)
+	}
+
+	if legacy, _ := echo([]byte("ping"), receivedAt, "edge-1"); !bytes.Equal(legacy, []byte("ping")) {
+		t.Errorf("expected the legacy payload to be echoed verbatim, got %q", legacy)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"mr.telepresence/ping-server/packet"
+)
+
+func main() {
+	var udpAddr, wsAddr, metricsAddr, clusterName string
+
+	flag.StringVar(&udpAddr, "udp-bind-address", ":8080", "The address the UDP echo server binds to.")
+	flag.StringVar(&wsAddr, "ws-bind-address", "", "The address the WebSocket echo server binds to. "+
+		"Leave empty to disable it.")
+	flag.StringVar(&metricsAddr, "metrics-bind-address", ":9090", "The address the metrics endpoint binds to.")
+	flag.StringVar(&clusterName, "cluster-name", os.Getenv("CLUSTER_NAME"), "The cluster name sent in replies.")
+	flag.Parse()
+
+	go serveMetrics(metricsAddr)
+
+	if wsAddr != "" {
+		go serveWebSocket(wsAddr, clusterName)
+	}
+
+	if err := serveUDP(udpAddr, clusterName); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func serveUDP(addr string, clusterName string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	log.Println("udp echo server listening on", addr)
+	buffer := make([]byte, 1500)
+
+	for {
+		n, remote, err := conn.ReadFrom(buffer)
+		if err != nil {
+			log.Println("unable to read packet", err.Error())
+			continue
+		}
+		receivedAt := time.Now()
+
+		reply, ok := echo(buffer[:n], receivedAt, clusterName)
+		if !ok {
+			invalidPacketsTotal.WithLabelValues("udp").Inc()
+			continue
+		}
+
+		if _, err := conn.WriteTo(reply, remote); err != nil {
+			log.Println("unable to write packet", err.Error())
+			continue
+		}
+		echoesTotal.WithLabelValues("udp", packetVersion(buffer[:n])).Inc()
+	}
+}
+
+var upgrader = websocket.Upgrader{
+	// headsets connect from arbitrary origins, the payload carries no credentials
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func serveWebSocket(addr string, clusterName string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", webSocketEcho(clusterName))
+
+	log.Println("websocket echo server listening on", addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+// webSocketEcho echoes every message of a connection. Messages larger than the requests clients build are not
+// buffered: the connection is closed with a message too big close frame.
+func webSocketEcho(clusterName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println("unable to upgrade connection", err.Error())
+			return
+		}
+		defer conn.Close()
+
+		conn.SetReadLimit(packet.RequestSize)
+
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil && errors.Is(err, websocket.ErrReadLimit) {
+				invalidPacketsTotal.WithLabelValues("websocket").Inc()
+				return
+
+			} else if err != nil {
+				return
+			}
+			receivedAt := time.Now()
+
+			reply, ok := echo(data, receivedAt, clusterName)
+			if !ok {
+				invalidPacketsTotal.WithLabelValues("websocket").Inc()
+				continue
+			}
+
+			if err := conn.WriteMessage(messageType, reply); err != nil {
+				return
+			}
+			echoesTotal.WithLabelValues("websocket", packetVersion(data)).Inc()
+		}
+	}
+}
+
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	log.Println("metrics server listening on", addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
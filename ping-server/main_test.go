@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"mr.telepresence/ping-server/packet"
+)
+
+// Requests are echoed, and messages larger than a request close the connection instead of being buffered
+func TestWebSocketEchoReadLimit(t *testing.T) {
+	server := httptest.NewServer(webSocketEcho("edge"))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	request := (&packet.Request{Sequence: 1, ClientSendTime: 10}).Marshal()
+	if err := conn.WriteMessage(websocket.BinaryMessage, request); err != nil {
+		t.Fatal(err)
+	}
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := packet.UnmarshalReply(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Sequence != 1 || reply.ClusterName != "edge" {
+		t.Errorf("unexpected reply %+v", reply)
+	}
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, packet.RequestSize+1)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("expected the connection to be closed with a message too big close frame, got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"mr.telepresence/ping-server/packet"
+)
+
+var (
+	echoesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ping_server_echoes_total",
+		Help: "Number of packets echoed, by transport and packet version.",
+	}, []string{"transport", "version"})
+
+	invalidPacketsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ping_server_invalid_packets_total",
+		Help: "Number of packets dropped because they could not be decoded, by transport.",
+	}, []string{"transport"})
+)
+
+func init() {
+	prometheus.MustRegister(echoesTotal, invalidPacketsTotal)
+}
+
+func packetVersion(data []byte) string {
+	if packet.IsVersioned(data) {
+		return strconv.Itoa(int(data[0]))
+	}
+	return "legacy"
+}
@@ -0,0 +1,129 @@
+// Package packet defines the wire format shared by the ping server and its clients.
+//
+// Version 1 packets are big endian and laid out as follows:
+//
+//	request: version(1) type(1) sequence(4) clientSendTime(8) padding
+//	reply:   version(1) type(1) sequence(4) clientSendTime(8) serverReceiveTime(8) serverSendTime(8)
+//	         clusterNameLength(1) clusterName(clusterNameLength)
+//
+// Timestamps are unix nanoseconds. clientSendTime is echoed back untouched so clients can compute the RTT with their
+// own clock, while the server timestamps allow them to subtract the server processing time.
+//
+// The server is reachable by anyone over UDP, so a reply is never larger than its request: requests are padded to at
+// least MinRequestSize bytes, and the cluster name is truncated to fit in the size of the request. Request.Marshal
+// pads to RequestSize, which leaves room for a cluster name of the maximum length.
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+const (
+	Version1 byte = 1
+
+	TypeRequest byte = 1
+	TypeReply   byte = 2
+
+	MaxClusterNameLength = 255
+
+	requestHeaderSize = 14
+	replyBaseSize     = 31
+
+	// MinRequestSize is the size of a reply without cluster name, smaller requests are dropped
+	MinRequestSize = replyBaseSize
+	// RequestSize is the size of the requests built by Request.Marshal
+	RequestSize = replyBaseSize + MaxClusterNameLength
+)
+
+var ErrInvalidPacket = errors.New("invalid packet")
+
+type Request struct {
+	Sequence       uint32
+	ClientSendTime int64
+}
+
+type Reply struct {
+	Sequence          uint32
+	ClientSendTime    int64
+	ServerReceiveTime int64
+	ServerSendTime    int64
+	ClusterName       string
+}
+
+// IsVersioned reports whether data starts like a packet of a known version.
+// Anything else is treated as a legacy payload and echoed back verbatim.
+func IsVersioned(data []byte) bool {
+	return len(data) > 0 && data[0] == Version1
+}
+
+func (r *Request) Marshal() []byte {
+	data := make([]byte, RequestSize)
+	data[0] = Version1
+	data[1] = TypeRequest
+	binary.BigEndian.PutUint32(data[2:6], r.Sequence)
+	binary.BigEndian.PutUint64(data[6:14], uint64(r.ClientSendTime))
+	return data
+}
+
+func UnmarshalRequest(data []byte) (*Request, error) {
+	if len(data) < MinRequestSize || data[0] != Version1 || data[1] != TypeRequest {
+		return nil, ErrInvalidPacket
+	}
+
+	return &Request{
+		Sequence:       binary.BigEndian.Uint32(data[2:6]),
+		ClientSendTime: int64(binary.BigEndian.Uint64(data[6:14])),
+	}, nil
+}
+
+func (r *Reply) Marshal() []byte {
+	return r.MarshalWithin(RequestSize)
+}
+
+// MarshalWithin marshals the reply in at most size bytes, truncating the cluster name to fit. size must be at least
+// MinRequestSize.
+func (r *Reply) MarshalWithin(size int) []byte {
+	clusterName := r.ClusterName
+	if maxLength := min(size-replyBaseSize, MaxClusterNameLength); len(clusterName) > maxLength {
+		clusterName = clusterName[:maxLength]
+	}
+
+	data := make([]byte, replyBaseSize+len(clusterName))
+	data[0] = Version1
+	data[1] = TypeReply
+	binary.BigEndian.PutUint32(data[2:6], r.Sequence)
+	binary.BigEndian.PutUint64(data[6:14], uint64(r.ClientSendTime))
+	binary.BigEndian.PutUint64(data[14:22], uint64(r.ServerReceiveTime))
+	binary.BigEndian.PutUint64(data[22:30], uint64(r.ServerSendTime))
+	data[30] = byte(len(clusterName))
+	copy(data[31:], clusterName)
+	return data
+}
+
+func UnmarshalReply(data []byte) (*Reply, error) {
+	if len(data) < replyBaseSize || data[0] != Version1 || data[1] != TypeReply {
+		return nil, ErrInvalidPacket
+	}
+
+	nameLength := int(data[30])
+	if len(data) < replyBaseSize+nameLength {
+		return nil, ErrInvalidPacket
+	}
+
+	return &Reply{
+		Sequence:          binary.BigEndian.Uint32(data[2:6]),
+		ClientSendTime:    int64(binary.BigEndian.Uint64(data[6:14])),
+		ServerReceiveTime: int64(binary.BigEndian.Uint64(data[14:22])),
+		ServerSendTime:    int64(binary.BigEndian.Uint64(data[22:30])),
+		ClusterName:       string(data[31 : 31+nameLength]),
+	}, nil
+}
+
+// RTT returns the round trip time of a reply received at receivedAt, excluding the time spent in the server
+func (r *Reply) RTT(receivedAt time.Time) time.Duration {
+	total := receivedAt.UnixNano() - r.ClientSendTime
+	processing := r.ServerSendTime - r.ServerReceiveTime
+	return time.Duration(total - processing)
+}
@@ -0,0 +1,141 @@
+package packet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestRoundTrip(t *testing.T) {
+	request := Request{Sequence: 42, ClientSendTime: time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC).UnixNano()}
+
+	data := request.Marshal()
+	if len(data) != RequestSize {
+		t.Fatalf("expected the request to be padded to %d bytes, got %d", RequestSize, len(data))
+	}
+	if !IsVersioned(data) {
+		t.Fatal("expected the request to be versioned")
+	}
+
+	decoded, err := UnmarshalRequest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *decoded != request {
+		t.Errorf("expected %+v, got %+v", request, *decoded)
+	}
+}
+
+func TestUnmarshalInvalidRequest(t *testing.T) {
+	valid := (&Request{Sequence: 1, ClientSendTime: 1}).Marshal()
+
+	wrongVersion := append([]byte{}, valid...)
+	wrongVersion[0] = 2
+
+	wrongType := append([]byte{}, valid...)
+	wrongType[1] = TypeReply
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"truncated header", valid[:requestHeaderSize-1]},
+		{"unpadded", valid[:requestHeaderSize]},
+		{"padded below the reply size", valid[:MinRequestSize-1]},
+		{"wrong version", wrongVersion},
+		{"wrong type", wrongType},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := UnmarshalRequest(test.data); !errors.Is(err, ErrInvalidPacket) {
+				t.Errorf("expected %v, got %v", ErrInvalidPacket, err)
+			}
+		})
+	}
+
+	if _, err := UnmarshalRequest(valid[:MinRequestSize]); err != nil {
+		t.Errorf("expected a request of the minimum size to be valid, got %v", err)
+	}
+}
+
+func TestReplyRoundTrip(t *testing.T) {
+	maxName := strings.Repeat("c", MaxClusterNameLength)
+
+	tests := []struct {
+		name        string
+		clusterName string
+		size        int
+		expected    string
+	}{
+		{"short name", "edge-1", RequestSize, "edge-1"},
+		{"empty name", "", RequestSize, ""},
+		{"maximum length name", maxName, RequestSize, maxName},
+		{"name over the maximum length", maxName + "overflow", RequestSize, maxName},
+		{"name truncated to the request size", "edge-1", MinRequestSize + 4, "edge"},
+		{"request of the minimum size", "edge-1", MinRequestSize, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reply := Reply{
+				Sequence:          7,
+				ClientSendTime:    100,
+				ServerReceiveTime: 200,
+				ServerSendTime:    250,
+				ClusterName:       test.clusterName,
+			}
+
+			data := reply.MarshalWithin(test.size)
+			if len(data) > test.size {
+				t.Errorf("expected the reply to fit in %d bytes, got %d", test.size, len(data))
+			}
+
+			decoded, err := UnmarshalReply(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reply.ClusterName = test.expected
+			if *decoded != reply {
+				t.Errorf("expected %+v, got %+v", reply, *decoded)
+			}
+		})
+	}
+}
+
+func TestUnmarshalInvalidReply(t *testing.T) {
+	valid := (&Reply{Sequence: 1, ClusterName: "edge-1"}).Marshal()
+
+	wrongVersion := append([]byte{}, valid...)
+	wrongVersion[0] = 2
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated header", valid[:replyBaseSize-1]},
+		{"truncated cluster name", valid[:len(valid)-1]},
+		{"wrong version", wrongVersion},
+		{"request", (&Request{}).Marshal()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := UnmarshalReply(test.data); !errors.Is(err, ErrInvalidPacket) {
+				t.Errorf("expected %v, got %v", ErrInvalidPacket, err)
+			}
+		})
+	}
+}
+
+func TestRTT(t *testing.T) {
+	sentAt := time.Unix(0, 1_000)
+	reply := Reply{ClientSendTime: sentAt.UnixNano(), ServerReceiveTime: 5_000, ServerSendTime: 5_300}
+
+	if rtt := reply.RTT(sentAt.Add(2 * time.Microsecond)); rtt != 1700*time.Nanosecond {
+		t.Errorf("expected 1.7µs, got %s", rtt)
+	}
+}
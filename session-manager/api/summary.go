@@ -0,0 +1,34 @@
+package api
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+// SummarizeSession counts the clients of a session and derives its phase: ready once the session pods, if any, and
+// every connected client are ready
+func SummarizeSession(session *sessionv1alpha1.Session) SessionSummary {
+	summary := SessionSummary{Phase: SessionReady, Clients: len(session.Spec.Clients)}
+
+	if len(session.Spec.SessionPodTemplates.Items) != 0 &&
+		!meta.IsStatusConditionTrue(session.Status.SessionPods.Conditions, "Ready") {
+
+		summary.Phase = SessionPending
+	}
+
+	for clientId, connected := range session.Spec.Clients {
+		ready := session.Status.Clients[clientId].Ready
+
+		if connected {
+			summary.ConnectedClients++
+		}
+		if ready {
+			summary.ReadyClients++
+		}
+		if connected && !ready {
+			summary.Phase = SessionPending
+		}
+	}
+
+	return summary
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+type RegisterSessionBody struct {
+	TemplateName       string `json:"templateName" binding:"required"`
+	SessionPodsCluster string `json:"sessionPodsCluster" binding:"required"`
+	// TemplateVersion pins the session to a version of the template, the latest version is used when omitted
+	TemplateVersion int `json:"templateVersion" binding:"min=0"`
+	// Parameters holds the values of the template parameters, as strings, numbers or booleans
+	Parameters map[string]interface{} `json:"parameters"`
+	// SessionId names the session, a name is generated from the template name when omitted
+	SessionId string `json:"sessionId"`
+}
+
+type CreateClientBody struct {
+	ClientId string `json:"clientId" binding:"required"`
+	// Cluster may be omitted to let the session-manager place the client according to its placement policy
+	Cluster string `json:"cluster"`
+	// Latencies holds the RTT in milliseconds measured by the client against the ping server of each cluster
+	Latencies map[string]int `json:"latencies"`
+	// Queue asks to wait in the queue of the session rather than being rejected when the session is full or the
+	// cluster lacks capacity
+	Queue bool `json:"queue"`
+}
+
+type UpdateClientBody struct {
+	Connected *bool `json:"connected" binding:"required"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+	// Reason is only set when the request was rejected by a limit
+	Reason RejectionReason `json:"reason,omitempty"`
+}
+
+// RejectionReason tells which limit a request was rejected by. SessionFull is answered with 409 Conflict, the other
+// reasons with 429 Too Many Requests since they may clear up on their own.
+type RejectionReason string
+
+const (
+	// SessionFull sessions already hold the maxClients of their template
+	SessionFull RejectionReason = "SessionFull"
+	// TemplateQuotaExceeded templates already have their maxSessions sessions
+	TemplateQuotaExceeded RejectionReason = "TemplateQuotaExceeded"
+	// TenantQuotaExceeded tenants already have the sessions their limits allow
+	TenantQuotaExceeded RejectionReason = "TenantQuotaExceeded"
+	// InsufficientCapacity clusters do not have the allocatable resources left to run the pods of the client
+	InsufficientCapacity RejectionReason = "InsufficientCapacity"
+)
+
+type SessionLocation struct {
+	Session string `json:"session"`
+	URI     string `json:"uri"`
+	// Clusters holding a copy of the session
+	Clusters           []string `json:"clusters"`
+	SessionPodsCluster string   `json:"sessionPodsCluster,omitempty"`
+	// Divergent is true when the copies differ or a cluster is missing its copy
+	Divergent bool `json:"divergent"`
+	// Status is only set when includeStatus is requested
+	Status *SessionSummary `json:"status,omitempty"`
+}
+
+// ContinueHeader holds the token to pass as the continue query parameter to get the next page of a listing. It is
+// absent on the last page.
+const ContinueHeader = "X-Continue"
+
+// IdempotencyKeyHeader makes session and client creation safe to retry, a request repeated with the same key returns
+// the result of the first one instead of creating anything
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set to true on the responses of repeated requests
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+type SessionPhase string
+
+const (
+	// SessionPending sessions are waiting for their session pods or for a client to become ready
+	SessionPending SessionPhase = "Pending"
+	// SessionReady sessions have their session pods and every connected client ready
+	SessionReady SessionPhase = "Ready"
+)
+
+// ListSessionsQuery is bound from the query string of GET /v1/session
+type ListSessionsQuery struct {
+	Limit         int64        `form:"limit" binding:"min=0"`
+	Continue      string       `form:"continue"`
+	Template      string       `form:"template"`
+	LabelSelector string       `form:"labelSelector"`
+	Phase         SessionPhase `form:"phase" binding:"omitempty,oneof=Pending Ready"`
+	IncludeStatus bool         `form:"includeStatus"`
+}
+
+type SessionSummary struct {
+	Phase            SessionPhase `json:"phase"`
+	Clients          int          `json:"clients"`
+	ConnectedClients int          `json:"connectedClients"`
+	ReadyClients     int          `json:"readyClients"`
+}
+
+// ListClientsQuery is bound from the query string of GET /v1/session/:sessionId/client
+type ListClientsQuery struct {
+	Limit         int64  `form:"limit" binding:"min=0"`
+	Continue      string `form:"continue"`
+	IncludeStatus bool   `form:"includeStatus"`
+}
+
+// SessionPlacement tells where the copies of a session, its session pods and its clients live, and lists the
+// differences found between the copies
+type SessionPlacement struct {
+	Clusters           []string          `json:"clusters"`
+	MissingClusters    []string          `json:"missingClusters,omitempty"`
+	SessionPodsCluster string            `json:"sessionPodsCluster,omitempty"`
+	ClientClusters     map[string]string `json:"clientClusters"`
+	Divergences        []string          `json:"divergences,omitempty"`
+}
+
+// SessionView is a session aggregated from its copies in every cluster
+type SessionView struct {
+	sessionv1alpha1.Session
+	Placement SessionPlacement `json:"placement"`
+}
+
+// ClusterOutcome is the outcome of the creation of a session in a cluster. ClusterAlreadyExists is a failure, the
+// cluster holds a session of the same name that was not created by the same request.
+type ClusterOutcome string
+
+const (
+	ClusterCreated        ClusterOutcome = "created"
+	ClusterAlreadyExists  ClusterOutcome = "alreadyExists"
+	ClusterFailed         ClusterOutcome = "failed"
+	ClusterSkipped        ClusterOutcome = "skipped"
+	ClusterRolledBack     ClusterOutcome = "rolledBack"
+	ClusterRollbackFailed ClusterOutcome = "rollbackFailed"
+)
+
+type ClusterResult struct {
+	Outcome ClusterOutcome `json:"outcome"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// CreateSessionResponse reports the outcome of the creation in each cluster, Error is only set when it failed
+type CreateSessionResponse struct {
+	Session  string                   `json:"session"`
+	URI      string                   `json:"uri,omitempty"`
+	Clusters map[string]ClusterResult `json:"clusters"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+type ClientLocation struct {
+	Client string `json:"client"`
+	URI    string `json:"uri"`
+	// Status is only set when includeStatus is requested
+	Status *ClientSummary `json:"status,omitempty"`
+}
+
+type ClientSummary struct {
+	Connected bool `json:"connected"`
+	Ready     bool `json:"ready"`
+}
+
+type ClientSpec struct {
+	Connected bool `json:"connected"`
+}
+
+type ClientResponse struct {
+	Admission ClientAdmission              `json:"admission"`
+	Spec      ClientSpec                   `json:"spec"`
+	Status    sessionv1alpha1.ClientStatus `json:"status"`
+	// Queue is only set while the client waits to be admitted
+	Queue *ClientQueueStatus `json:"queue,omitempty"`
+}
+
+type ClientAdmission string
+
+const (
+	// ClientQueued clients wait in the queue of the session, they have no spec nor status yet
+	ClientQueued ClientAdmission = "Queued"
+	// ClientAdmitted clients joined the session
+	ClientAdmitted ClientAdmission = "Admitted"
+)
+
+// ClientQueueStatus is the place of a client in the queue of a session
+type ClientQueueStatus struct {
+	// Position is 1 for the next client to be admitted
+	Position int `json:"position"`
+	// Reason is the limit the client is waiting on
+	Reason RejectionReason `json:"reason"`
+	// ExpiresAt is when the client leaves the queue unless it polls again
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// PingServersResponse maps each configured cluster to the address of its ping server
+type PingServersResponse map[string]string
+
+type PingTransport string
+
+const (
+	PingTransportUDP       PingTransport = "udp"
+	PingTransportWebSocket PingTransport = "websocket"
+)
+
+// GetPingServersQuery is bound from the query string of GET /v1/ping
+type GetPingServersQuery struct {
+	Transport PingTransport `form:"transport" binding:"omitempty,oneof=udp websocket"`
+}
+
+type ClusterHealth struct {
+	Cluster string `json:"cluster"`
+	// Healthy is true when the API server is ready and the ingress has an external address
+	Healthy   bool `json:"healthy"`
+	APIServer bool `json:"apiServer"`
+	// IngressIP is the hostname of the ingress load balancer when it only reports one
+	IngressIP  string `json:"ingressIp,omitempty"`
+	PingServer string `json:"pingServer,omitempty"`
+	// PingServerWebSocket is only set when the ping server service exposes a ws port
+	PingServerWebSocket string    `json:"pingServerWebSocket,omitempty"`
+	Errors              []string  `json:"errors,omitempty"`
+	LastChecked         time.Time `json:"lastChecked"`
+	// Capacity is only tracked when enabled in the limits config
+	Capacity *ClusterCapacity `json:"capacity,omitempty"`
+}
+
+// ClusterCapacity sums the cpu and memory allocatable on the schedulable nodes of a cluster, and requested by its pods
+// that did not terminate
+type ClusterCapacity struct {
+	Allocatable corev1.ResourceList `json:"allocatable"`
+	Requested   corev1.ResourceList `json:"requested"`
+}
+
+type TemplateSource string
+
+const (
+	// TemplateResource templates are SessionTemplate resources in the main cluster, managed through the API
+	TemplateResource TemplateSource = "resource"
+	// TemplateFile templates are read from conf/templates.yaml and cannot be changed through the API
+	TemplateFile TemplateSource = "file"
+)
+
+type CreateTemplateBody struct {
+	Name string                              `json:"name" binding:"required"`
+	Spec sessionv1alpha1.SessionTemplateSpec `json:"spec"`
+}
+
+type UpdateTemplateBody struct {
+	Spec sessionv1alpha1.SessionTemplateSpec `json:"spec"`
+}
+
+type TemplateLocation struct {
+	Template string         `json:"template"`
+	URI      string         `json:"uri"`
+	Source   TemplateSource `json:"source"`
+}
+
+// GetTemplateQuery is bound from the query string of GET /v1/template/:templateName
+type GetTemplateQuery struct {
+	Version int `form:"version" binding:"min=0"`
+}
+
+type TemplateResponse struct {
+	Name          string                              `json:"name"`
+	Source        TemplateSource                      `json:"source"`
+	Version       int                                 `json:"version"`
+	LatestVersion int                                 `json:"latestVersion"`
+	Versions      []int                               `json:"versions"`
+	Spec          sessionv1alpha1.SessionTemplateSpec `json:"spec"`
+}
+
+// RolloutTemplateBody rolls the outdated sessions of a template onto its latest version, or only the listed ones
+type RolloutTemplateBody struct {
+	Sessions []string                        `json:"sessions"`
+	Upgrade  sessionv1alpha1.UpgradeStrategy `json:"upgrade"`
+}
+
+// SessionRollout reports the outcome of the rollout of one session, Error is only set when it failed
+type SessionRollout struct {
+	Session     string `json:"session"`
+	URI         string `json:"uri"`
+	FromVersion int    `json:"fromVersion"`
+	Version     int    `json:"version"`
+	Error       string `json:"error,omitempty"`
+}
+
+// OutdatedSession is a session created from a version of its template older than the latest one. Version is zero
+// for sessions created before templates were versioned.
+type OutdatedSession struct {
+	Session       string `json:"session"`
+	URI           string `json:"uri"`
+	Template      string `json:"template"`
+	Version       int    `json:"version"`
+	LatestVersion int    `json:"latestVersion"`
+}
+
+// ConfigResponse describes the config in use after a reload request, Reloaded is false when the files did not change
+type ConfigResponse struct {
+	Clusters  []string `json:"clusters"`
+	Templates []string `json:"templates"`
+	Reloaded  bool     `json:"reloaded"`
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"strings"
+)
+
+type apiKeyAuthenticator struct {
+	keys map[[sha256.Size]byte]Principal
+}
+
+func newAPIKeyAuthenticator(apiKeys []APIKeyConfig) (*apiKeyAuthenticator, error) {
+	keys := make(map[[sha256.Size]byte]Principal, len(apiKeys))
+
+	for _, apiKey := range apiKeys {
+		if apiKey.Key == "" {
+			return nil, errors.New("api key must not be empty")
+		}
+
+		if err := validateRole(apiKey.Role, apiKey.ClientId); err != nil {
+			return nil, err
+		}
+
+		if err := validateTenant(apiKey.Tenant); err != nil {
+			return nil, err
+		}
+
+		keys[sha256.Sum256([]byte(apiKey.Key))] = Principal{
+			Role:     apiKey.Role,
+			ClientId: apiKey.ClientId,
+			Tenant:   apiKey.Tenant,
+		}
+	}
+
+	return &apiKeyAuthenticator{keys: keys}, nil
+}
+
+func (a *apiKeyAuthenticator) Authenticate(header string) (*Principal, error) {
+	key, ok := strings.CutPrefix(header, "ApiKey ")
+	if !ok {
+		return nil, nil
+	}
+
+	// keys are compared by digest so the lookup does not leak the key length or prefix through timing
+	digest := sha256.Sum256([]byte(key))
+	for knownDigest, principal := range a.keys {
+		if subtle.ConstantTimeCompare(digest[:], knownDigest[:]) == 1 {
+			return &principal, nil
+		}
+	}
+
+	return nil, errors.New("invalid api key")
+}
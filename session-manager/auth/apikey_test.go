@@ -0,0 +1,64 @@
+package auth
+
+import "testing"
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	authenticator, err := newAPIKeyAuthenticator([]APIKeyConfig{
+		{Key: "backend-key", Role: BackendRole, Tenant: "acme"},
+		{Key: "headset-key", Role: ClientRole, ClientId: "headset-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		header    string
+		principal *Principal
+		err       bool
+	}{
+		{"backend key", "ApiKey backend-key", &Principal{Role: BackendRole, Tenant: "acme"}, false},
+		{"client key", "ApiKey headset-key", &Principal{Role: ClientRole, ClientId: "headset-1"}, false},
+		{"unknown key", "ApiKey other-key", nil, true},
+		{"key prefix", "ApiKey backend", nil, true},
+		{"empty key", "ApiKey ", nil, true},
+		{"other scheme", "Bearer backend-key", nil, false},
+		{"no header", "", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(test.header)
+
+			if (err != nil) != test.err {
+				t.Fatalf("expected error to be %t, got %v", test.err, err)
+			}
+			if (principal == nil) != (test.principal == nil) {
+				t.Fatalf("expected principal %+v, got %+v", test.principal, principal)
+			}
+			if principal != nil && *principal != *test.principal {
+				t.Errorf("expected principal %+v, got %+v", *test.principal, *principal)
+			}
+		})
+	}
+}
+
+func TestAPIKeyConfigValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiKey APIKeyConfig
+	}{
+		{"empty key", APIKeyConfig{Key: "", Role: BackendRole}},
+		{"unknown role", APIKeyConfig{Key: "key", Role: "admin"}},
+		{"client without client id", APIKeyConfig{Key: "key", Role: ClientRole}},
+		{"invalid tenant", APIKeyConfig{Key: "key", Role: BackendRole, Tenant: "not a label"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := newAPIKeyAuthenticator([]APIKeyConfig{test.apiKey}); err == nil {
+				t.Error("expected the config to be rejected")
+			}
+		})
+	}
+}
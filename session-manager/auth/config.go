@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+const authConfigPath = "conf/auth/auth.yaml"
+
+// authDisabledEnv must be set to true to run without the auth configuration, every request then being treated as
+// coming from a backend
+const authDisabledEnv = "AUTH_DISABLED"
+
+type Role string
+
+const (
+	// BackendRole is granted to application backends, which manage sessions and any of their clients
+	BackendRole Role = "backend"
+	// ClientRole is granted to headsets, which may only act on their own client id
+	ClientRole Role = "client"
+)
+
+type Config struct {
+	APIKeys []APIKeyConfig `json:"apiKeys"`
+	JWT     *JWTConfig     `json:"jwt"`
+}
+
+type APIKeyConfig struct {
+	Key      string `json:"key"`
+	Role     Role   `json:"role"`
+	ClientId string `json:"clientId"`
+	Tenant   string `json:"tenant"`
+}
+
+type JWTConfig struct {
+	JWKSFile      string `json:"jwksFile"`
+	Issuer        string `json:"issuer"`
+	Audience      string `json:"audience"`
+	RoleClaim     string `json:"roleClaim"`
+	ClientIdClaim string `json:"clientIdClaim"`
+	TenantClaim   string `json:"tenantClaim"`
+}
+
+type Principal struct {
+	Role     Role
+	ClientId string
+	// Tenant the sessions created by the principal count against, empty when it belongs to none
+	Tenant string
+}
+
+type Authenticator interface {
+	// Authenticate returns a nil principal and a nil error when the request carries no credentials it understands
+	Authenticate(header string) (*Principal, error)
+}
+
+// ConfigAuthenticators reads the auth configuration and builds the configured authenticators.
+// A missing configuration file is an error, unless authentication is disabled explicitly, in which case nil is
+// returned.
+func ConfigAuthenticators() ([]Authenticator, error) {
+	f, err := os.ReadFile(authConfigPath)
+	if err != nil && errors.Is(err, os.ErrNotExist) && os.Getenv(authDisabledEnv) == "true" {
+		slog.Warn("auth config not found and " + authDisabledEnv + " set, authentication is disabled")
+		return nil, nil
+
+	} else if err != nil && errors.Is(err, os.ErrNotExist) {
+		return nil, errors.New("auth config " + authConfigPath + " not found, set " + authDisabledEnv +
+			"=true to run without authentication")
+
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(f, &config); err != nil {
+		return nil, err
+	}
+
+	authenticators := []Authenticator{}
+
+	if len(config.APIKeys) > 0 {
+		authenticator, err := newAPIKeyAuthenticator(config.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+
+	if config.JWT != nil {
+		authenticator, err := newJWTAuthenticator(config.JWT)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+
+	if len(authenticators) == 0 {
+		return nil, errors.New("auth config does not define any api key or jwt settings")
+	}
+
+	return authenticators, nil
+}
+
+func validateRole(role Role, clientId string) error {
+	switch role {
+	case BackendRole:
+		return nil
+	case ClientRole:
+		if clientId == "" {
+			return errors.New("client role requires a client id")
+		}
+		return nil
+	default:
+		return errors.New("unknown role " + string(role))
+	}
+}
+
+// validateTenant checks that the tenant can be used as the value of the tenant label of sessions
+func validateTenant(tenant string) error {
+	if errs := validation.IsValidLabelValue(tenant); len(errs) != 0 {
+		return errors.New("invalid tenant " + tenant + ": " + strings.Join(errs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// inTempDir runs the test from an empty directory, holding the auth config when one is given
+func inTempDir(t *testing.T, config string) {
+	dir := t.TempDir()
+
+	if config != "" {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(authConfigPath)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, authConfigPath), []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func TestConfigAuthenticators(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         string
+		disabled       string
+		authenticators int
+		fails          bool
+	}{
+		{"missing config", "", "", 0, true},
+		{"missing config with authentication not disabled", "", "false", 0, true},
+		{"missing config with authentication disabled", "", "true", 0, false},
+		{"api keys", "apiKeys:\n  - key: backend-key\n    role: backend\n", "", 1, false},
+		{"config without authenticator", "apiKeys: []\n", "true", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inTempDir(t, test.config)
+			t.Setenv(authDisabledEnv, test.disabled)
+
+			authenticators, err := ConfigAuthenticators()
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %d authenticators", len(authenticators))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(authenticators) != test.authenticators {
+				t.Errorf("expected %d authenticators, got %d", test.authenticators, len(authenticators))
+			}
+		})
+	}
+}
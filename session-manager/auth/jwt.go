@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultRoleClaim     = "role"
+	defaultClientIdClaim = "clientId"
+	defaultTenantClaim   = "tenant"
+)
+
+type jwtAuthenticator struct {
+	keyfunc       jwt.Keyfunc
+	parser        *jwt.Parser
+	roleClaim     string
+	clientIdClaim string
+	tenantClaim   string
+}
+
+func newJWTAuthenticator(config *JWTConfig) (*jwtAuthenticator, error) {
+	var kf keyfunc.Keyfunc
+	var err error
+
+	if config.JWKSFile != "" {
+		var raw []byte
+		if raw, err = os.ReadFile(config.JWKSFile); err != nil {
+			return nil, err
+		}
+		kf, err = keyfunc.NewJWKSetJSON(raw)
+
+	} else if config.Issuer != "" {
+		var jwksURI string
+		if jwksURI, err = discoverJWKSURI(config.Issuer); err != nil {
+			return nil, err
+		}
+		kf, err = keyfunc.NewDefault([]string{jwksURI})
+
+	} else {
+		err = errors.New("jwt config requires a jwks file or an issuer")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	parserOptions := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if config.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(config.Audience))
+	}
+
+	authenticator := &jwtAuthenticator{
+		keyfunc:       kf.Keyfunc,
+		parser:        jwt.NewParser(parserOptions...),
+		roleClaim:     config.RoleClaim,
+		clientIdClaim: config.ClientIdClaim,
+		tenantClaim:   config.TenantClaim,
+	}
+
+	if authenticator.roleClaim == "" {
+		authenticator.roleClaim = defaultRoleClaim
+	}
+	if authenticator.clientIdClaim == "" {
+		authenticator.clientIdClaim = defaultClientIdClaim
+	}
+	if authenticator.tenantClaim == "" {
+		authenticator.tenantClaim = defaultTenantClaim
+	}
+
+	return authenticator, nil
+}
+
+func (a *jwtAuthenticator) Authenticate(header string) (*Principal, error) {
+	tokenString, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return nil, nil
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := a.parser.ParseWithClaims(tokenString, claims, a.keyfunc); err != nil {
+		return nil, err
+	}
+
+	role, _ := claims[a.roleClaim].(string)
+	clientId, _ := claims[a.clientIdClaim].(string)
+
+	tenant, _ := claims[a.tenantClaim].(string)
+
+	if err := validateRole(Role(role), clientId); err != nil {
+		return nil, err
+	}
+	if err := validateTenant(tenant); err != nil {
+		return nil, err
+	}
+
+	return &Principal{Role: Role(role), ClientId: clientId, Tenant: tenant}, nil
+}
+
+// ref: https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfig
+
+func discoverJWKSURI(issuer string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return "", err
+	}
+
+	if discovery.JWKSURI == "" {
+		return "", errors.New("issuer does not advertise a jwks_uri")
+	}
+
+	return discovery.JWKSURI, nil
+}
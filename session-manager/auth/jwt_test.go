@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://issuer.example"
+	testAudience = "session-manager"
+	testKeyId    = "test-key"
+)
+
+// newTestJWTAuthenticator returns an authenticator trusting a freshly generated RSA key, read from a JWKS file, and
+// the private key to sign tokens with
+func newTestJWTAuthenticator(t *testing.T) (*jwtAuthenticator, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testKeyId,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator, err := newJWTAuthenticator(&JWTConfig{
+		JWKSFile: jwksFile,
+		Issuer:   testIssuer,
+		Audience: testAudience,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return authenticator, key
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":      testIssuer,
+		"aud":      testAudience,
+		"exp":      time.Now().Add(time.Hour).Unix(),
+		"role":     string(ClientRole),
+		"clientId": "headset-1",
+		"tenant":   "acme",
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, claims jwt.MapClaims, key interface{}) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = testKeyId
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	authenticator, key := newTestJWTAuthenticator(t)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(name string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		principal *Principal
+	}{
+		{"valid", sign(t, jwt.SigningMethodRS256, validClaims(), key),
+			&Principal{Role: ClientRole, ClientId: "headset-1", Tenant: "acme"}},
+		{"backend", sign(t, jwt.SigningMethodRS256, with("role", string(BackendRole)), key),
+			&Principal{Role: BackendRole, ClientId: "headset-1", Tenant: "acme"}},
+		{"expired", sign(t, jwt.SigningMethodRS256, with("exp", time.Now().Add(-time.Minute).Unix()), key), nil},
+		{"without expiration", sign(t, jwt.SigningMethodRS256, with("exp", nil), key), nil},
+		{"wrong issuer", sign(t, jwt.SigningMethodRS256, with("iss", "https://other.example"), key), nil},
+		{"wrong audience", sign(t, jwt.SigningMethodRS256, with("aud", "other"), key), nil},
+		{"signed by another key", sign(t, jwt.SigningMethodRS256, validClaims(), otherKey), nil},
+		{"hmac with the public key", sign(t, jwt.SigningMethodHS256, validClaims(),
+			pemPublicKey(t, &key.PublicKey)), nil},
+		{"unsigned", sign(t, jwt.SigningMethodNone, validClaims(), jwt.UnsafeAllowNoneSignatureType), nil},
+		{"without role", sign(t, jwt.SigningMethodRS256, with("role", nil), key), nil},
+		{"unknown role", sign(t, jwt.SigningMethodRS256, with("role", "admin"), key), nil},
+		{"client without client id", sign(t, jwt.SigningMethodRS256, with("clientId", nil), key), nil},
+		{"invalid tenant", sign(t, jwt.SigningMethodRS256, with("tenant", "not a label"), key), nil},
+		{"malformed", "not-a-jwt", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal, err := authenticator.Authenticate("Bearer " + test.token)
+
+			if test.principal == nil {
+				if err == nil || principal != nil {
+					t.Fatalf("expected the token to be rejected, got %+v", principal)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *principal != *test.principal {
+				t.Errorf("expected principal %+v, got %+v", *test.principal, *principal)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticatorIgnoresOtherSchemes(t *testing.T) {
+	authenticator, _ := newTestJWTAuthenticator(t)
+
+	for _, header := range []string{"", "ApiKey key", "Basic dXNlcjpwYXNz"} {
+		if principal, err := authenticator.Authenticate(header); principal != nil || err != nil {
+			t.Errorf("%q: expected no principal and no error, got %+v, %v", header, principal, err)
+		}
+	}
+}
+
+// pemPublicKey returns the PEM encoded public key, the secret an attacker would sign an HMAC token with
+func pemPublicKey(t *testing.T, key *rsa.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
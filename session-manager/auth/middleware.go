@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"mr.telepresence/session-manager/api"
+)
+
+const principalKey = "principal"
+
+// Authenticate rejects requests that none of the authenticators accept.
+// With no authenticators configured every request is treated as coming from a backend.
+func Authenticate(authenticators []Authenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if len(authenticators) == 0 {
+			ctx.Set(principalKey, &Principal{Role: BackendRole})
+			ctx.Next()
+			return
+		}
+
+		header := ctx.GetHeader("Authorization")
+
+		for _, authenticator := range authenticators {
+			principal, err := authenticator.Authenticate(header)
+
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, api.ErrorResponse{Error: err.Error()})
+				return
+
+			} else if principal != nil {
+				ctx.Set(principalKey, principal)
+				ctx.Next()
+				return
+			}
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, api.ErrorResponse{Error: "missing credentials"})
+	}
+}
+
+// RequireRole only lets through principals holding one of the given roles
+func RequireRole(roles ...Role) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		principal := GetPrincipal(ctx)
+
+		for _, role := range roles {
+			if principal != nil && principal.Role == role {
+				ctx.Next()
+				return
+			}
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusForbidden, api.ErrorResponse{Error: "operation not allowed for this role"})
+	}
+}
+
+// RequireClientParam lets through backends and clients acting on the client id present in the path
+func RequireClientParam(param string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !CanActAsClient(ctx, ctx.Param(param)) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, api.ErrorResponse{Error: "operation not allowed for this client"})
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+func CanActAsClient(ctx *gin.Context, clientId string) bool {
+	principal := GetPrincipal(ctx)
+	if principal == nil {
+		return false
+	}
+
+	return principal.Role == BackendRole || (principal.Role == ClientRole && principal.ClientId == clientId)
+}
+
+func GetPrincipal(ctx *gin.Context) *Principal {
+	value, ok := ctx.Get(principalKey)
+	if !ok {
+		return nil
+	}
+
+	principal, _ := value.(*Principal)
+	return principal
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter(t *testing.T) *gin.Engine {
+	authenticator, err := newAPIKeyAuthenticator([]APIKeyConfig{
+		{Key: "backend-key", Role: BackendRole},
+		{Key: "headset-1-key", Role: ClientRole, ClientId: "headset-1"},
+		{Key: "headset-2-key", Role: ClientRole, ClientId: "headset-2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	group := router.Group("", Authenticate([]Authenticator{authenticator}))
+	group.POST("/session", RequireRole(BackendRole), ok)
+	group.GET("/session", ok)
+	group.PATCH("/session/:sessionId/client/:clientId", RequireClientParam("clientId"), ok)
+
+	return router
+}
+
+func TestAuthorization(t *testing.T) {
+	router := newTestRouter(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		code   int
+	}{
+		{"missing credentials", http.MethodGet, "/session", "", http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "/session", "ApiKey other-key", http.StatusUnauthorized},
+		{"any role", http.MethodGet, "/session", "ApiKey headset-1-key", http.StatusOK},
+		{"backend role as backend", http.MethodPost, "/session", "ApiKey backend-key", http.StatusOK},
+		{"backend role as client", http.MethodPost, "/session", "ApiKey headset-1-key", http.StatusForbidden},
+		{"backend acting on a client", http.MethodPatch, "/session/demo/client/headset-1", "ApiKey backend-key",
+			http.StatusOK},
+		{"client acting on itself", http.MethodPatch, "/session/demo/client/headset-1", "ApiKey headset-1-key",
+			http.StatusOK},
+		{"client acting on another client", http.MethodPatch, "/session/demo/client/headset-1",
+			"ApiKey headset-2-key", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.path, nil)
+			if test.header != "" {
+				request.Header.Set("Authorization", test.header)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.code {
+				t.Errorf("expected %d, got %d", test.code, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestCanActAsClient(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *Principal
+		clientId  string
+		allowed   bool
+	}{
+		{"no principal", nil, "headset-1", false},
+		{"backend", &Principal{Role: BackendRole}, "headset-1", true},
+		{"same client", &Principal{Role: ClientRole, ClientId: "headset-1"}, "headset-1", true},
+		{"other client", &Principal{Role: ClientRole, ClientId: "headset-2"}, "headset-1", false},
+		{"unknown role", &Principal{Role: "admin", ClientId: "headset-1"}, "headset-1", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if test.principal != nil {
+				ctx.Set(principalKey, test.principal)
+			}
+
+			if allowed := CanActAsClient(ctx, test.clientId); allowed != test.allowed {
+				t.Errorf("expected allowed to be %t, got %t", test.allowed, allowed)
+			}
+		})
+	}
+}
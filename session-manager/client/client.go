@@ -0,0 +1,474 @@
+// Package client is a typed Go client for the session-manager REST API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"mr.telepresence/session-manager/api"
+)
+
+// Interface is implemented by Client and by the in-memory fake in the fake package
+type Interface interface {
+	CreateSession(ctx context.Context, body api.RegisterSessionBody) (*api.CreateSessionResponse, error)
+	GetSessions(ctx context.Context) ([]api.SessionLocation, error)
+	ListSessions(ctx context.Context, query api.ListSessionsQuery) ([]api.SessionLocation, string, error)
+	GetSession(ctx context.Context, sessionId string) (*api.SessionView, error)
+	DeleteSession(ctx context.Context, sessionId string) error
+
+	CreateClient(ctx context.Context, sessionId string, body api.CreateClientBody) error
+	QueueClient(ctx context.Context, sessionId string, body api.CreateClientBody) (*api.ClientResponse, error)
+	GetClients(ctx context.Context, sessionId string) ([]api.ClientLocation, error)
+	ListClients(ctx context.Context, sessionId string, query api.ListClientsQuery) ([]api.ClientLocation, string, error)
+	GetClient(ctx context.Context, sessionId string, clientId string) (*api.ClientResponse, error)
+	UpdateClient(ctx context.Context, sessionId string, clientId string, body api.UpdateClientBody) error
+	DeleteClient(ctx context.Context, sessionId string, clientId string) error
+	Heartbeat(ctx context.Context, sessionId string, clientId string) error
+
+	CreateTemplate(ctx context.Context, body api.CreateTemplateBody) error
+	GetTemplates(ctx context.Context) ([]api.TemplateLocation, error)
+	GetTemplate(ctx context.Context, templateName string) (*api.TemplateResponse, error)
+	GetTemplateVersion(ctx context.Context, templateName string, version int) (*api.TemplateResponse, error)
+	GetOutdatedSessions(ctx context.Context, templateName string) ([]api.OutdatedSession, error)
+	RolloutTemplate(ctx context.Context, templateName string, body api.RolloutTemplateBody) ([]api.SessionRollout, error)
+	UpdateTemplate(ctx context.Context, templateName string, body api.UpdateTemplateBody) error
+	DeleteTemplate(ctx context.Context, templateName string) error
+
+	GetPingServers(ctx context.Context) (api.PingServersResponse, error)
+	GetWebSocketPingServers(ctx context.Context) (api.PingServersResponse, error)
+	GetClusters(ctx context.Context) ([]api.ClusterHealth, error)
+	ReloadConfig(ctx context.Context) (*api.ConfigResponse, error)
+}
+
+// Error is returned for every non 2xx response
+type Error struct {
+	StatusCode int
+	Message    string
+	// Reason is only set when the request was rejected by a limit
+	Reason api.RejectionReason
+	Body   []byte
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("session-manager: %d %s", e.StatusCode, e.Message)
+}
+
+func IsNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+func IsConflict(err error) bool {
+	return statusCode(err) == http.StatusConflict
+}
+
+// IsTooManyRequests reports a request rejected by a quota or by the capacity of a cluster, which may be retried later
+func IsTooManyRequests(err error) bool {
+	return statusCode(err) == http.StatusTooManyRequests
+}
+
+// RejectionReason returns the limit a request was rejected by, empty for any other error
+func RejectionReason(err error) api.RejectionReason {
+	if e, ok := err.(*Error); ok {
+		return e.Reason
+	}
+	return ""
+}
+
+func statusCode(err error) int {
+	if e, ok := err.(*Error); ok {
+		return e.StatusCode
+	}
+	return 0
+}
+
+type Client struct {
+	baseURL       string
+	httpClient    *http.Client
+	authorization string
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.authorization = "ApiKey " + key }
+}
+
+func WithBearerToken(token string) Option {
+	return func(c *Client) { c.authorization = "Bearer " + token }
+}
+
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey returns a context whose session and client creations send key as their Idempotency-Key, so they
+// can be retried without creating anything twice
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// IdempotencyKey returns the key set by WithIdempotencyKey, empty when there is none
+func IdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyContextKey{}).(string)
+	return key
+}
+
+// New builds a client for the API rooted at baseURL, e.g. https://host/session-manager/v1
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: http.DefaultClient}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+var _ Interface = &Client{}
+
+// CreateSession returns a *Error whose Body holds an api.CreateSessionResponse when the creation was rolled back. It is
+// safe to retry when ctx carries an idempotency key, see WithIdempotencyKey.
+func (c *Client) CreateSession(
+	ctx context.Context,
+	body api.RegisterSessionBody,
+) (*api.CreateSessionResponse, error) {
+
+	var response api.CreateSessionResponse
+	if err := c.do(ctx, http.MethodPost, "/session", body, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *Client) GetSessions(ctx context.Context) ([]api.SessionLocation, error) {
+	var locations []api.SessionLocation
+	if err := c.do(ctx, http.MethodGet, "/session", nil, &locations); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+// ListSessions returns a page of sessions and the continue token of the next page, empty on the last page
+func (c *Client) ListSessions(
+	ctx context.Context,
+	query api.ListSessionsQuery,
+) ([]api.SessionLocation, string, error) {
+
+	values := listValues(query.Limit, query.Continue, query.IncludeStatus)
+	setValue(values, "template", query.Template)
+	setValue(values, "labelSelector", query.LabelSelector)
+	setValue(values, "phase", string(query.Phase))
+
+	var locations []api.SessionLocation
+	header, err := c.send(ctx, http.MethodGet, withQuery("/session", values), nil, &locations)
+	if err != nil {
+		return nil, "", err
+	}
+	return locations, header.Get(api.ContinueHeader), nil
+}
+
+func (c *Client) GetSession(ctx context.Context, sessionId string) (*api.SessionView, error) {
+	var session api.SessionView
+	if err := c.do(ctx, http.MethodGet, sessionPath(sessionId), nil, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (c *Client) DeleteSession(ctx context.Context, sessionId string) error {
+	return c.do(ctx, http.MethodDelete, sessionPath(sessionId), nil, nil)
+}
+
+func (c *Client) CreateClient(ctx context.Context, sessionId string, body api.CreateClientBody) error {
+	return c.do(ctx, http.MethodPost, sessionPath(sessionId)+"/client", body, nil)
+}
+
+// QueueClient joins the session, or waits in its queue when it is full or the cluster lacks capacity. Queued clients
+// keep their place by polling GetClient, which reports them as admitted once they joined.
+func (c *Client) QueueClient(
+	ctx context.Context,
+	sessionId string,
+	body api.CreateClientBody,
+) (*api.ClientResponse, error) {
+
+	body.Queue = true
+
+	var response api.ClientResponse
+	if err := c.do(ctx, http.MethodPost, sessionPath(sessionId)+"/client", body, &response); err != nil {
+		return nil, err
+	}
+
+	// admitted clients are answered without a body
+	if response.Admission == "" {
+		response.Admission = api.ClientAdmitted
+	}
+	return &response, nil
+}
+
+func (c *Client) GetClients(ctx context.Context, sessionId string) ([]api.ClientLocation, error) {
+	var locations []api.ClientLocation
+	if err := c.do(ctx, http.MethodGet, sessionPath(sessionId)+"/client", nil, &locations); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+// ListClients returns a page of the clients of a session and the continue token of the next page, empty on the
+// last page
+func (c *Client) ListClients(
+	ctx context.Context,
+	sessionId string,
+	query api.ListClientsQuery,
+) ([]api.ClientLocation, string, error) {
+
+	values := listValues(query.Limit, query.Continue, query.IncludeStatus)
+
+	var locations []api.ClientLocation
+	header, err := c.send(ctx, http.MethodGet, withQuery(sessionPath(sessionId)+"/client", values), nil, &locations)
+	if err != nil {
+		return nil, "", err
+	}
+	return locations, header.Get(api.ContinueHeader), nil
+}
+
+func (c *Client) GetClient(ctx context.Context, sessionId string, clientId string) (*api.ClientResponse, error) {
+	var client api.ClientResponse
+	if err := c.do(ctx, http.MethodGet, clientPath(sessionId, clientId), nil, &client); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (c *Client) UpdateClient(
+	ctx context.Context,
+	sessionId string,
+	clientId string,
+	body api.UpdateClientBody,
+) error {
+	return c.do(ctx, http.MethodPatch, clientPath(sessionId, clientId), body, nil)
+}
+
+func (c *Client) DeleteClient(ctx context.Context, sessionId string, clientId string) error {
+	return c.do(ctx, http.MethodDelete, clientPath(sessionId, clientId), nil, nil)
+}
+
+func (c *Client) Heartbeat(ctx context.Context, sessionId string, clientId string) error {
+	return c.do(ctx, http.MethodPost, clientPath(sessionId, clientId)+"/heartbeat", nil, nil)
+}
+
+func (c *Client) CreateTemplate(ctx context.Context, body api.CreateTemplateBody) error {
+	return c.do(ctx, http.MethodPost, "/template", body, nil)
+}
+
+func (c *Client) GetTemplates(ctx context.Context) ([]api.TemplateLocation, error) {
+	var locations []api.TemplateLocation
+	if err := c.do(ctx, http.MethodGet, "/template", nil, &locations); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+func (c *Client) GetTemplate(ctx context.Context, templateName string) (*api.TemplateResponse, error) {
+	var template api.TemplateResponse
+	if err := c.do(ctx, http.MethodGet, templatePath(templateName), nil, &template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (c *Client) GetTemplateVersion(
+	ctx context.Context,
+	templateName string,
+	version int,
+) (*api.TemplateResponse, error) {
+
+	values := url.Values{}
+	values.Set("version", strconv.Itoa(version))
+
+	var template api.TemplateResponse
+	if err := c.do(ctx, http.MethodGet, withQuery(templatePath(templateName), values), nil, &template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (c *Client) GetOutdatedSessions(ctx context.Context, templateName string) ([]api.OutdatedSession, error) {
+	var sessions []api.OutdatedSession
+	if err := c.do(ctx, http.MethodGet, templatePath(templateName)+"/outdated", nil, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RolloutTemplate returns the outcome of each session. When one of them failed, the outcomes are in the Body of the
+// returned Error.
+func (c *Client) RolloutTemplate(
+	ctx context.Context,
+	templateName string,
+	body api.RolloutTemplateBody,
+) ([]api.SessionRollout, error) {
+
+	var rollouts []api.SessionRollout
+	if err := c.do(ctx, http.MethodPost, templatePath(templateName)+"/rollout", body, &rollouts); err != nil {
+		return nil, err
+	}
+	return rollouts, nil
+}
+
+func (c *Client) UpdateTemplate(ctx context.Context, templateName string, body api.UpdateTemplateBody) error {
+	return c.do(ctx, http.MethodPut, templatePath(templateName), body, nil)
+}
+
+func (c *Client) DeleteTemplate(ctx context.Context, templateName string) error {
+	return c.do(ctx, http.MethodDelete, templatePath(templateName), nil, nil)
+}
+
+func (c *Client) GetPingServers(ctx context.Context) (api.PingServersResponse, error) {
+	var pingServers api.PingServersResponse
+	if err := c.do(ctx, http.MethodGet, "/ping", nil, &pingServers); err != nil {
+		return nil, err
+	}
+	return pingServers, nil
+}
+
+func (c *Client) GetWebSocketPingServers(ctx context.Context) (api.PingServersResponse, error) {
+	values := url.Values{}
+	values.Set("transport", string(api.PingTransportWebSocket))
+
+	var pingServers api.PingServersResponse
+	if err := c.do(ctx, http.MethodGet, withQuery("/ping", values), nil, &pingServers); err != nil {
+		return nil, err
+	}
+	return pingServers, nil
+}
+
+func (c *Client) GetClusters(ctx context.Context) ([]api.ClusterHealth, error) {
+	var clusters []api.ClusterHealth
+	if err := c.do(ctx, http.MethodGet, "/clusters", nil, &clusters); err != nil {
+		return nil, err
+	}
+	return clusters, nil
+}
+
+func (c *Client) ReloadConfig(ctx context.Context) (*api.ConfigResponse, error) {
+	var config api.ConfigResponse
+	if err := c.do(ctx, http.MethodPost, "/config/reload", nil, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func sessionPath(sessionId string) string {
+	return "/session/" + url.PathEscape(sessionId)
+}
+
+func templatePath(templateName string) string {
+	return "/template/" + url.PathEscape(templateName)
+}
+
+func clientPath(sessionId string, clientId string) string {
+	return sessionPath(sessionId) + "/client/" + url.PathEscape(clientId)
+}
+
+func listValues(limit int64, continueToken string, includeStatus bool) url.Values {
+	values := url.Values{}
+	if limit > 0 {
+		values.Set("limit", strconv.FormatInt(limit, 10))
+	}
+	setValue(values, "continue", continueToken)
+	if includeStatus {
+		values.Set("includeStatus", "true")
+	}
+	return values
+}
+
+func setValue(values url.Values, key string, value string) {
+	if value != "" {
+		values.Set(key, value)
+	}
+}
+
+func withQuery(path string, values url.Values) string {
+	if len(values) == 0 {
+		return path
+	}
+	return path + "?" + values.Encode()
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	_, err := c.send(ctx, method, path, body, result)
+	return err
+}
+
+// send performs the request and returns the response headers along with any error
+func (c *Client) send(
+	ctx context.Context,
+	method string,
+	path string,
+	body interface{},
+	result interface{},
+) (http.Header, error) {
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+	if key := IdempotencyKey(ctx); key != "" && method == http.MethodPost {
+		req.Header.Set(api.IdempotencyKeyHeader, key)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errorResponse api.ErrorResponse
+		if err := json.Unmarshal(data, &errorResponse); err != nil || errorResponse.Error == "" {
+			errorResponse.Error = http.StatusText(resp.StatusCode)
+		}
+		return nil, &Error{
+			StatusCode: resp.StatusCode,
+			Message:    errorResponse.Error,
+			Reason:     errorResponse.Reason,
+			Body:       data,
+		}
+	}
+
+	if result == nil || len(data) == 0 {
+		return resp.Header, nil
+	}
+
+	return resp.Header, json.Unmarshal(data, result)
+}
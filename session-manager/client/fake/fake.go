@@ -0,0 +1,761 @@
+// Package fake provides an in-memory implementation of the session-manager client for tests.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"mr.telepresence/session-manager/api"
+	"mr.telepresence/session-manager/client"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+// Client keeps sessions in memory and mimics the status codes returned by the session-manager.
+// Client readiness is not simulated, tests can set it through Sessions directly.
+type Client struct {
+	mu          sync.Mutex
+	counter     int
+	Sessions    map[string]*sessionv1alpha1.Session
+	PingServers api.PingServersResponse
+	// WebSocketPingServers are returned by GetWebSocketPingServers
+	WebSocketPingServers api.PingServersResponse
+	Clusters             []api.ClusterHealth
+	Templates            map[string]*api.TemplateResponse
+	// previous versions of the templates, replaced by UpdateTemplate
+	history map[string][]api.TemplateResponse
+	// session creations by idempotency key
+	requests map[string]idempotentRequest
+	// client joins made with an idempotency key, by session and client id
+	clientRequests map[string]idempotentClientRequest
+	// queued clients by session
+	queues map[string][]string
+}
+
+type idempotentRequest struct {
+	body     api.RegisterSessionBody
+	response api.CreateSessionResponse
+}
+
+type idempotentClientRequest struct {
+	key  string
+	body api.CreateClientBody
+}
+
+var _ client.Interface = &Client{}
+
+// TemplateLabel is set on the sessions created by the fake like the session-manager does, so they can be listed by
+// template
+const TemplateLabel = "mr.telepresence/template"
+
+// TemplateVersionLabel holds the template version of the sessions created by the fake, when the template is known
+const TemplateVersionLabel = "mr.telepresence/template-version"
+
+func NewClient() *Client {
+	return &Client{
+		Sessions:             make(map[string]*sessionv1alpha1.Session),
+		PingServers:          make(api.PingServersResponse),
+		WebSocketPingServers: make(api.PingServersResponse),
+		Templates:            make(map[string]*api.TemplateResponse),
+		history:              make(map[string][]api.TemplateResponse),
+		requests:             make(map[string]idempotentRequest),
+		clientRequests:       make(map[string]idempotentClientRequest),
+		queues:               make(map[string][]string),
+	}
+}
+
+// CreateSession returns the response of the first creation for a repeated idempotency key, and a conflict when the key
+// was used with another body or the sessionId is taken. The maxSessions of known templates is enforced, tenant quotas
+// are not simulated.
+func (f *Client) CreateSession(
+	ctx context.Context,
+	body api.RegisterSessionBody,
+) (*api.CreateSessionResponse, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := client.IdempotencyKey(ctx)
+	if request, ok := f.requests[key]; ok && key != "" {
+		if !reflect.DeepEqual(request.body, body) {
+			message := "session conflict: " + api.IdempotencyKeyHeader + " was already used with a different request"
+			return nil, &client.Error{StatusCode: http.StatusConflict, Message: message}
+		}
+
+		response := request.response
+		return &response, nil
+	}
+
+	sessionLabels := map[string]string{TemplateLabel: body.TemplateName}
+	maxClients := 0
+
+	if _, ok := f.Templates[body.TemplateName]; ok {
+		template, ok := f.templateVersion(body.TemplateName, body.TemplateVersion)
+		if !ok {
+			return nil, &client.Error{StatusCode: http.StatusBadRequest, Message: "template version not found"}
+		}
+		sessionLabels[TemplateVersionLabel] = strconv.Itoa(template.Version)
+
+		for _, parameter := range template.Spec.Parameters {
+			if _, ok := body.Parameters[parameter.Name]; !ok && parameter.Default == nil {
+				message := "invalid template parameters: missing required parameter " + parameter.Name
+				return nil, &client.Error{StatusCode: http.StatusBadRequest, Message: message}
+			}
+		}
+
+		if template.Spec.MaxSessions > 0 && f.countTemplateSessions(body.TemplateName) >= template.Spec.MaxSessions {
+			return nil, &client.Error{
+				StatusCode: http.StatusTooManyRequests,
+				Message:    "template " + body.TemplateName + " already has its maximum number of sessions",
+				Reason:     api.TemplateQuotaExceeded,
+			}
+		}
+		maxClients = template.Spec.MaxClients
+	}
+
+	f.counter++
+	name := fmt.Sprintf("%s-%d", body.TemplateName, f.counter)
+	if body.SessionId != "" {
+		name = body.SessionId
+	}
+
+	if _, ok := f.Sessions[name]; ok {
+		message := "session conflict: session " + name + " already exists"
+		return nil, &client.Error{StatusCode: http.StatusConflict, Message: message}
+	}
+
+	f.Sessions[name] = &sessionv1alpha1.Session{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: sessionLabels},
+		Spec:       sessionv1alpha1.SessionSpec{Clients: make(map[string]bool), MaxClients: maxClients},
+		Status:     sessionv1alpha1.SessionStatus{Clients: make(map[string]sessionv1alpha1.ClientStatus)},
+	}
+
+	response := api.CreateSessionResponse{
+		Session:  name,
+		URI:      "/v1/session/" + name,
+		Clusters: map[string]api.ClusterResult{body.SessionPodsCluster: {Outcome: api.ClusterCreated}},
+	}
+
+	if key != "" {
+		f.requests[key] = idempotentRequest{body: body, response: response}
+	}
+
+	return &response, nil
+}
+
+func (f *Client) GetSessions(_ context.Context) ([]api.SessionLocation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := make([]string, 0, len(f.Sessions))
+	for name := range f.Sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	locations := []api.SessionLocation{}
+	for _, name := range names {
+		locations = append(locations, api.SessionLocation{
+			Session:  name,
+			URI:      "/v1/session/" + name,
+			Clusters: []string{},
+		})
+	}
+	return locations, nil
+}
+
+// GetSession does not simulate clusters, the placement of the returned session is always empty
+// ListSessions pages through the sessions in name order, the continue token being the last name returned
+func (f *Client) ListSessions(
+	_ context.Context,
+	query api.ListSessionsQuery,
+) ([]api.SessionLocation, string, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	selector, err := labels.Parse(query.LabelSelector)
+	if err != nil {
+		return nil, "", &client.Error{StatusCode: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	names := []string{}
+	for name, session := range f.Sessions {
+		if name <= query.Continue || !selector.Matches(labels.Set(session.Labels)) {
+			continue
+		}
+		if query.Template != "" && session.Labels[TemplateLabel] != query.Template {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	next := ""
+	if query.Limit > 0 && int64(len(names)) > query.Limit {
+		names = names[:query.Limit]
+		next = names[len(names)-1]
+	}
+
+	locations := []api.SessionLocation{}
+	for _, name := range names {
+		summary := api.SummarizeSession(f.Sessions[name])
+		if query.Phase != "" && summary.Phase != query.Phase {
+			continue
+		}
+
+		location := api.SessionLocation{Session: name, URI: "/v1/session/" + name, Clusters: []string{}}
+		if query.IncludeStatus {
+			location.Status = &summary
+		}
+		locations = append(locations, location)
+	}
+	return locations, next, nil
+}
+
+func (f *Client) GetSession(_ context.Context, sessionId string) (*api.SessionView, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	session, ok := f.Sessions[sessionId]
+	if !ok {
+		return nil, notFound("session not found")
+	}
+
+	return &api.SessionView{
+		Session:   *session.DeepCopy(),
+		Placement: api.SessionPlacement{Clusters: []string{}, ClientClusters: make(map[string]string)},
+	}, nil
+}
+
+func (f *Client) DeleteSession(_ context.Context, sessionId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.Sessions[sessionId]; !ok {
+		return notFound("session not found")
+	}
+	delete(f.Sessions, sessionId)
+	return nil
+}
+
+// CreateClient succeeds for an existing client when ctx carries an idempotency key, like a repeated request does.
+// The maxClients of the template is enforced, cluster capacity is not simulated.
+func (f *Client) CreateClient(ctx context.Context, sessionId string, body api.CreateClientBody) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	session, ok := f.Sessions[sessionId]
+	if !ok {
+		return notFound("session not found")
+	}
+
+	key := client.IdempotencyKey(ctx)
+	if _, ok := session.Spec.Clients[body.ClientId]; ok {
+		request, ok := f.clientRequests[sessionId+"/"+body.ClientId]
+		if !ok || key == "" || request.key != key {
+			return &client.Error{StatusCode: http.StatusConflict, Message: "client already exists"}
+		}
+
+		if !reflect.DeepEqual(request.body, body) {
+			message := "client already exists: " + api.IdempotencyKeyHeader +
+				" was already used with a different request"
+			return &client.Error{StatusCode: http.StatusConflict, Message: message}
+		}
+		return nil
+	}
+
+	if session.Spec.MaxClients > 0 && len(session.Spec.Clients) >= session.Spec.MaxClients {
+		return &client.Error{
+			StatusCode: http.StatusConflict,
+			Message:    "session " + sessionId + " already has its maximum number of clients",
+			Reason:     api.SessionFull,
+		}
+	}
+
+	session.Spec.Clients[body.ClientId] = true
+	session.Status.Clients[body.ClientId] = sessionv1alpha1.ClientStatus{}
+
+	if key != "" {
+		f.clientRequests[sessionId+"/"+body.ClientId] = idempotentClientRequest{key: key, body: body}
+	} else {
+		delete(f.clientRequests, sessionId+"/"+body.ClientId)
+	}
+	return nil
+}
+
+// QueueClient queues the client when the session is full, queued clients never expire
+func (f *Client) QueueClient(
+	ctx context.Context,
+	sessionId string,
+	body api.CreateClientBody,
+) (*api.ClientResponse, error) {
+
+	err := f.CreateClient(ctx, sessionId, body)
+	if client.RejectionReason(err) != api.SessionFull {
+		if err != nil {
+			return nil, err
+		}
+		return &api.ClientResponse{Admission: api.ClientAdmitted}, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.queuedClient(sessionId, body.ClientId); !ok {
+		f.queues[sessionId] = append(f.queues[sessionId], body.ClientId)
+	}
+
+	response, _ := f.queuedClient(sessionId, body.ClientId)
+	return response, nil
+}
+
+func (f *Client) queuedClient(sessionId string, clientId string) (*api.ClientResponse, bool) {
+	for i, queued := range f.queues[sessionId] {
+		if queued == clientId {
+			return &api.ClientResponse{
+				Admission: api.ClientQueued,
+				Queue:     &api.ClientQueueStatus{Position: i + 1, Reason: api.SessionFull},
+			}, true
+		}
+	}
+
+	return nil, false
+}
+
+func (f *Client) GetClients(_ context.Context, sessionId string) ([]api.ClientLocation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	session, ok := f.Sessions[sessionId]
+	if !ok {
+		return nil, notFound("session not found")
+	}
+
+	locations := []api.ClientLocation{}
+	for clientId := range session.Spec.Clients {
+		locations = append(locations, api.ClientLocation{
+			Client: clientId,
+			URI:    "/v1/session/" + sessionId + "/client/" + clientId,
+		})
+	}
+	return locations, nil
+}
+
+// ListClients pages through the clients in id order, the continue token being the last id returned
+func (f *Client) ListClients(
+	_ context.Context,
+	sessionId string,
+	query api.ListClientsQuery,
+) ([]api.ClientLocation, string, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	session, ok := f.Sessions[sessionId]
+	if !ok {
+		return nil, "", notFound("session not found")
+	}
+
+	clientIds := []string{}
+	for clientId := range session.Spec.Clients {
+		if clientId > query.Continue {
+			clientIds = append(clientIds, clientId)
+		}
+	}
+	sort.Strings(clientIds)
+
+	next := ""
+	if query.Limit > 0 && int64(len(clientIds)) > query.Limit {
+		clientIds = clientIds[:query.Limit]
+		next = clientIds[len(clientIds)-1]
+	}
+
+	locations := []api.ClientLocation{}
+	for _, clientId := range clientIds {
+		location := api.ClientLocation{Client: clientId, URI: "/v1/session/" + sessionId + "/client/" + clientId}
+		if query.IncludeStatus {
+			location.Status = &api.ClientSummary{
+				Connected: session.Spec.Clients[clientId],
+				Ready:     session.Status.Clients[clientId].Ready,
+			}
+		}
+		locations = append(locations, location)
+	}
+	return locations, next, nil
+}
+
+func (f *Client) GetClient(_ context.Context, sessionId string, clientId string) (*api.ClientResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if response, ok := f.queuedClient(sessionId, clientId); ok {
+		return response, nil
+	}
+
+	session, err := f.findSessionByClientId(sessionId, clientId)
+	if err != nil {
+		return nil, err
+	}
+
+	status := session.Status.Clients[clientId]
+	return &api.ClientResponse{
+		Admission: api.ClientAdmitted,
+		Spec:      api.ClientSpec{Connected: session.Spec.Clients[clientId]},
+		Status:    *status.DeepCopy(),
+	}, nil
+}
+
+func (f *Client) UpdateClient(_ context.Context, sessionId string, clientId string, body api.UpdateClientBody) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	session, err := f.findSessionByClientId(sessionId, clientId)
+	if err != nil {
+		return err
+	}
+
+	if body.Connected == nil {
+		return &client.Error{StatusCode: http.StatusBadRequest, Message: "connected is required"}
+	}
+
+	session.Spec.Clients[clientId] = *body.Connected
+	return nil
+}
+
+// DeleteClient admits the queued clients of the session the client leaves room for
+func (f *Client) DeleteClient(_ context.Context, sessionId string, clientId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	queue := f.queues[sessionId]
+	for i, queued := range queue {
+		if queued == clientId {
+			f.queues[sessionId] = append(queue[:i:i], queue[i+1:]...)
+			return nil
+		}
+	}
+
+	session, err := f.findSessionByClientId(sessionId, clientId)
+	if err != nil {
+		return err
+	}
+
+	delete(session.Spec.Clients, clientId)
+	delete(session.Status.Clients, clientId)
+	delete(f.clientRequests, sessionId+"/"+clientId)
+
+	for len(f.queues[sessionId]) != 0 && len(session.Spec.Clients) < session.Spec.MaxClients {
+		admitted := f.queues[sessionId][0]
+		f.queues[sessionId] = f.queues[sessionId][1:]
+
+		session.Spec.Clients[admitted] = true
+		session.Status.Clients[admitted] = sessionv1alpha1.ClientStatus{}
+	}
+	return nil
+}
+
+func (f *Client) Heartbeat(_ context.Context, sessionId string, clientId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	session, err := f.findSessionByClientId(sessionId, clientId)
+	if err != nil {
+		return err
+	}
+
+	session.Spec.Clients[clientId] = true
+	return nil
+}
+
+func (f *Client) CreateTemplate(_ context.Context, body api.CreateTemplateBody) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if template, ok := f.Templates[body.Name]; ok && template.Source == api.TemplateResource {
+		return &client.Error{StatusCode: http.StatusConflict, Message: "template already exists"}
+	}
+
+	f.Templates[body.Name] = &api.TemplateResponse{
+		Name:          body.Name,
+		Source:        api.TemplateResource,
+		Version:       1,
+		LatestVersion: 1,
+		Versions:      []int{1},
+		Spec:          *body.Spec.DeepCopy(),
+	}
+	delete(f.history, body.Name)
+	return nil
+}
+
+func (f *Client) GetTemplates(_ context.Context) ([]api.TemplateLocation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := make([]string, 0, len(f.Templates))
+	for name := range f.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	locations := []api.TemplateLocation{}
+	for _, name := range names {
+		locations = append(locations, api.TemplateLocation{
+			Template: name,
+			URI:      "/v1/template/" + name,
+			Source:   f.Templates[name].Source,
+		})
+	}
+	return locations, nil
+}
+
+func (f *Client) GetTemplate(ctx context.Context, templateName string) (*api.TemplateResponse, error) {
+	return f.GetTemplateVersion(ctx, templateName, 0)
+}
+
+func (f *Client) GetTemplateVersion(
+	_ context.Context,
+	templateName string,
+	version int,
+) (*api.TemplateResponse, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.Templates[templateName]; !ok {
+		return nil, notFound("template name not configured")
+	}
+
+	template, ok := f.templateVersion(templateName, version)
+	if !ok {
+		return nil, notFound("template version not found")
+	}
+
+	copied := *template
+	copied.Versions = append([]int{}, template.Versions...)
+	copied.Spec = *template.Spec.DeepCopy()
+	return &copied, nil
+}
+
+// GetOutdatedSessions compares the version label of the sessions with the latest version of the template, sessions
+// without the label count as version 0
+func (f *Client) GetOutdatedSessions(_ context.Context, templateName string) ([]api.OutdatedSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	template, ok := f.Templates[templateName]
+	if !ok {
+		return nil, notFound("template name not configured")
+	}
+
+	names := []string{}
+	for name, session := range f.Sessions {
+		if session.Labels[TemplateLabel] == templateName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	outdated := []api.OutdatedSession{}
+	for _, name := range names {
+		version, _ := strconv.Atoi(f.Sessions[name].Labels[TemplateVersionLabel])
+		if version >= template.Version {
+			continue
+		}
+
+		outdated = append(outdated, api.OutdatedSession{
+			Session:       name,
+			URI:           "/v1/session/" + name,
+			Template:      templateName,
+			Version:       version,
+			LatestVersion: template.Version,
+		})
+	}
+	return outdated, nil
+}
+
+// RolloutTemplate only moves the version label of the outdated sessions, their pods are not simulated
+func (f *Client) RolloutTemplate(
+	ctx context.Context,
+	templateName string,
+	body api.RolloutTemplateBody,
+) ([]api.SessionRollout, error) {
+
+	outdated, err := f.GetOutdatedSessions(ctx, templateName)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	selected := outdated
+	if len(body.Sessions) != 0 {
+		outdatedMap := make(map[string]api.OutdatedSession, len(outdated))
+		for _, session := range outdated {
+			outdatedMap[session.Session] = session
+		}
+
+		selected = []api.OutdatedSession{}
+		for _, name := range body.Sessions {
+			session, ok := outdatedMap[name]
+			if !ok {
+				message := fmt.Sprintf("session %s does not run an outdated version of the template", name)
+				return nil, &client.Error{StatusCode: http.StatusBadRequest, Message: message}
+			}
+			selected = append(selected, session)
+		}
+	}
+
+	rollouts := []api.SessionRollout{}
+	for _, session := range selected {
+		upgrade := body.Upgrade
+		f.Sessions[session.Session].Labels[TemplateVersionLabel] = strconv.Itoa(session.LatestVersion)
+		f.Sessions[session.Session].Spec.Upgrade = &upgrade
+
+		rollouts = append(rollouts, api.SessionRollout{
+			Session:     session.Session,
+			URI:         session.URI,
+			FromVersion: session.Version,
+			Version:     session.LatestVersion,
+		})
+	}
+	return rollouts, nil
+}
+
+func (f *Client) UpdateTemplate(_ context.Context, templateName string, body api.UpdateTemplateBody) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	template, ok := f.Templates[templateName]
+	if !ok || template.Source != api.TemplateResource {
+		return notFound("template not found")
+	}
+
+	if f.history == nil {
+		f.history = make(map[string][]api.TemplateResponse)
+	}
+	f.history[templateName] = append(f.history[templateName], *template)
+
+	template.Version++
+	template.LatestVersion = template.Version
+	template.Versions = append(append([]int{}, template.Versions...), template.Version)
+	template.Spec = *body.Spec.DeepCopy()
+	return nil
+}
+
+func (f *Client) DeleteTemplate(_ context.Context, templateName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	template, ok := f.Templates[templateName]
+	if !ok || template.Source != api.TemplateResource {
+		return notFound("template not found")
+	}
+
+	delete(f.Templates, templateName)
+	delete(f.history, templateName)
+	return nil
+}
+
+func (f *Client) GetPingServers(_ context.Context) (api.PingServersResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pingServers := make(api.PingServersResponse, len(f.PingServers))
+	for cluster, address := range f.PingServers {
+		pingServers[cluster] = address
+	}
+	return pingServers, nil
+}
+
+func (f *Client) GetWebSocketPingServers(_ context.Context) (api.PingServersResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pingServers := make(api.PingServersResponse, len(f.WebSocketPingServers))
+	for cluster, address := range f.WebSocketPingServers {
+		pingServers[cluster] = address
+	}
+	return pingServers, nil
+}
+
+func (f *Client) GetClusters(_ context.Context) ([]api.ClusterHealth, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]api.ClusterHealth{}, f.Clusters...), nil
+}
+
+// ReloadConfig reports the configured clusters and templates, the fake has no config files to reload
+func (f *Client) ReloadConfig(_ context.Context) (*api.ConfigResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	clusters := make([]string, 0, len(f.Clusters))
+	for _, cluster := range f.Clusters {
+		clusters = append(clusters, cluster.Cluster)
+	}
+	sort.Strings(clusters)
+
+	templates := make([]string, 0, len(f.Templates))
+	for name := range f.Templates {
+		templates = append(templates, name)
+	}
+	sort.Strings(templates)
+
+	return &api.ConfigResponse{Clusters: clusters, Templates: templates, Reloaded: false}, nil
+}
+
+func (f *Client) findSessionByClientId(sessionId string, clientId string) (*sessionv1alpha1.Session, error) {
+	session, ok := f.Sessions[sessionId]
+	if !ok {
+		return nil, notFound("session not found")
+	}
+
+	if _, ok := session.Spec.Clients[clientId]; !ok {
+		return nil, notFound("session not found")
+	}
+	return session, nil
+}
+
+func (f *Client) countTemplateSessions(templateName string) int {
+	count := 0
+
+	for _, session := range f.Sessions {
+		if session.Labels[TemplateLabel] == templateName {
+			count++
+		}
+	}
+
+	return count
+}
+
+// templateVersion returns the requested version of a known template, or its latest version when version is zero.
+// Previous versions report the latest version as LatestVersion.
+func (f *Client) templateVersion(templateName string, version int) (*api.TemplateResponse, bool) {
+	template := f.Templates[templateName]
+	if version == 0 || version == template.Version {
+		return template, true
+	}
+
+	for _, previous := range f.history[templateName] {
+		if previous.Version == version {
+			previous.LatestVersion = template.Version
+			previous.Versions = template.Versions
+			return &previous, true
+		}
+	}
+
+	return nil, false
+}
+
+func notFound(message string) error {
+	return &client.Error{StatusCode: http.StatusNotFound, Message: message}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	stdErrors "errors"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"mr.telepresence/session-manager/api"
+	k8sClient "mr.telepresence/session-manager/k8s-client"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+// findSessionCopies returns the copy of a session kept in each cluster. The session is only reported as not found
+// when no cluster holds it.
+func findSessionCopies(
+	ctx context.Context,
+	sessionId string,
+	clusterClientMap map[string]*k8sClient.SessionClient,
+) (map[string]*sessionv1alpha1.Session, error) {
+
+	sessionCopies := make(map[string]*sessionv1alpha1.Session, len(clusterClientMap))
+
+	for cluster, clusterClient := range clusterClientMap {
+		session, err := clusterClient.Sessions("default").Get(ctx, sessionId, metav1.GetOptions{})
+		if err != nil && errors.IsNotFound(err) {
+			continue
+
+		} else if err != nil {
+			return nil, err
+		}
+
+		sessionCopies[cluster] = session
+	}
+
+	if len(sessionCopies) == 0 {
+		return nil, stdErrors.New("session not found")
+	}
+
+	return sessionCopies, nil
+}
+
+func sortedClusters(sessionCopies map[string]*sessionv1alpha1.Session) []string {
+	clusters := make([]string, 0, len(sessionCopies))
+	for cluster := range sessionCopies {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+
+	return clusters
+}
+
+// referenceCluster returns the cluster whose copy holds the full spec: the session pods cluster, or the first
+// cluster in name order when the session has no session pods
+func referenceCluster(sessionCopies map[string]*sessionv1alpha1.Session) string {
+	clusters := sortedClusters(sessionCopies)
+
+	for _, cluster := range clusters {
+		if len(sessionCopies[cluster].Spec.SessionPodTemplates.Items) != 0 {
+			return cluster
+		}
+	}
+
+	return clusters[0]
+}
+
+// mergeSessions sums up the copies of a session kept in each cluster into a single view. The spec comes from the
+// reference copy along with its labels and annotations, and the spec and status of each client from the copy of the
+// cluster hosting it.
+func mergeSessions(sessionId string, sessionCopies map[string]*sessionv1alpha1.Session) *sessionv1alpha1.Session {
+	sessionSum := &sessionv1alpha1.Session{
+		ObjectMeta: metav1.ObjectMeta{Name: sessionId},
+		Spec: sessionv1alpha1.SessionSpec{
+			Clients: make(map[string]bool),
+		},
+		Status: sessionv1alpha1.SessionStatus{
+			SessionPods: sessionv1alpha1.SessionPodsStatus{
+				Conditions: []metav1.Condition{},
+				PodsStatus: map[string]sessionv1alpha1.PodStatus{},
+			},
+			Clients: make(map[string]sessionv1alpha1.ClientStatus),
+		},
+	}
+
+	if len(sessionCopies) == 0 {
+		return sessionSum
+	}
+
+	reference := sessionCopies[referenceCluster(sessionCopies)]
+	sessionSum.Labels = reference.Labels
+	sessionSum.Annotations = reference.Annotations
+	sessionSum.Spec.SessionPodTemplates = reference.Spec.SessionPodTemplates
+	sessionSum.Spec.ClientPodTemplates = reference.Spec.ClientPodTemplates
+	sessionSum.Spec.TimeoutSeconds = reference.Spec.TimeoutSeconds
+	sessionSum.Spec.ReutilizeTimeoutSeconds = reference.Spec.ReutilizeTimeoutSeconds
+	sessionSum.Spec.HeartbeatTimeoutSeconds = reference.Spec.HeartbeatTimeoutSeconds
+	sessionSum.Spec.MaxClients = reference.Spec.MaxClients
+	sessionSum.Spec.Upgrade = reference.Spec.Upgrade
+
+	if len(reference.Spec.SessionPodTemplates.Items) != 0 {
+		sessionSum.Status.SessionPods = reference.Status.SessionPods
+	}
+
+	for _, cluster := range sortedClusters(sessionCopies) {
+		session := sessionCopies[cluster]
+		sessionSum.Status.OutdatedPods = append(sessionSum.Status.OutdatedPods, session.Status.OutdatedPods...)
+
+		for specClient, connected := range session.Spec.Clients {
+			if _, ok := sessionSum.Spec.Clients[specClient]; ok {
+				continue
+			}
+
+			sessionSum.Spec.Clients[specClient] = connected
+			if status, ok := session.Status.Clients[specClient]; ok {
+				sessionSum.Status.Clients[specClient] = status
+			}
+		}
+	}
+
+	sort.Strings(sessionSum.Status.OutdatedPods)
+
+	return sessionSum
+}
+
+// sessionPlacement reports the clusters holding a copy of the session, the clusters hosting the session pods and
+// each client, and every difference found between the copies
+func sessionPlacement(
+	sessionCopies map[string]*sessionv1alpha1.Session,
+	configuredClusters []string,
+) api.SessionPlacement {
+
+	clusters := sortedClusters(sessionCopies)
+
+	placement := api.SessionPlacement{
+		Clusters:        clusters,
+		MissingClusters: []string{},
+		ClientClusters:  make(map[string]string),
+		Divergences:     []string{},
+	}
+
+	for _, cluster := range configuredClusters {
+		if _, ok := sessionCopies[cluster]; !ok {
+			placement.MissingClusters = append(placement.MissingClusters, cluster)
+			placement.Divergences = append(placement.Divergences, fmt.Sprintf("missing in cluster %s", cluster))
+		}
+	}
+	sort.Strings(placement.MissingClusters)
+
+	if len(clusters) == 0 {
+		return placement
+	}
+
+	sessionPodsClusters := []string{}
+	clientClusters := make(map[string][]string)
+
+	for _, cluster := range clusters {
+		session := sessionCopies[cluster]
+
+		if len(session.Spec.SessionPodTemplates.Items) != 0 {
+			sessionPodsClusters = append(sessionPodsClusters, cluster)
+		}
+
+		for client := range session.Spec.Clients {
+			clientClusters[client] = append(clientClusters[client], cluster)
+		}
+	}
+
+	if len(sessionPodsClusters) > 0 {
+		placement.SessionPodsCluster = sessionPodsClusters[0]
+	}
+	if len(sessionPodsClusters) > 1 {
+		placement.Divergences = append(placement.Divergences,
+			fmt.Sprintf("session pods templates in clusters %s", strings.Join(sessionPodsClusters, ", ")))
+	}
+
+	for client, hosts := range clientClusters {
+		placement.ClientClusters[client] = hosts[0]
+
+		if len(hosts) > 1 {
+			placement.Divergences = append(placement.Divergences,
+				fmt.Sprintf("client %s in clusters %s", client, strings.Join(hosts, ", ")))
+		}
+	}
+
+	referenceName := referenceCluster(sessionCopies)
+	reference := sessionCopies[referenceName]
+
+	for _, cluster := range clusters {
+		if cluster == referenceName {
+			continue
+		}
+
+		for _, field := range divergentFields(&reference.Spec, &sessionCopies[cluster].Spec) {
+			placement.Divergences = append(placement.Divergences,
+				fmt.Sprintf("%s differs between clusters %s and %s", field, referenceName, cluster))
+		}
+	}
+
+	sort.Strings(placement.Divergences)
+
+	return placement
+}
+
+// divergentFields lists the spec fields that are expected to be equal in every copy but are not
+func divergentFields(reference *sessionv1alpha1.SessionSpec, spec *sessionv1alpha1.SessionSpec) []string {
+	fields := []string{}
+
+	if reference.TimeoutSeconds != spec.TimeoutSeconds {
+		fields = append(fields, "timeoutSeconds")
+	}
+	if reference.ReutilizeTimeoutSeconds != spec.ReutilizeTimeoutSeconds {
+		fields = append(fields, "reutilizeTimeoutSeconds")
+	}
+	if reference.HeartbeatTimeoutSeconds != spec.HeartbeatTimeoutSeconds {
+		fields = append(fields, "heartbeatTimeoutSeconds")
+	}
+	if reference.MaxClients != spec.MaxClients {
+		fields = append(fields, "maxClients")
+	}
+	if !equality.Semantic.DeepEqual(reference.Upgrade, spec.Upgrade) {
+		fields = append(fields, "upgrade")
+	}
+	if !equality.Semantic.DeepEqual(reference.ClientPodTemplates, spec.ClientPodTemplates) {
+		fields = append(fields, "clientPodTemplates")
+	}
+
+	return fields
+}
+
+func (h *Handler) configuredClusters() []string {
+	clusters := make([]string, 0, len(h.clusterClientMap()))
+	for cluster := range h.clusterClientMap() {
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters
+}
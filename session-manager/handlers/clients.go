@@ -1,64 +1,227 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
 	"net/http"
+	"time"
 
 	stdErrors "errors"
 
 	"github.com/gin-gonic/gin"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"mr.telepresence/session-manager/api"
+	"mr.telepresence/session-manager/auth"
 	k8sClient "mr.telepresence/session-manager/k8s-client"
+	"mr.telepresence/session-manager/telemetry"
 	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
 )
 
+var errClientExists = stdErrors.New("client already exists")
+
+func errorIsClientExists(err error) bool {
+	return stdErrors.Is(err, errClientExists)
+}
+
+var errClusterNotConfigured = stdErrors.New("cluster not configured")
+
+func errorIsClusterNotConfigured(err error) bool {
+	return stdErrors.Is(err, errClusterNotConfigured)
+}
+
 func (h *Handler) CreateClient(ctx *gin.Context) {
-	var body CreateClientBody
+	var body api.CreateClientBody
 
 	if err := ctx.ShouldBindJSON(&body); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	clusterClient, ok := h.clusterClientMap[body.Cluster]
-	if !ok {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "cluster not configured"})
+	if !auth.CanActAsClient(ctx, body.ClientId) {
+		ctx.JSON(http.StatusForbidden, api.ErrorResponse{Error: "operation not allowed for this client"})
+		return
+	}
+
+	key, err := idempotencyKey(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Find session
 	sessionId := ctx.Param("sessionId")
-	session, err := clusterClient.Sessions("default").Get(ctx, sessionId, metav1.GetOptions{})
+	location := ctx.Request.URL.Path + "/" + body.ClientId
 
-	if err != nil && errors.IsNotFound(err) {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	// a queued client repeating its request polls its place in the queue
+	if queue, ok := h.waiting.poll(sessionId, body.ClientId, time.Now(), h.limits.queueTimeout()); ok {
+		ctx.Header("Location", location)
+		ctx.JSON(http.StatusAccepted, api.ClientResponse{Admission: api.ClientQueued, Queue: queue})
+		return
+	}
+
+	// a client is looked up in every cluster, so a retry placed in another cluster does not create it twice
+	occupancy, err := h.findSessionOccupancy(ctx.Request.Context(), sessionId)
+	if err != nil && errorIsSessionNotFound(err) {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
 		return
 
 	} else if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Check if client exists
-	if _, ok := session.Spec.Clients[body.ClientId]; ok {
-		ctx.JSON(http.StatusConflict, gin.H{"error": "client already exists"})
+	request, err := clientRequest(key, &body)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// a repeated request is one that sent the same idempotency key and body as the one that added the client
+	if _, ok := occupancy.clientClusters[body.ClientId]; ok {
+		if err := checkSameClientRequest(occupancy.clientRequests[body.ClientId], request); err != nil {
+			ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.Header(api.IdempotentReplayedHeader, "true")
+		ctx.JSON(http.StatusOK, nil)
+		return
+	}
+
+	cluster, err := h.admitClient(ctx.Request.Context(), sessionId, body, occupancy)
+
+	// room freed while clients are queued goes to them first
+	if reason, ok := h.waiting.waitingReason(sessionId); ok && err == nil {
+		err = reject(reason, "session %s has clients waiting to join", sessionId)
+	}
+
+	if err != nil && errorIsRejection(err) && body.Queue && queueable(err) {
+		now := time.Now()
+		if !h.waiting.enqueue(sessionId, body, request, rejectionReason(err), h.limits.MaxQueueLength, now) {
+			writeRejection(ctx, err)
+			return
+		}
+
+		queue, _ := h.waiting.poll(sessionId, body.ClientId, now, h.limits.queueTimeout())
+		ctx.Header("Location", location)
+		ctx.JSON(http.StatusAccepted, api.ClientResponse{Admission: api.ClientQueued, Queue: queue})
+		return
+
+	} else if err != nil && errorIsRejection(err) {
+		writeRejection(ctx, err)
+		return
+
+	} else if err != nil && (errorIsNoPlacement(err) || errorIsClusterNotConfigured(err)) {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+
+	} else if err != nil && errorIsClusterUnhealthy(err) {
+		ctx.JSON(http.StatusServiceUnavailable, api.ErrorResponse{Error: err.Error()})
+		return
+
+	} else if err != nil && errorIsSessionNotFound(err) {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
+		return
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Create client
-	session.Spec.Clients[body.ClientId] = true
-	patchSession(ctx, session, clusterClient, nil)
+	body.Cluster = cluster
+	telemetry.SetCluster(ctx.Request.Context(), cluster)
+	err = h.addClient(ctx.Request.Context(), sessionId, body, request)
+
+	if err != nil && errorIsClientExists(err) {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: err.Error()})
+
+	} else if err != nil && (errors.IsNotFound(err) || errorIsSessionNotFound(err)) {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+
+	} else {
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+// admitClient checks the limits of the session for a new client, and returns the cluster it is placed in
+func (h *Handler) admitClient(
+	ctx context.Context,
+	sessionId string,
+	body api.CreateClientBody,
+	occupancy *sessionOccupancy,
+) (string, error) {
+
+	if err := occupancy.checkSessionFull(); err != nil {
+		return "", err
+	}
+
+	cluster := body.Cluster
+	if cluster == "" {
+		var err error
+		if cluster, err = h.placeClient(ctx, sessionId, body.Latencies); err != nil {
+			return "", err
+		}
+	}
+
+	if _, ok := h.clusterClientMap()[cluster]; !ok {
+		return "", errClusterNotConfigured
+	}
+
+	// placed clusters are healthy already, an explicit one is only rejected when the probe found it unhealthy
+	if err := h.prober.checkHealthy(cluster); err != nil {
+		return "", err
+	}
+
+	if err := h.checkClusterCapacity(cluster, occupancy); err != nil {
+		return "", err
+	}
+
+	return cluster, nil
+}
+
+// addClient adds the client to the copy of the session in its cluster, or to the FederatedSession in federated mode,
+// along with the request it joined with
+func (h *Handler) addClient(ctx context.Context, sessionId string, body api.CreateClientBody, request string) error {
+	if h.federated {
+		return h.addFederatedClient(ctx, sessionId, body, request)
+	}
+
+	clusterClient, ok := h.clusterClientMap()[body.Cluster]
+	if !ok {
+		return errClusterNotConfigured
+	}
+
+	session, err := clusterClient.Sessions("default").Get(ctx, sessionId, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if _, ok := session.Spec.Clients[body.ClientId]; ok {
+		return errClientExists
+	}
+
+	// the patch only touches the entry of the client so concurrent joins do not overwrite each other
+	patchData, err := clientPatchData(ctx, body.ClientId, true, request)
+	if err != nil {
+		return err
+	}
+
+	_, err = clusterClient.Sessions("default").Patch(ctx, sessionId, types.MergePatchType, patchData,
+		metav1.PatchOptions{})
+	return err
 }
 
 func findSessionByClientId(
-	ctx *gin.Context,
+	ctx context.Context,
 	clusterClientMap map[string]*k8sClient.SessionClient,
 	sessionId string,
 	clientId string,
 ) (*k8sClient.SessionClient, *sessionv1alpha1.Session, error) {
 
-	for _, client := range clusterClientMap {
+	for cluster, client := range clusterClientMap {
 		session, err := client.Sessions("default").Get(ctx, sessionId, metav1.GetOptions{})
 
 		if err != nil && !errors.IsNotFound(err) {
@@ -66,6 +229,7 @@ func findSessionByClientId(
 
 		} else if err == nil {
 			if _, ok := session.Spec.Clients[clientId]; ok {
+				telemetry.SetCluster(ctx, cluster)
 				return client, session, nil
 			}
 		}
@@ -78,14 +242,24 @@ func errorIsSessionNotFound(err error) bool {
 	return err.Error() == "session not found"
 }
 
-func patchSession(ctx *gin.Context, session *sessionv1alpha1.Session, clusterClient *k8sClient.SessionClient, patchData []byte) {
-	_, err := clusterClient.Sessions("default").PatchClients(ctx, session.Name, session, patchData, metav1.PatchOptions{})
-
-	if err != nil && errors.IsNotFound(err) {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+func patchSession(
+	ctx *gin.Context,
+	clusterClient *k8sClient.SessionClient,
+	sessionId string,
+	pt types.PatchType,
+	patchData []byte,
+) {
+	// the request context rather than the gin one, which is reused for another request once the handler returns while
+	// the transport may still be watching it
+	sessions := clusterClient.Sessions("default")
+	_, err := sessions.Patch(ctx.Request.Context(), sessionId, pt, patchData, metav1.PatchOptions{})
+	err = clientPatchError(err)
+
+	if err != nil && (errors.IsNotFound(err) || errorIsSessionNotFound(err)) {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
 
 	} else if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
 
 	} else {
 		ctx.JSON(http.StatusOK, nil)
@@ -93,107 +267,133 @@ func patchSession(ctx *gin.Context, session *sessionv1alpha1.Session, clusterCli
 }
 
 func (h *Handler) GetClient(ctx *gin.Context) {
+	// polling keeps a queued client in the queue
+	queue, ok := h.waiting.poll(ctx.Param("sessionId"), ctx.Param("clientId"), time.Now(), h.limits.queueTimeout())
+	if ok {
+		ctx.JSON(http.StatusOK, api.ClientResponse{Admission: api.ClientQueued, Queue: queue})
+		return
+	}
+
+	if h.federated {
+		h.getFederatedClient(ctx)
+		return
+	}
+
 	// Find session
 	sessionId := ctx.Param("sessionId")
 	clientId := ctx.Param("clientId")
-	_, session, err := findSessionByClientId(ctx, h.clusterClientMap, sessionId, clientId)
+	_, session, err := findSessionByClientId(ctx.Request.Context(), h.clusterClientMap(), sessionId, clientId)
 
 	if err != nil && errorIsSessionNotFound(err) {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
 		return
 
 	} else if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	response := make(map[string]interface{})
-	response["spec"] = map[string]bool{"connected": session.Spec.Clients[clientId]}
-	response["status"] = session.Status.Clients[clientId]
-	ctx.JSON(http.StatusOK, response)
+	ctx.JSON(http.StatusOK, api.ClientResponse{
+		Admission: api.ClientAdmitted,
+		Spec:      api.ClientSpec{Connected: session.Spec.Clients[clientId]},
+		Status:    session.Status.Clients[clientId],
+	})
 }
 
 func (h *Handler) GetClients(ctx *gin.Context) {
-	clientsLocation := []map[string]string{}
+	if h.federated {
+		h.getFederatedClients(ctx)
+		return
+	}
 
 	// Find session
 	sessionId := ctx.Param("sessionId")
-	session, err := findSession(ctx, sessionId, h.clusterClientMap)
+	session, err := findSession(ctx, sessionId, h.clusterClientMap())
 
 	if err != nil && errorIsSessionNotFound(err) {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
 		return
 
 	} else if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	for client := range session.Spec.Clients {
-		location := make(map[string]string)
-		location["client"] = client
-		location["uri"] = ctx.Request.URL.Path + "/" + client
-		clientsLocation = append(clientsLocation, location)
-	}
-
-	ctx.JSON(http.StatusOK, clientsLocation)
+	renderClientsPage(ctx, session)
 }
 
 func (h *Handler) UpdateClient(ctx *gin.Context) {
-	var body UpdateClientBody
+	var body api.UpdateClientBody
 
 	if err := ctx.ShouldBindJSON(&body); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if h.federated {
+		h.updateFederatedClient(ctx, *body.Connected)
 		return
 	}
 
 	// Find session
 	sessionId := ctx.Param("sessionId")
 	clientId := ctx.Param("clientId")
-	clusterClient, session, err := findSessionByClientId(ctx, h.clusterClientMap, sessionId, clientId)
+	clusterClient, _, err := findSessionByClientId(ctx.Request.Context(), h.clusterClientMap(), sessionId, clientId)
 
 	if err != nil && errorIsSessionNotFound(err) {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
 		return
 
 	} else if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Update client
-	session.Spec.Clients[clientId] = *body.Connected
-	patchSession(ctx, session, clusterClient, nil)
+	// Update client, failing rather than adding it back when it was deleted since it was found
+	patchData, err := connectedPatchData(clientPath(clientId), *body.Connected)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	patchSession(ctx, clusterClient, sessionId, types.JSONPatchType, patchData)
 }
 
 func (h *Handler) DeleteClient(ctx *gin.Context) {
+	if h.waiting.leave(ctx.Param("sessionId"), ctx.Param("clientId")) {
+		ctx.JSON(http.StatusOK, nil)
+		return
+	}
+
+	// the client may leave room for the queued clients of the session
+	defer h.waiting.notify()
+
+	if h.federated {
+		h.deleteFederatedClient(ctx)
+		return
+	}
+
 	// Find session
 	sessionId := ctx.Param("sessionId")
 	clientId := ctx.Param("clientId")
-	clusterClient, session, err := findSessionByClientId(ctx, h.clusterClientMap, sessionId, clientId)
+	clusterClient, _, err := findSessionByClientId(ctx.Request.Context(), h.clusterClientMap(), sessionId, clientId)
 
 	if err != nil && errorIsSessionNotFound(err) {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
 		return
 
 	} else if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
 	// Delete client
-	patchData, err := json.Marshal(map[string]interface{}{
-		"spec": map[string]interface{}{
-			"clients": map[string]interface{}{
-				clientId: nil,
-			},
-		},
-	})
+	patchData, err := clientPatchData(ctx.Request.Context(), clientId, nil, "")
 
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	patchSession(ctx, session, clusterClient, patchData)
+	patchSession(ctx, clusterClient, sessionId, types.MergePatchType, patchData)
 }
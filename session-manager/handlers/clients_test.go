@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"mr.telepresence/session-manager/auth"
+	k8sClient "mr.telepresence/session-manager/k8s-client"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+const sessionsPath = "/apis/core.mr.telepresence/v1alpha1/namespaces/default/sessions/"
+
+// fakeAPIServer serves the sessions of a single namespace, applying merge and JSON patches like the API server does.
+// Reads are slowed down so that handlers writing back what they read would overwrite each other.
+// Lists are sorted by name, filtered by label selector and paginated, their continue token being the last name listed.
+// Sessions may be created, but not deleted.
+type fakeAPIServer struct {
+	mu       sync.Mutex
+	sessions map[string][]byte
+	version  int
+
+	// beforePatch is called with the lock held before a patch is applied
+	beforePatch func(sessions map[string][]byte)
+}
+
+func newFakeAPIServer(t *testing.T, sessions ...*sessionv1alpha1.Session) *fakeAPIServer {
+	server := &fakeAPIServer{sessions: make(map[string][]byte)}
+
+	for _, session := range sessions {
+		session.APIVersion = sessionv1alpha1.GroupVersion.String()
+		session.Kind = "Session"
+
+		data, err := json.Marshal(session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.sessions[session.Name] = data
+	}
+
+	return server
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, sessionsPath)
+
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Path+"/" == sessionsPath {
+			s.list(w, r)
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+
+		s.mu.Lock()
+		data, ok := s.sessions[name]
+		s.mu.Unlock()
+
+		if !ok {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, "session not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+
+	case http.MethodPatch:
+		patchData, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.beforePatch != nil {
+			s.beforePatch(s.sessions)
+		}
+
+		data, ok := s.sessions[name]
+		if !ok {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, "session not found")
+			return
+		}
+
+		patched, err := applyPatch(types.PatchType(r.Header.Get("Content-Type")), data, patchData)
+		if err != nil {
+			writeStatus(w, http.StatusUnprocessableEntity, metav1.StatusReasonInvalid, err.Error())
+			return
+		}
+
+		s.version++
+		patched, err = jsonpatch.MergePatch(patched,
+			[]byte(`{"metadata":{"resourceVersion":"`+strconv.Itoa(s.version)+`"}}`))
+		if err != nil {
+			writeStatus(w, http.StatusInternalServerError, metav1.StatusReasonInternalError, err.Error())
+			return
+		}
+
+		s.sessions[name] = patched
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(patched)
+
+	case http.MethodPost:
+		s.create(w, r)
+
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed, r.Method)
+	}
+}
+
+func (s *fakeAPIServer) create(w http.ResponseWriter, r *http.Request) {
+	session := &sessionv1alpha1.Session{}
+	if err := json.NewDecoder(r.Body).Decode(session); err != nil {
+		writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.Name]; ok {
+		writeStatus(w, http.StatusConflict, metav1.StatusReasonAlreadyExists, "session already exists")
+		return
+	}
+
+	s.version++
+	session.APIVersion = sessionv1alpha1.GroupVersion.String()
+	session.Kind = "Session"
+	session.ResourceVersion = strconv.Itoa(s.version)
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		writeStatus(w, http.StatusInternalServerError, metav1.StatusReasonInternalError, err.Error())
+		return
+	}
+	s.sessions[session.Name] = data
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(data)
+}
+
+func (s *fakeAPIServer) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	selector, err := labels.Parse(query.Get("labelSelector"))
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+		return
+	}
+
+	after, err := base64.RawURLEncoding.DecodeString(query.Get("continue"))
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, "continue key is not valid")
+		return
+	}
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.sessions))
+	for name := range s.sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := sessionv1alpha1.SessionList{
+		TypeMeta: metav1.TypeMeta{Kind: "SessionList", APIVersion: sessionv1alpha1.GroupVersion.String()},
+		Items:    []sessionv1alpha1.Session{},
+	}
+
+	for _, name := range names {
+		if name <= string(after) {
+			continue
+		}
+
+		session := sessionv1alpha1.Session{}
+		if err := json.Unmarshal(s.sessions[name], &session); err != nil {
+			writeStatus(w, http.StatusInternalServerError, metav1.StatusReasonInternalError, err.Error())
+			return
+		}
+		if !selector.Matches(labels.Set(session.Labels)) {
+			continue
+		}
+
+		if limit > 0 && len(list.Items) == limit {
+			list.Continue = base64.RawURLEncoding.EncodeToString([]byte(list.Items[limit-1].Name))
+			break
+		}
+		list.Items = append(list.Items, session)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+func (s *fakeAPIServer) session(t *testing.T, name string) *sessionv1alpha1.Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session := &sessionv1alpha1.Session{}
+	if err := json.Unmarshal(s.sessions[name], session); err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func applyPatch(pt types.PatchType, data []byte, patchData []byte) ([]byte, error) {
+	switch pt {
+	case types.MergePatchType:
+		return jsonpatch.MergePatch(data, patchData)
+
+	case types.JSONPatchType:
+		patch, err := jsonpatch.DecodePatch(patchData)
+		if err != nil {
+			return nil, err
+		}
+		return patch.Apply(data)
+
+	default:
+		return nil, fmt.Errorf("unsupported patch type %s", pt)
+	}
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Code:     int32(code),
+		Reason:   reason,
+		Message:  message,
+	})
+}
+
+func newTestClient(t *testing.T, apiServer *httptest.Server) *k8sClient.SessionClient {
+	if err := k8sClient.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := k8sClient.NewForConfig(&rest.Config{Host: apiServer.URL, QPS: 1000, Burst: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func newTestHandler(t *testing.T, apiServer *httptest.Server) *Handler {
+	client := newTestClient(t, apiServer)
+
+	handler := &Handler{
+		reloader:   &configReloader{},
+		heartbeats: newHeartbeatMonitor(),
+		waiting:    newWaitingRoom(),
+		limits:     &LimitsConfig{},
+		prober:     newClusterProber(),
+	}
+	handler.config.Store(&clusterConfig{
+		clusterClientMap: map[string]*k8sClient.SessionClient{mainCluster: client},
+	})
+
+	return handler
+}
+
+func newTestRouter(handler *Handler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(auth.Authenticate(nil))
+	router.POST("/session/:sessionId/client", handler.CreateClient)
+	router.PATCH("/session/:sessionId/client/:clientId", handler.UpdateClient)
+	router.DELETE("/session/:sessionId/client/:clientId", handler.DeleteClient)
+
+	return router
+}
+
+// serve returns the status code of the request, and an error when it is not 200
+func serve(router *gin.Engine, method string, path string, body interface{}) (int, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+
+	request := httptest.NewRequest(method, path, bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		return recorder.Code, fmt.Errorf("%s %s: %d %s", method, path, recorder.Code, recorder.Body.String())
+	}
+	return recorder.Code, nil
+}
+
+// Clients joining, disconnecting and leaving the same session concurrently must not overwrite each other's entries
+func TestConcurrentClientJoinLeave(t *testing.T) {
+	const clients = 20
+	const rounds = 5
+
+	fakeServer := newFakeAPIServer(t, &sessionv1alpha1.Session{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec:       sessionv1alpha1.SessionSpec{Clients: map[string]bool{}},
+	})
+	apiServer := httptest.NewServer(fakeServer)
+	defer apiServer.Close()
+
+	router := newTestRouter(newTestHandler(t, apiServer))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+
+		go func(clientId string, connected bool) {
+			defer wg.Done()
+
+			path := "/session/demo/client/" + clientId
+			join := map[string]interface{}{"clientId": clientId, "cluster": mainCluster}
+			disconnect := map[string]bool{"connected": false}
+
+			for round := 0; round < rounds; round++ {
+				if _, err := serve(router, http.MethodPost, "/session/demo/client", join); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := serve(router, http.MethodPatch, path, disconnect); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := serve(router, http.MethodDelete, path, nil); err != nil {
+					errs <- err
+					return
+				}
+			}
+
+			if _, err := serve(router, http.MethodPost, "/session/demo/client", join); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := serve(router, http.MethodPatch, path, map[string]bool{"connected": connected}); err != nil {
+				errs <- err
+			}
+		}(fmt.Sprintf("client-%d", i), i%2 == 0)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	session := fakeServer.session(t, "demo")
+	if len(session.Spec.Clients) != clients {
+		t.Errorf("expected %d clients, got %d: %v", clients, len(session.Spec.Clients), session.Spec.Clients)
+	}
+
+	for i := 0; i < clients; i++ {
+		clientId := fmt.Sprintf("client-%d", i)
+
+		connected, ok := session.Spec.Clients[clientId]
+		if !ok {
+			t.Errorf("client %s was lost", clientId)
+		} else if connected != (i%2 == 0) {
+			t.Errorf("client %s: expected connected to be %t", clientId, i%2 == 0)
+		}
+	}
+}
+
+// Updating a client removed after it was looked up must not add it back
+func TestUpdateRemovedClient(t *testing.T) {
+	fakeServer := newFakeAPIServer(t, &sessionv1alpha1.Session{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec:       sessionv1alpha1.SessionSpec{Clients: map[string]bool{"gone": true}},
+	})
+	apiServer := httptest.NewServer(fakeServer)
+	defer apiServer.Close()
+
+	router := newTestRouter(newTestHandler(t, apiServer))
+
+	// the client leaves between the lookup of the update and its patch
+	fakeServer.beforePatch = func(sessions map[string][]byte) {
+		removed, err := jsonpatch.MergePatch(sessions["demo"], []byte(`{"spec":{"clients":{"gone":null}}}`))
+		if err == nil {
+			sessions["demo"] = removed
+		}
+	}
+
+	code, _ := serve(router, http.MethodPatch, "/session/demo/client/gone", map[string]bool{"connected": false})
+	if code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", code)
+	}
+
+	if _, ok := fakeServer.session(t, "demo").Spec.Clients["gone"]; ok {
+		t.Error("the removed client was added back")
+	}
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"mr.telepresence/session-manager/api"
+	k8sClient "mr.telepresence/session-manager/k8s-client"
+	"mr.telepresence/session-manager/telemetry"
+)
+
+// conf/kubeconfig.yaml and conf/templates.yaml are polled and reloaded when they change, or on demand through
+// POST /v1/config/reload. A new config is fully built before it replaces the current one in a single swap, and an
+// invalid one is rejected while the current one keeps serving.
+
+const configPollInterval = 10 * time.Second
+
+// clusterConfig holds the cluster clients and file templates read from the conf directory
+type clusterConfig struct {
+	clusterClientMap    map[string]*k8sClient.SessionClient
+	clusterClientsetMap map[string]*kubernetes.Clientset
+	fileTemplates       map[string]*SessionTemplate
+
+	// hash of the files the config was built from
+	hash string
+}
+
+// configReloader serializes reloads and remembers the last rejected files, so they are not reported on every poll
+type configReloader struct {
+	mu           sync.Mutex
+	rejectedHash string
+}
+
+var errConfigUnchanged = errors.New("config unchanged")
+
+func readConfigFiles() ([]byte, []byte, string, error) {
+	kubeconfig, err := os.ReadFile(kubeConfigPath)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	templates, err := os.ReadFile(templatesPath)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	hasher := sha256.New()
+	hasher.Write(kubeconfig)
+	hasher.Write([]byte{0})
+	hasher.Write(templates)
+
+	return kubeconfig, templates, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func loadClusterConfig(federated bool) (*clusterConfig, error) {
+	kubeconfig, templates, hash, err := readConfigFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	return buildClusterConfig(kubeconfig, templates, hash, federated)
+}
+
+func buildClusterConfig(kubeconfig []byte, templates []byte, hash string, federated bool) (*clusterConfig, error) {
+	apiConfig, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterClientMap := make(map[string]*k8sClient.SessionClient, len(apiConfig.Contexts))
+	clusterClientsetMap := make(map[string]*kubernetes.Clientset, len(apiConfig.Contexts))
+
+	// config main cluster clients if in cluster mode
+	cfg, err := rest.InClusterConfig()
+	if err == nil {
+		telemetry.InstrumentConfig(cfg, mainCluster)
+
+		client, err := k8sClient.NewForConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		clientset, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		clusterClientMap[mainCluster] = client
+		clusterClientsetMap[mainCluster] = clientset
+	}
+
+	if err != nil {
+		slog.Info("not running in a cluster, the main cluster is read from the kubeconfig", "error", err.Error())
+	}
+
+	// config remaning cluster clients
+
+	if _, ok := clusterClientMap[mainCluster]; ok {
+		delete(apiConfig.Contexts, mainCluster)
+	}
+
+	for contextName := range apiConfig.Contexts {
+
+		slog.Info("configuring cluster", "cluster", contextName)
+		cfg, err := buildConfigWithContext(contextName, apiConfig)
+		if err != nil {
+			slog.Error("unable to configure cluster", "cluster", contextName, "error", err.Error())
+			return nil, err
+		}
+		telemetry.InstrumentConfig(cfg, contextName)
+
+		client, err := k8sClient.NewForConfig(cfg)
+		if err != nil {
+			slog.Error("unable to configure cluster", "cluster", contextName, "error", err.Error())
+			return nil, err
+		}
+
+		clientset, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			slog.Error("unable to configure cluster", "cluster", contextName, "error", err.Error())
+			return nil, err
+		}
+
+		clusterClientMap[contextName] = client
+		clusterClientsetMap[contextName] = clientset
+	}
+
+	if _, ok := clusterClientMap[mainCluster]; federated && !ok {
+		return nil, errors.New("federated mode requires the main cluster to be configured")
+	}
+
+	fileTemplates, err := parseTemplates(templates)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clusterConfig{
+		clusterClientMap:    clusterClientMap,
+		clusterClientsetMap: clusterClientsetMap,
+		fileTemplates:       fileTemplates,
+		hash:                hash,
+	}, nil
+}
+
+// reloadConfig swaps the current config for the one in the conf directory. It returns errConfigUnchanged when the
+// files did not change since the current config, or since they were last rejected when force is not set.
+func (h *Handler) reloadConfig(force bool) (*clusterConfig, error) {
+	h.reloader.mu.Lock()
+	defer h.reloader.mu.Unlock()
+
+	kubeconfig, templates, hash, err := readConfigFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	current := h.config.Load()
+	if hash == current.hash || (!force && hash == h.reloader.rejectedHash) {
+		return current, errConfigUnchanged
+	}
+
+	config, err := buildClusterConfig(kubeconfig, templates, hash, h.federated)
+	if err != nil {
+		h.reloader.rejectedHash = hash
+		return nil, err
+	}
+
+	h.config.Store(config)
+	h.reloader.rejectedHash = ""
+
+	// forget the health of the clusters that were removed
+	h.prober.retain(config.clusterClientsetMap)
+
+	slog.Info("config reloaded", "clusters", sortedKeys(config.clusterClientMap))
+	return config, nil
+}
+
+// WatchConfig periodically reloads the config when its files changed
+func (h *Handler) WatchConfig(ctx context.Context) {
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := h.reloadConfig(false); err != nil && !errors.Is(err, errConfigUnchanged) {
+			slog.Warn("config rejected, keeping the current one", "error", err.Error())
+		}
+	}
+}
+
+// ReloadConfig reloads the config right away, answering 400 with the error when the new config is invalid
+func (h *Handler) ReloadConfig(ctx *gin.Context) {
+	config, err := h.reloadConfig(true)
+	if err != nil && !errors.Is(err, errConfigUnchanged) {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	templates := make([]string, 0, len(config.fileTemplates))
+	for name := range config.fileTemplates {
+		templates = append(templates, name)
+	}
+	sort.Strings(templates)
+
+	ctx.JSON(http.StatusOK, api.ConfigResponse{
+		Clusters:  sortedKeys(config.clusterClientMap),
+		Templates: templates,
+		Reloaded:  err == nil,
+	})
+}
+
+func sortedKeys(clusterClientMap map[string]*k8sClient.SessionClient) []string {
+	clusters := make([]string, 0, len(clusterClientMap))
+	for cluster := range clusterClientMap {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+
+	return clusters
+}
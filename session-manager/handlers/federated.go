@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	stdErrors "errors"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"mr.telepresence/session-manager/api"
+	k8sClient "mr.telepresence/session-manager/k8s-client"
+	"mr.telepresence/session-manager/telemetry"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+// In federated mode the session-manager only reads and writes FederatedSessions in the main cluster, the
+// federatedsession controller propagates them to the member clusters and aggregates their statuses back.
+
+func (h *Handler) federatedSessions() k8sClient.FederatedSessionInterface {
+	return h.clusterClientMap()[mainCluster].FederatedSessions("default")
+}
+
+// createFederatedSession creates the FederatedSession, trying other names when a generated one collides. A session
+// left by a previous attempt of the same request is returned as if it was created.
+func (h *Handler) createFederatedSession(
+	ctx *gin.Context,
+	session *sessionv1alpha1.Session,
+	sessionPodsCluster string,
+	generated bool,
+) {
+
+	federatedSession := &sessionv1alpha1.FederatedSession{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        session.Name,
+			Labels:      session.Labels,
+			Annotations: session.Annotations,
+		},
+		Spec: sessionv1alpha1.FederatedSessionSpec{
+			SessionPodsCluster:      sessionPodsCluster,
+			SessionPodTemplates:     session.Spec.SessionPodTemplates,
+			ClientPodTemplates:      session.Spec.ClientPodTemplates,
+			TimeoutSeconds:          session.Spec.TimeoutSeconds,
+			ReutilizeTimeoutSeconds: session.Spec.ReutilizeTimeoutSeconds,
+			HeartbeatTimeoutSeconds: session.Spec.HeartbeatTimeoutSeconds,
+			MaxClients:              session.Spec.MaxClients,
+			Clients:                 make(map[string]sessionv1alpha1.FederatedClient),
+		},
+	}
+
+	replayed, err := h.createFederatedSessionOnce(ctx.Request.Context(), federatedSession)
+
+	for attempt := 1; generated && errorIsSessionConflict(err) && attempt < generatedNameAttempts; attempt++ {
+		federatedSession.Name = generateSessionName(session.Labels[templateLabel])
+		replayed, err = h.createFederatedSessionOnce(ctx.Request.Context(), federatedSession)
+	}
+
+	if err != nil && errorIsSessionConflict(err) {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: err.Error()})
+		return
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	location := ctx.Request.URL.Path + "/" + federatedSession.Name
+	if replayed {
+		ctx.Header(api.IdempotentReplayedHeader, "true")
+	}
+
+	ctx.Header("Location", location)
+	ctx.JSON(http.StatusCreated, api.CreateSessionResponse{Session: federatedSession.Name, URI: location})
+}
+
+// createFederatedSessionOnce returns whether the FederatedSession was already created by the same request, and a
+// conflict when a FederatedSession of the same name was created by another one
+func (h *Handler) createFederatedSessionOnce(
+	ctx context.Context,
+	federatedSession *sessionv1alpha1.FederatedSession,
+) (bool, error) {
+
+	_, err := h.federatedSessions().Create(federatedSession, ctx)
+	if err == nil || !errors.IsAlreadyExists(err) {
+		return false, err
+	}
+
+	existing, err := h.federatedSessions().Get(ctx, federatedSession.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	if err := checkSameRequest(existing, federatedSession); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// getFederatedSession writes the error response itself and returns nil when the session could not be read
+func (h *Handler) getFederatedSession(ctx *gin.Context, sessionId string) *sessionv1alpha1.FederatedSession {
+	federatedSession, err := h.federatedSessions().Get(ctx.Request.Context(), sessionId, metav1.GetOptions{})
+
+	if err != nil && errors.IsNotFound(err) {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "session not found"})
+		return nil
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	return federatedSession
+}
+
+func (h *Handler) getFederatedSessionView(ctx *gin.Context) {
+	federatedSession := h.getFederatedSession(ctx, ctx.Param("sessionId"))
+	if federatedSession == nil {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, api.SessionView{
+		Session:   *federatedSessionView(federatedSession),
+		Placement: federatedSessionPlacement(federatedSession),
+	})
+}
+
+// federatedSessionView renders a FederatedSession as the Session returned by the non federated mode
+func federatedSessionView(federatedSession *sessionv1alpha1.FederatedSession) *sessionv1alpha1.Session {
+	session := &sessionv1alpha1.Session{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        federatedSession.Name,
+			Labels:      federatedSession.Labels,
+			Annotations: federatedSession.Annotations,
+		},
+		Spec: sessionv1alpha1.SessionSpec{
+			SessionPodTemplates:     federatedSession.Spec.SessionPodTemplates,
+			ClientPodTemplates:      federatedSession.Spec.ClientPodTemplates,
+			TimeoutSeconds:          federatedSession.Spec.TimeoutSeconds,
+			ReutilizeTimeoutSeconds: federatedSession.Spec.ReutilizeTimeoutSeconds,
+			HeartbeatTimeoutSeconds: federatedSession.Spec.HeartbeatTimeoutSeconds,
+			MaxClients:              federatedSession.Spec.MaxClients,
+			Upgrade:                 federatedSession.Spec.Upgrade,
+			Clients:                 make(map[string]bool, len(federatedSession.Spec.Clients)),
+		},
+		Status: sessionv1alpha1.SessionStatus{
+			SessionPods:  federatedSession.Status.SessionPods,
+			Clients:      federatedSession.Status.Clients,
+			OutdatedPods: federatedSession.Status.OutdatedPods,
+		},
+	}
+
+	for clientId, federatedClient := range federatedSession.Spec.Clients {
+		session.Spec.Clients[clientId] = federatedClient.Connected
+	}
+
+	return session
+}
+
+// federatedSessionPlacement reports the members of a federated session, members that failed to sync count as
+// missing their copy
+func federatedSessionPlacement(federatedSession *sessionv1alpha1.FederatedSession) api.SessionPlacement {
+	placement := api.SessionPlacement{
+		Clusters:        []string{},
+		MissingClusters: []string{},
+		ClientClusters:  make(map[string]string, len(federatedSession.Spec.Clients)),
+		Divergences:     []string{},
+	}
+
+	if len(federatedSession.Spec.SessionPodTemplates.Items) != 0 {
+		placement.SessionPodsCluster = federatedSession.Spec.SessionPodsCluster
+	}
+
+	for clientId, federatedClient := range federatedSession.Spec.Clients {
+		placement.ClientClusters[clientId] = federatedClient.Cluster
+	}
+
+	for cluster, memberStatus := range federatedSession.Status.Members {
+		if memberStatus.Synced {
+			placement.Clusters = append(placement.Clusters, cluster)
+			continue
+		}
+
+		placement.MissingClusters = append(placement.MissingClusters, cluster)
+		placement.Divergences = append(placement.Divergences,
+			fmt.Sprintf("cluster %s not synced: %s", cluster, memberStatus.Error))
+	}
+
+	sort.Strings(placement.Clusters)
+	sort.Strings(placement.MissingClusters)
+	sort.Strings(placement.Divergences)
+
+	return placement
+}
+
+// getFederatedSessions passes the pagination straight to the listing of FederatedSessions in the main cluster
+func (h *Handler) getFederatedSessions(ctx *gin.Context, query api.ListSessionsQuery, selector string) {
+	opts := metav1.ListOptions{LabelSelector: selector, Limit: query.Limit, Continue: query.Continue}
+
+	federatedSessions, err := h.federatedSessions().List(opts, ctx.Request.Context())
+	if err != nil {
+		listError(ctx, err)
+		return
+	}
+
+	sessionsLocation := make([]api.SessionLocation, 0, len(federatedSessions.Items))
+
+	for i := range federatedSessions.Items {
+		federatedSession := &federatedSessions.Items[i]
+
+		location, ok := sessionLocation(ctx, query, federatedSessionView(federatedSession),
+			federatedSessionPlacement(federatedSession))
+		if ok {
+			sessionsLocation = append(sessionsLocation, location)
+		}
+	}
+
+	if federatedSessions.Continue != "" {
+		ctx.Header(api.ContinueHeader, federatedSessions.Continue)
+	}
+
+	ctx.JSON(http.StatusOK, sessionsLocation)
+}
+
+func (h *Handler) deleteFederatedSession(ctx *gin.Context) {
+	err := h.federatedSessions().Delete(ctx.Param("sessionId"), metav1.DeleteOptions{}, ctx.Request.Context())
+
+	if err != nil && errors.IsNotFound(err) {
+		ctx.JSON(http.StatusNotFound, nil)
+		return
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, nil)
+}
+
+func (h *Handler) addFederatedClient(
+	ctx context.Context,
+	sessionId string,
+	body api.CreateClientBody,
+	request string,
+) error {
+
+	federatedSession, err := h.federatedSessions().Get(ctx, sessionId, metav1.GetOptions{})
+	if err != nil && errors.IsNotFound(err) {
+		return stdErrors.New("session not found")
+
+	} else if err != nil {
+		return err
+	}
+
+	if _, ok := federatedSession.Spec.Clients[body.ClientId]; ok {
+		return errClientExists
+	}
+
+	patchData, err := clientPatchData(ctx, body.ClientId,
+		sessionv1alpha1.FederatedClient{Cluster: body.Cluster, Connected: true}, request)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.federatedSessions().Patch(ctx, sessionId, types.MergePatchType, patchData, metav1.PatchOptions{})
+	return err
+}
+
+// findFederatedClient writes the error response itself and returns nil when the client could not be found
+func (h *Handler) findFederatedClient(
+	ctx *gin.Context,
+	sessionId string,
+	clientId string,
+) *sessionv1alpha1.FederatedSession {
+
+	federatedSession := h.getFederatedSession(ctx, sessionId)
+	if federatedSession == nil {
+		return nil
+	}
+
+	federatedClient, ok := federatedSession.Spec.Clients[clientId]
+	if !ok {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "session not found"})
+		return nil
+	}
+
+	telemetry.SetCluster(ctx.Request.Context(), federatedClient.Cluster)
+	return federatedSession
+}
+
+func (h *Handler) getFederatedClient(ctx *gin.Context) {
+	clientId := ctx.Param("clientId")
+
+	federatedSession := h.findFederatedClient(ctx, ctx.Param("sessionId"), clientId)
+	if federatedSession == nil {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, api.ClientResponse{
+		Admission: api.ClientAdmitted,
+		Spec:      api.ClientSpec{Connected: federatedSession.Spec.Clients[clientId].Connected},
+		Status:    federatedSession.Status.Clients[clientId],
+	})
+}
+
+func (h *Handler) getFederatedClients(ctx *gin.Context) {
+	federatedSession := h.getFederatedSession(ctx, ctx.Param("sessionId"))
+	if federatedSession == nil {
+		return
+	}
+
+	renderClientsPage(ctx, federatedSessionView(federatedSession))
+}
+
+func (h *Handler) updateFederatedClient(ctx *gin.Context, connected bool) {
+	sessionId := ctx.Param("sessionId")
+	clientId := ctx.Param("clientId")
+
+	if h.findFederatedClient(ctx, sessionId, clientId) == nil {
+		return
+	}
+
+	patchData, err := connectedPatchData(federatedConnectedPath(clientId), connected)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.patchFederatedClient(ctx, sessionId, types.JSONPatchType, patchData)
+}
+
+func (h *Handler) deleteFederatedClient(ctx *gin.Context) {
+	sessionId := ctx.Param("sessionId")
+	clientId := ctx.Param("clientId")
+
+	if h.findFederatedClient(ctx, sessionId, clientId) == nil {
+		return
+	}
+
+	patchData, err := clientPatchData(ctx.Request.Context(), clientId, nil, "")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.patchFederatedClient(ctx, sessionId, types.MergePatchType, patchData)
+}
+
+func (h *Handler) patchFederatedClient(ctx *gin.Context, sessionId string, pt types.PatchType, patchData []byte) {
+	_, err := h.federatedSessions().Patch(ctx.Request.Context(), sessionId, pt, patchData, metav1.PatchOptions{})
+	err = clientPatchError(err)
+
+	if err != nil && (errors.IsNotFound(err) || errorIsSessionNotFound(err)) {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+
+	} else {
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+func (h *Handler) patchFederatedClientConnected(
+	ctx context.Context,
+	sessionId string,
+	clientId string,
+	connected bool,
+) error {
+
+	patchData, err := connectedPatchData(federatedConnectedPath(clientId), connected)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.federatedSessions().Patch(ctx, sessionId, types.JSONPatchType, patchData, metav1.PatchOptions{})
+	return clientPatchError(err)
+}
+
+// findFederatedSessionPodsCluster returns the session pods cluster of a federated session, or an empty string when
+// the session has no session pods
+func (h *Handler) findFederatedSessionPodsCluster(ctx context.Context, sessionId string) (string, error) {
+	federatedSession, err := h.federatedSessions().Get(ctx, sessionId, metav1.GetOptions{})
+	if err != nil && errors.IsNotFound(err) {
+		return "", stdErrors.New("session not found")
+
+	} else if err != nil {
+		return "", err
+	}
+
+	if len(federatedSession.Spec.SessionPodTemplates.Items) == 0 {
+		return "", nil
+	}
+
+	return federatedSession.Spec.SessionPodsCluster, nil
+}
@@ -1,26 +1,32 @@
 package handlers
 
 import (
-	"errors"
+	"fmt"
 	"os"
+	"sync/atomic"
 
 	k8sClient "mr.telepresence/session-manager/k8s-client"
 
-	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
-	"log"
 	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
 	"sigs.k8s.io/yaml"
 )
 
 type Handler struct {
-	clusterClientsetMap map[string]*kubernetes.Clientset
-	clusterClientMap    map[string]*k8sClient.SessionClient
-	sessionTemplates    map[string]*SessionTemplate
+	config     atomic.Pointer[clusterConfig]
+	reloader   *configReloader
+	heartbeats *heartbeatMonitor
+	waiting    *waitingRoom
+	placement  *PlacementConfig
+	limits     *LimitsConfig
+	prober     *clusterProber
+
+	// Set when sessions are stored as FederatedSessions in the main cluster instead of being fanned out
+	federated bool
 }
 
 // Reference:
@@ -29,87 +35,58 @@ type Handler struct {
 
 const kubeConfigPath = "conf/kubeconfig.yaml"
 const templatesPath = "conf/templates.yaml"
+const federatedEnv = "FEDERATED"
 
-func ConfigHandler() (*Handler, error) {
-	var apiConfig *api.Config
-	if apiConfig = clientcmd.GetConfigFromFileOrDie(kubeConfigPath); apiConfig == nil {
-		return nil, errors.New("could not read config from file")
-	}
+// Cluster the session-manager runs in, holding the SessionTemplates and, in federated mode, the FederatedSessions
+const mainCluster = "main"
 
+func ConfigHandler() (*Handler, error) {
 	k8sClient.AddToScheme(scheme.Scheme)
 
-	clusterClientMap := make(map[string]*k8sClient.SessionClient, len(apiConfig.Contexts))
-	clusterClientsetMap := make(map[string]*kubernetes.Clientset, len(apiConfig.Contexts))
-
-	// config main cluster clients if in cluster mode
-	cfg, err := rest.InClusterConfig()
-	if err == nil {
-		client, err := k8sClient.NewForConfig(cfg)
-		if err != nil {
-			return nil, err
-		}
+	federated := os.Getenv(federatedEnv) == "true"
 
-		clientset, err := kubernetes.NewForConfig(cfg)
-		if err != nil {
-			return nil, err
-		}
-		clusterClientMap["main"] = client
-		clusterClientsetMap["main"] = clientset
+	config, err := loadClusterConfig(federated)
+	if err != nil {
+		return nil, err
 	}
 
+	placement, err := readPlacementConfig()
 	if err != nil {
-		log.Println(err.Error())
+		return nil, err
 	}
 
-	// config remaning cluster clients
-
-	if _, ok := clusterClientMap["main"]; ok {
-		delete(apiConfig.Contexts, "main")
-		log.Println("deleted")
+	limits, err := readLimitsConfig()
+	if err != nil {
+		return nil, err
 	}
 
-	for contextName := range apiConfig.Contexts {
-
-		log.Println("context: ", contextName)
-		cfg, err := buildConfigWithContext(contextName, kubeConfigPath)
-		if err != nil {
-			log.Println(err.Error())
-			return nil, err
-		}
-
-		client, err := k8sClient.NewForConfig(cfg)
-		if err != nil {
-			log.Println(err.Error())
-			return nil, err
-		}
-
-		clientset, err := kubernetes.NewForConfig(cfg)
-		if err != nil {
-			log.Println(err.Error())
-			return nil, err
-		}
+	handler := &Handler{
+		reloader:   &configReloader{},
+		heartbeats: newHeartbeatMonitor(),
+		waiting:    newWaitingRoom(),
+		placement:  placement,
+		limits:     limits,
+		prober:     newClusterProber(),
+		federated:  federated}
+
+	handler.config.Store(config)
+	return handler, nil
+}
 
-		clusterClientMap[contextName] = client
-		clusterClientsetMap[contextName] = clientset
-	}
+func (h *Handler) clusterClientMap() map[string]*k8sClient.SessionClient {
+	return h.config.Load().clusterClientMap
+}
 
-	templates, err := readTemplates()
-	if err != nil {
-		return nil, err
-	}
+func (h *Handler) clusterClientsetMap() map[string]*kubernetes.Clientset {
+	return h.config.Load().clusterClientsetMap
+}
 
-	return &Handler{
-		clusterClientsetMap: clusterClientsetMap,
-		clusterClientMap:    clusterClientMap,
-		sessionTemplates:    templates}, nil
+func (h *Handler) fileTemplates() map[string]*SessionTemplate {
+	return h.config.Load().fileTemplates
 }
 
-func buildConfigWithContext(context string, kubeconfigPath string) (*rest.Config, error) {
-	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
-		&clientcmd.ConfigOverrides{
-			CurrentContext: context,
-		}).ClientConfig()
+func buildConfigWithContext(context string, apiConfig *api.Config) (*rest.Config, error) {
+	return clientcmd.NewNonInteractiveClientConfig(*apiConfig, context, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
 }
 
 // ref: https://medium.com/better-programming/parsing-and-creating-yaml-in-go-crash-course-2ec10b7db850
@@ -119,29 +96,32 @@ type SessionTemplateList struct {
 }
 
 type SessionTemplate struct {
-	Name                    string                                `json:"name"`
-	SessionPodTemplates     corev1.PodTemplateList                `json:"sessionPodTemplates"`
-	ClientPodTemplates      sessionv1alpha1.ClientPodTemplateList `json:"clientPodTemplates"`
-	TimeoutSeconds          int                                   `json:"timeoutSeconds"`
-	ReutilizeTimeoutSeconds int                                   `json:"reutilizeTimeoutSeconds"`
+	Name string `json:"name"`
+	// Version defaults to 1, file templates only have one version
+	Version                             int `json:"version"`
+	sessionv1alpha1.SessionTemplateSpec `json:",inline"`
 }
 
-func readTemplates() (map[string]*SessionTemplate, error) {
+func parseTemplates(f []byte) (map[string]*SessionTemplate, error) {
 	templatesMap := make(map[string]*SessionTemplate)
 
-	f, err := os.ReadFile(templatesPath)
-	if err != nil {
-		return nil, err
-	}
-
 	var sessionTemplates SessionTemplateList
 	if err := yaml.Unmarshal(f, &sessionTemplates); err != nil {
 		return nil, err
 	}
 
 	for _, template := range sessionTemplates.Templates {
+		if template.Version == 0 {
+			template.Version = 1
+		}
+		if err := validateTemplateParameters(&template.SessionTemplateSpec); err != nil {
+			return nil, fmt.Errorf("template %s: %w", template.Name, err)
+		}
+		if err := validateTemplateLimits(&template.SessionTemplateSpec); err != nil {
+			return nil, fmt.Errorf("template %s: %w", template.Name, err)
+		}
 		templatesMap[template.Name] = &template
 	}
 
-	return templatesMap, err
+	return templatesMap, nil
 }
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	stdErrors "errors"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"mr.telepresence/session-manager/api"
+	k8sClient "mr.telepresence/session-manager/k8s-client"
+	"mr.telepresence/session-manager/telemetry"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+const heartbeatSweepInterval = 5 * time.Second
+
+type heartbeatKey struct {
+	session string
+	client  string
+}
+
+type heartbeatEntry struct {
+	lastSeen time.Time
+	// set once the monitor disconnected the client, so the next heartbeat reconnects it
+	timedOut bool
+}
+
+type heartbeatMonitor struct {
+	mu      sync.Mutex
+	entries map[heartbeatKey]*heartbeatEntry
+}
+
+func newHeartbeatMonitor() *heartbeatMonitor {
+	return &heartbeatMonitor{entries: make(map[heartbeatKey]*heartbeatEntry)}
+}
+
+// beat records a heartbeat and reports whether the client was known and whether it had timed out
+func (m *heartbeatMonitor) beat(key heartbeatKey, now time.Time) (known bool, timedOut bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return false, false
+	}
+
+	entry.lastSeen = now
+	timedOut = entry.timedOut
+	entry.timedOut = false
+	return true, timedOut
+}
+
+func (m *heartbeatMonitor) track(key heartbeatKey, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[key] = &heartbeatEntry{lastSeen: now}
+}
+
+// Heartbeat keeps a client connected. Clients of sessions with a heartbeat timeout that stop sending heartbeats are
+// disconnected by MonitorHeartbeats, and reconnected by their next heartbeat.
+func (h *Handler) Heartbeat(ctx *gin.Context) {
+	key := heartbeatKey{session: ctx.Param("sessionId"), client: ctx.Param("clientId")}
+	now := time.Now()
+
+	known, timedOut := h.heartbeats.beat(key, now)
+	if known && !timedOut {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+
+	clusterClient, session, err := findSessionByClientId(ctx.Request.Context(), h.clusterClientMap(), key.session,
+		key.client)
+
+	if err != nil && errorIsSessionNotFound(err) {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
+		return
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.heartbeats.track(key, now)
+
+	if timedOut && !session.Spec.Clients[key.client] {
+		err := h.patchClientConnected(ctx.Request.Context(), clusterClient, key.session, key.client, true)
+
+		if err != nil && errorIsSessionNotFound(err) {
+			ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
+			return
+
+		} else if err != nil {
+			ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// MonitorHeartbeats periodically disconnects the clients of sessions with a heartbeat timeout that missed their
+// heartbeats. Connected clients the monitor has not heard of yet get a full timeout from the moment they are found.
+func (h *Handler) MonitorHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(heartbeatSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.sweepHeartbeats(ctx)
+		}
+	}
+}
+
+func (h *Handler) sweepHeartbeats(ctx context.Context) {
+	now := time.Now()
+	found := make(map[heartbeatKey]struct{})
+	complete := true
+
+	for cluster, clusterClient := range h.clusterClientMap() {
+		sessions, err := clusterClient.Sessions("default").List(metav1.ListOptions{}, ctx)
+		if err != nil {
+			slog.Warn("unable to list sessions", "cluster", cluster, "error", err.Error())
+			complete = false
+			continue
+		}
+
+		for _, session := range sessions.Items {
+			if session.Spec.HeartbeatTimeoutSeconds <= 0 {
+				continue
+			}
+			timeout := time.Duration(session.Spec.HeartbeatTimeoutSeconds) * time.Second
+
+			for clientId, connected := range session.Spec.Clients {
+				key := heartbeatKey{session: session.Name, client: clientId}
+				found[key] = struct{}{}
+
+				if !connected {
+					continue
+				}
+
+				if h.heartbeats.expire(key, now, timeout) {
+					slog.Info("client missed its heartbeats", "session", session.Name, "client", clientId)
+
+					// a client removed in the meantime has nothing left to disconnect
+					err := h.patchClientConnected(ctx, clusterClient, session.Name, clientId, false)
+					if err != nil && !errorIsSessionNotFound(err) {
+						slog.Warn("unable to disconnect client", "session", session.Name, "client", clientId, "error", err.Error())
+						h.heartbeats.track(key, now)
+					}
+				}
+			}
+		}
+	}
+
+	// entries are only forgotten once every cluster has been listed
+	if complete {
+		h.heartbeats.forgetExcept(found)
+	}
+}
+
+// expire reports whether the client missed its heartbeats, marking it as timed out
+func (m *heartbeatMonitor) expire(key heartbeatKey, now time.Time, timeout time.Duration) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		m.entries[key] = &heartbeatEntry{lastSeen: now}
+		return false
+	}
+
+	if entry.timedOut {
+		// the client was reconnected without a heartbeat, give it a full timeout again
+		entry.timedOut = false
+		entry.lastSeen = now
+		return false
+	}
+
+	if now.Sub(entry.lastSeen) < timeout {
+		return false
+	}
+
+	entry.timedOut = true
+	return true
+}
+
+func (m *heartbeatMonitor) forgetExcept(keys map[heartbeatKey]struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.entries {
+		if _, ok := keys[key]; !ok {
+			delete(m.entries, key)
+		}
+	}
+}
+
+func (h *Handler) patchClientConnected(
+	ctx context.Context,
+	clusterClient *k8sClient.SessionClient,
+	sessionId string,
+	clientId string,
+	connected bool,
+) error {
+	if h.federated {
+		return h.patchFederatedClientConnected(ctx, sessionId, clientId, connected)
+	}
+
+	patchData, err := connectedPatchData(clientPath(clientId), connected)
+	if err != nil {
+		return err
+	}
+
+	sessions := clusterClient.Sessions("default")
+	_, err = sessions.Patch(ctx, sessionId, types.JSONPatchType, patchData, metav1.PatchOptions{})
+	return clientPatchError(err)
+}
+
+// clientPatchData builds a merge patch that only touches spec.clients.<clientId> and the request annotation of the
+// client, a nil value removes the client. The traceparent of the request is recorded as well so the reconciles the
+// change triggers are linked to it.
+func clientPatchData(ctx context.Context, clientId string, value interface{}, request string) ([]byte, error) {
+	// the request of a previous join is dropped along with the client, or when it joins again without key
+	var requestValue interface{}
+	if request != "" {
+		requestValue = request
+	}
+
+	annotations := map[string]interface{}{
+		clientRequestAnnotation(clientId): requestValue,
+	}
+
+	if traceParent := telemetry.TraceParent(ctx); traceParent != "" {
+		annotations[sessionv1alpha1.TraceParentAnnotation] = traceParent
+	}
+
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+		"spec": map[string]interface{}{
+			"clients": map[string]interface{}{
+				clientId: value,
+			},
+		},
+	}
+
+	return json.Marshal(patch)
+}
+
+// setTraceParentAnnotation records the traceparent of the request an object is created for, if it is traced
+func setTraceParentAnnotation(ctx context.Context, object metav1.Object) {
+	traceParent := telemetry.TraceParent(ctx)
+	if traceParent == "" {
+		return
+	}
+
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[sessionv1alpha1.TraceParentAnnotation] = traceParent
+	object.SetAnnotations(annotations)
+}
+
+// connectedPatchData builds a JSON patch setting the connected flag at path. Unlike a merge patch, it fails when the
+// client was removed in the meantime instead of adding it back: the remove operation requires the path to exist, which
+// the API server does not check for replace operations.
+func connectedPatchData(path string, connected bool) ([]byte, error) {
+	return json.Marshal([]map[string]interface{}{
+		{"op": "remove", "path": path},
+		{"op": "add", "path": path, "value": connected},
+	})
+}
+
+// clientPath is the JSON pointer of a client in the spec of a Session
+func clientPath(clientId string) string {
+	return "/spec/clients/" + jsonPointerEscaper.Replace(clientId)
+}
+
+// federatedConnectedPath is the JSON pointer of the connected flag of a client in the spec of a FederatedSession
+func federatedConnectedPath(clientId string) string {
+	return clientPath(clientId) + "/connected"
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// clientPatchError reports a JSON patch that failed since the client is gone like a client that was not found
+func clientPatchError(err error) error {
+	if err != nil && errors.IsInvalid(err) {
+		return stdErrors.New("session not found")
+	}
+
+	return err
+}
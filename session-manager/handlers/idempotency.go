@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	stdErrors "errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"mr.telepresence/session-manager/api"
+	"mr.telepresence/session-manager/auth"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+// A session created with an Idempotency-Key is named after the key, and the hashes of the key and of the request body
+// are kept in its annotations. A repeated request then runs into the session of the first one, which is returned when
+// both hashes match. Any other session of the same name is a conflict, never reused.
+//
+// Clients are handled the same way: the hashes of the key and of the body a client joined with are kept in an
+// annotation of the session holding it, one per client so concurrent joins patch distinct keys.
+//
+// Keys are scoped to the principal sending them, two tenants using the same key never run into each other's requests.
+
+const (
+	idempotencyKeyAnnotation = "mr.telepresence/idempotency-key"
+	requestHashAnnotation    = "mr.telepresence/request-hash"
+
+	clientRequestAnnotationPrefix = "mr.telepresence/client-request-"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// Number of hex characters of the generated session name suffixes
+const sessionNameSuffixLength = 12
+
+// Number of names tried when generated names collide with existing sessions
+const generatedNameAttempts = 3
+
+// The session controller names the pods <session>-<template> and <session>-<template>-xxxx for client pods, and the
+// network controller names their services <pod>-svc
+const (
+	clientPodSuffixLength = len("-xxxx")
+	serviceSuffixLength   = len("-svc")
+)
+
+var errSessionConflict = stdErrors.New("session conflict")
+
+func errorIsSessionConflict(err error) bool {
+	return stdErrors.Is(err, errSessionConflict)
+}
+
+func sessionConflict(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", errSessionConflict, fmt.Sprintf(format, args...))
+}
+
+// idempotencyKey returns the Idempotency-Key header of the request scoped to the principal sending it, empty when it
+// was not sent
+func idempotencyKey(ctx *gin.Context) (string, error) {
+	key := ctx.GetHeader(api.IdempotencyKeyHeader)
+	if len(key) > maxIdempotencyKeyLength {
+		return "", fmt.Errorf("%s must be at most %d characters long", api.IdempotencyKeyHeader,
+			maxIdempotencyKeyLength)
+	}
+
+	principal := auth.GetPrincipal(ctx)
+	if key == "" || principal == nil {
+		return key, nil
+	}
+
+	// encoded as a list so no tenant, client id and key can be confused with another
+	scopedKey, err := json.Marshal([]string{principal.Tenant, principal.ClientId, key})
+	if err != nil {
+		return "", err
+	}
+	return string(scopedKey), nil
+}
+
+func hashValue(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionName returns the name of a new session of the template spec, and whether it was generated and may be
+// generated again when it collides with an existing session
+func sessionName(
+	body *api.RegisterSessionBody,
+	key string,
+	spec *sessionv1alpha1.SessionTemplateSpec,
+) (string, bool, error) {
+
+	name, generated := body.SessionId, false
+	if name != "" {
+		if errs := validation.IsDNS1123Label(name); len(errs) != 0 {
+			return "", false, fmt.Errorf("invalid sessionId: %s", strings.Join(errs, ", "))
+		}
+
+	} else if key != "" {
+		name = body.TemplateName + "-" + hashValue([]byte(key))[:sessionNameSuffixLength]
+
+	} else {
+		name, generated = generateSessionName(body.TemplateName), true
+	}
+
+	if maxLength := maxSessionNameLength(spec); len(name) > maxLength {
+		return "", false, fmt.Errorf("session name %s must be at most %d characters long for the names of its pods "+
+			"and services to be valid", name, maxLength)
+	}
+
+	return name, generated, nil
+}
+
+// maxSessionNameLength returns the length of the longest session name for which the names of the pods of the
+// template spec, of their services, and the svc label of the pods stay within the length of a DNS-1123 label
+func maxSessionNameLength(spec *sessionv1alpha1.SessionTemplateSpec) int {
+	longestSuffix := 0
+
+	for _, template := range spec.SessionPodTemplates.Items {
+		longestSuffix = max(longestSuffix, len("-"+template.Name))
+	}
+
+	for _, template := range spec.ClientPodTemplates.Items {
+		longestSuffix = max(longestSuffix, len("-"+template.Name)+clientPodSuffixLength)
+	}
+
+	return validation.DNS1123LabelMaxLength - longestSuffix - serviceSuffixLength
+}
+
+func generateSessionName(templateName string) string {
+	return templateName + "-" + strings.ReplaceAll(uuid.New().String(), "-", "")[:sessionNameSuffixLength]
+}
+
+// setIdempotencyAnnotations records the key and the request a session is created for
+func setIdempotencyAnnotations(object metav1.Object, key string, body *api.RegisterSessionBody) error {
+	if key == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[idempotencyKeyAnnotation] = hashValue([]byte(key))
+	annotations[requestHashAnnotation] = hashValue(data)
+	object.SetAnnotations(annotations)
+
+	return nil
+}
+
+// checkSameRequest returns nil when the existing session was created by a previous attempt of the request creating
+// session, and a conflict otherwise
+func checkSameRequest(existing metav1.Object, session metav1.Object) error {
+	key := session.GetAnnotations()[idempotencyKeyAnnotation]
+	if key == "" || existing.GetAnnotations()[idempotencyKeyAnnotation] != key {
+		return sessionConflict("session %s already exists", session.GetName())
+	}
+
+	if existing.GetAnnotations()[requestHashAnnotation] != session.GetAnnotations()[requestHashAnnotation] {
+		return sessionConflict("%s was already used with a different request", api.IdempotencyKeyHeader)
+	}
+
+	return nil
+}
+
+// clientRequestAnnotation returns the annotation holding the request the client joined with. Client ids are hashed
+// since they are not restricted to the characters allowed in annotation names.
+func clientRequestAnnotation(clientId string) string {
+	return clientRequestAnnotationPrefix + hashValue([]byte(clientId))[:32]
+}
+
+// clientRequest returns the value of the client request annotation, the hashes of the key and of the body separated
+// by a dot, empty without key
+func clientRequest(key string, body *api.CreateClientBody) (string, error) {
+	if key == "" {
+		return "", nil
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	return hashValue([]byte(key)) + "." + hashValue(data), nil
+}
+
+// checkSameClientRequest returns nil when the client was added by a previous attempt of the request, and a conflict
+// otherwise
+func checkSameClientRequest(existing string, request string) error {
+	existingKey, existingBody, _ := strings.Cut(existing, ".")
+	key, body, _ := strings.Cut(request, ".")
+
+	if key == "" || existingKey != key {
+		return errClientExists
+	}
+
+	if existingBody != body {
+		return fmt.Errorf("%w: %s was already used with a different request", errClientExists,
+			api.IdempotencyKeyHeader)
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"mr.telepresence/session-manager/api"
+	"mr.telepresence/session-manager/auth"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+// tenantAuthenticator authenticates every request as a backend of the tenant given in the Authorization header
+type tenantAuthenticator struct{}
+
+func (tenantAuthenticator) Authenticate(header string) (*auth.Principal, error) {
+	return &auth.Principal{Role: auth.BackendRole, Tenant: header}, nil
+}
+
+// Joining again with the key and body of a previous join is replayed, anything else is a conflict
+func TestCreateClientIdempotency(t *testing.T) {
+	fakeServer := newFakeAPIServer(t, &sessionv1alpha1.Session{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec:       sessionv1alpha1.SessionSpec{Clients: map[string]bool{}},
+	})
+	apiServer := httptest.NewServer(fakeServer)
+	defer apiServer.Close()
+
+	router := newTestRouter(newTestHandler(t, apiServer))
+
+	join := func(key string, body api.CreateClientBody) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		request := httptest.NewRequest(http.MethodPost, "/session/demo/client", bytes.NewReader(data))
+		request.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			request.Header.Set(api.IdempotencyKeyHeader, key)
+		}
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	alice := api.CreateClientBody{ClientId: "alice", Cluster: mainCluster}
+	bob := api.CreateClientBody{ClientId: "bob", Cluster: mainCluster}
+
+	if recorder := join("alice-1", alice); recorder.Code != http.StatusOK {
+		t.Fatalf("expected alice to join, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := join("", bob); recorder.Code != http.StatusOK {
+		t.Fatalf("expected bob to join, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		body     api.CreateClientBody
+		code     int
+		replayed bool
+	}{
+		{"same key and body", "alice-1", alice, http.StatusOK, true},
+		{"same key and another body", "alice-1", api.CreateClientBody{ClientId: "alice", Queue: true},
+			http.StatusConflict, false},
+		{"another key", "alice-2", alice, http.StatusConflict, false},
+		{"without key", "", alice, http.StatusConflict, false},
+		{"key after joining without one", "bob-1", bob, http.StatusConflict, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := join(test.key, test.body)
+			if recorder.Code != test.code {
+				t.Fatalf("expected %d, got %d %s", test.code, recorder.Code, recorder.Body.String())
+			}
+
+			if replayed := recorder.Header().Get(api.IdempotentReplayedHeader) == "true"; replayed != test.replayed {
+				t.Errorf("expected replayed to be %t, got %t", test.replayed, replayed)
+			}
+		})
+	}
+
+	// the request is forgotten along with the client
+	if _, err := serve(router, http.MethodDelete, "/session/demo/client/alice", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fakeServer.session(t, "demo").Annotations[clientRequestAnnotation("alice")]; ok {
+		t.Error("expected the request of alice to be removed with her")
+	}
+}
+
+// The same Idempotency-Key sent by two tenants designates two sessions
+func TestIdempotencyKeyScopedToTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(auth.Authenticate([]auth.Authenticator{tenantAuthenticator{}}))
+	router.POST("/session", func(ctx *gin.Context) {
+		key, err := idempotencyKey(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		body := api.RegisterSessionBody{TemplateName: "demo"}
+		name, _, err := sessionName(&body, key, &sessionv1alpha1.SessionTemplateSpec{})
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		session := &sessionv1alpha1.Session{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if err := setIdempotencyAnnotations(session, key, &body); err != nil {
+			ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, session)
+	})
+
+	create := func(tenant string, key string) *sessionv1alpha1.Session {
+		request := httptest.NewRequest(http.MethodPost, "/session", nil)
+		request.Header.Set("Authorization", tenant)
+		request.Header.Set(api.IdempotencyKeyHeader, key)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%d %s", recorder.Code, recorder.Body.String())
+		}
+
+		session := &sessionv1alpha1.Session{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), session); err != nil {
+			t.Fatal(err)
+		}
+		return session
+	}
+
+	acme := create("acme", "key-1")
+	retry := create("acme", "key-1")
+	globex := create("globex", "key-1")
+
+	if acme.Name != retry.Name || checkSameRequest(acme, retry) != nil {
+		t.Errorf("expected the retry of acme to designate its session, got %s and %s", acme.Name, retry.Name)
+	}
+	if acme.Name == globex.Name || !strings.HasPrefix(globex.Name, "demo-") {
+		t.Errorf("expected globex to get a session of its own, got %s and %s", acme.Name, globex.Name)
+	}
+	if err := checkSameRequest(acme, globex); !errorIsSessionConflict(err) {
+		t.Errorf("expected the session of acme to conflict with the request of globex, got %v", err)
+	}
+}
+
+func TestSessionName(t *testing.T) {
+	// the longest pod is a client pod named <session>-viewer-xxxx, served by <session>-viewer-xxxx-svc
+	spec := &sessionv1alpha1.SessionTemplateSpec{
+		SessionPodTemplates: corev1.PodTemplateList{Items: []corev1.PodTemplate{
+			{ObjectMeta: metav1.ObjectMeta{Name: "server"}},
+		}},
+		ClientPodTemplates: sessionv1alpha1.ClientPodTemplateList{Items: []sessionv1alpha1.ClientPodTemplate{
+			{PodTemplate: corev1.PodTemplate{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}}},
+		}},
+	}
+	maxLength := 63 - len("-viewer-xxxx-svc")
+
+	tests := []struct {
+		name      string
+		body      api.RegisterSessionBody
+		key       string
+		expected  string
+		generated bool
+		valid     bool
+	}{
+		{"session id", api.RegisterSessionBody{TemplateName: "demo", SessionId: "lobby"}, "", "lobby", false, true},
+		{"longest session id", api.RegisterSessionBody{TemplateName: "demo",
+			SessionId: strings.Repeat("a", maxLength)}, "", strings.Repeat("a", maxLength), false, true},
+		{"session id too long for its pods", api.RegisterSessionBody{TemplateName: "demo",
+			SessionId: strings.Repeat("a", maxLength+1)}, "", "", false, false},
+		{"invalid session id", api.RegisterSessionBody{TemplateName: "demo", SessionId: "Lobby"}, "", "", false, false},
+		{"named after the key", api.RegisterSessionBody{TemplateName: "demo"}, "key-1",
+			"demo-" + hashValue([]byte("key-1"))[:sessionNameSuffixLength], false, true},
+		{"generated", api.RegisterSessionBody{TemplateName: "demo"}, "", "", true, true},
+		{"generated from a template name too long", api.RegisterSessionBody{TemplateName: strings.Repeat("t", 40)},
+			"", "", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name, generated, err := sessionName(&test.body, test.key, spec)
+			if !test.valid {
+				if err == nil {
+					t.Fatalf("expected the name to be rejected, got %s", name)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if generated != test.generated {
+				t.Errorf("expected generated to be %t, got %t", test.generated, generated)
+			}
+			if test.expected != "" && name != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, name)
+			}
+			if test.generated && !strings.HasPrefix(name, "demo-") {
+				t.Errorf("expected a name generated from the template name, got %s", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	stdErrors "errors"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"mr.telepresence/session-manager/api"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+// Limits are checked when sessions are created and clients join, against the sessions and clients found at that
+// moment. Concurrent requests may therefore briefly go over a limit, the next ones are rejected until it clears up.
+
+const limitsPath = "conf/limits/limits.yaml"
+
+// Label holding the tenant of the principal that created a session
+const tenantLabel = "mr.telepresence/tenant"
+
+// Resources tracked by the cluster capacity checks
+var capacityResources = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+
+type TenantLimits struct {
+	// Sessions the tenant may have at once, zero for no limit
+	MaxSessions int `json:"maxSessions"`
+}
+
+type LimitsConfig struct {
+	// Sessions each tenant may have at once, zero for no limit. Tenants listed in Tenants use their own limits.
+	MaxSessionsPerTenant int                     `json:"maxSessionsPerTenant"`
+	Tenants              map[string]TenantLimits `json:"tenants"`
+	// ClusterCapacity makes the prober track the resources of every cluster, joins being rejected when the cluster
+	// of the client cannot fit the client pods it needs
+	ClusterCapacity bool `json:"clusterCapacity"`
+	// Seconds a queued client keeps its place without polling, 30 when unset
+	QueueTimeoutSeconds int `json:"queueTimeoutSeconds"`
+	// Clients each session may have queued, zero for no limit
+	MaxQueueLength int `json:"maxQueueLength"`
+}
+
+func readLimitsConfig() (*LimitsConfig, error) {
+	config := &LimitsConfig{}
+
+	f, err := os.ReadFile(limitsPath)
+	if err != nil && stdErrors.Is(err, os.ErrNotExist) {
+		return config, nil
+
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(f, config); err != nil {
+		return nil, err
+	}
+
+	if config.MaxSessionsPerTenant < 0 || config.QueueTimeoutSeconds < 0 || config.MaxQueueLength < 0 {
+		return nil, stdErrors.New("maxSessionsPerTenant, queueTimeoutSeconds and maxQueueLength must not be negative")
+	}
+	for tenant, limits := range config.Tenants {
+		if limits.MaxSessions < 0 {
+			return nil, fmt.Errorf("maxSessions of tenant %s must not be negative", tenant)
+		}
+	}
+
+	return config, nil
+}
+
+// maxTenantSessions returns the sessions the tenant may have at once, zero for no limit
+func (c *LimitsConfig) maxTenantSessions(tenant string) int {
+	if limits, ok := c.Tenants[tenant]; ok {
+		return limits.MaxSessions
+	}
+
+	return c.MaxSessionsPerTenant
+}
+
+func validateTemplateLimits(spec *sessionv1alpha1.SessionTemplateSpec) error {
+	if spec.MaxClients < 0 || spec.MaxSessions < 0 {
+		return stdErrors.New("maxClients and maxSessions must not be negative")
+	}
+
+	return nil
+}
+
+// rejection is the error of a request rejected by a limit
+type rejection struct {
+	status  int
+	reason  api.RejectionReason
+	message string
+}
+
+func (r *rejection) Error() string {
+	return r.message
+}
+
+func reject(reason api.RejectionReason, format string, args ...interface{}) error {
+	return &rejection{status: rejectionStatus(reason), reason: reason, message: fmt.Sprintf(format, args...)}
+}
+
+func errorIsRejection(err error) bool {
+	var r *rejection
+	return stdErrors.As(err, &r)
+}
+
+// rejectionStatus is 409 for full sessions, and 429 for the limits that may clear up on their own
+func rejectionStatus(reason api.RejectionReason) int {
+	if reason == api.SessionFull {
+		return http.StatusConflict
+	}
+	return http.StatusTooManyRequests
+}
+
+// rejectionReason returns the limit a request was rejected by, empty for any other error
+func rejectionReason(err error) api.RejectionReason {
+	var r *rejection
+	if stdErrors.As(err, &r) {
+		return r.reason
+	}
+	return ""
+}
+
+// writeRejection answers a request rejected by a limit with its status and reason
+func writeRejection(ctx *gin.Context, err error) {
+	var r *rejection
+	stdErrors.As(err, &r)
+
+	ctx.JSON(r.status, api.ErrorResponse{Error: r.message, Reason: r.reason})
+}
+
+// checkSessionQuotas rejects the creation of the session when its template or tenant already has the sessions it
+// is allowed. The session itself is not counted, so a repeated request can still return it.
+func (h *Handler) checkSessionQuotas(ctx context.Context, session *sessionv1alpha1.Session, maxSessions int) error {
+	if maxSessions > 0 {
+		count, err := h.countSessions(ctx, templateLabel+"="+session.Labels[templateLabel], session.Name)
+		if err != nil {
+			return err
+		}
+
+		if count >= maxSessions {
+			return reject(api.TemplateQuotaExceeded,
+				"template %s already has %d sessions", session.Labels[templateLabel], count)
+		}
+	}
+
+	tenant, ok := session.Labels[tenantLabel]
+	if !ok {
+		return nil
+	}
+
+	if maxSessions := h.limits.maxTenantSessions(tenant); maxSessions > 0 {
+		count, err := h.countSessions(ctx, tenantLabel+"="+tenant, session.Name)
+		if err != nil {
+			return err
+		}
+
+		if count >= maxSessions {
+			return reject(api.TenantQuotaExceeded, "tenant %s already has %d sessions", tenant, count)
+		}
+	}
+
+	return nil
+}
+
+// countSessions counts the sessions matching the selector, leaving out the named one
+func (h *Handler) countSessions(ctx context.Context, selector string, excluded string) (int, error) {
+	sessionsLabels, err := h.sessionsLabels(ctx, selector)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, ok := sessionsLabels[excluded]; ok {
+		return len(sessionsLabels) - 1, nil
+	}
+
+	return len(sessionsLabels), nil
+}
+
+// sessionOccupancy is what the admission of a client needs to know about its session
+type sessionOccupancy struct {
+	name       string
+	maxClients int
+	templates  []sessionv1alpha1.ClientPodTemplate
+	// Cluster of every client of the session
+	clientClusters map[string]string
+	// Request every client joined with, see clientRequest
+	clientRequests map[string]string
+	// Clients allocated to each client pod, by cluster
+	podClients map[string]map[string]int
+}
+
+// findSessionOccupancy reads the clients of the session from every copy, or from the FederatedSession in federated
+// mode
+func (h *Handler) findSessionOccupancy(ctx context.Context, sessionId string) (*sessionOccupancy, error) {
+	occupancy := &sessionOccupancy{
+		name:           sessionId,
+		clientClusters: make(map[string]string),
+		clientRequests: make(map[string]string),
+		podClients:     make(map[string]map[string]int),
+	}
+
+	if h.federated {
+		federatedSession, err := h.federatedSessions().Get(ctx, sessionId, metav1.GetOptions{})
+		if err != nil && errors.IsNotFound(err) {
+			return nil, stdErrors.New("session not found")
+
+		} else if err != nil {
+			return nil, err
+		}
+
+		occupancy.maxClients = federatedSession.Spec.MaxClients
+		occupancy.templates = federatedSession.Spec.ClientPodTemplates.Items
+
+		for clientId, federatedClient := range federatedSession.Spec.Clients {
+			occupancy.clientClusters[clientId] = federatedClient.Cluster
+			occupancy.clientRequests[clientId] = federatedSession.Annotations[clientRequestAnnotation(clientId)]
+			occupancy.addPods(federatedClient.Cluster, federatedSession.Status.Clients[clientId])
+		}
+
+		return occupancy, nil
+	}
+
+	sessionCopies, err := findSessionCopies(ctx, sessionId, h.clusterClientMap())
+	if err != nil {
+		return nil, err
+	}
+
+	reference := sessionCopies[referenceCluster(sessionCopies)]
+	occupancy.maxClients = reference.Spec.MaxClients
+	occupancy.templates = reference.Spec.ClientPodTemplates.Items
+
+	// a client lives in a single copy, the first one found is kept should it be in several
+	for _, cluster := range sortedClusters(sessionCopies) {
+		session := sessionCopies[cluster]
+
+		for clientId := range session.Spec.Clients {
+			if _, ok := occupancy.clientClusters[clientId]; !ok {
+				occupancy.clientClusters[clientId] = cluster
+				occupancy.clientRequests[clientId] = session.Annotations[clientRequestAnnotation(clientId)]
+				occupancy.addPods(cluster, session.Status.Clients[clientId])
+			}
+		}
+	}
+
+	return occupancy, nil
+}
+
+func (o *sessionOccupancy) addPods(cluster string, clientStatus sessionv1alpha1.ClientStatus) {
+	if o.podClients[cluster] == nil {
+		o.podClients[cluster] = make(map[string]int)
+	}
+
+	for podName := range clientStatus.PodStatus {
+		o.podClients[cluster][podName]++
+	}
+}
+
+// checkSessionFull rejects a new client when the session already holds its maxClients
+func (o *sessionOccupancy) checkSessionFull() error {
+	if o.maxClients > 0 && len(o.clientClusters) >= o.maxClients {
+		return reject(api.SessionFull, "session %s already has %d clients", o.name, len(o.clientClusters))
+	}
+
+	return nil
+}
+
+// requiredResources sums the requests of the client pods a new client of the cluster would need to be spawned, the
+// templates whose pods still have room for a client needing none
+func (o *sessionOccupancy) requiredResources(cluster string) corev1.ResourceList {
+	required := corev1.ResourceList{}
+
+	for _, template := range o.templates {
+		if o.hasFreePod(cluster, &template) {
+			continue
+		}
+
+		addResources(required, podRequests(&template.Template.Spec))
+	}
+
+	return required
+}
+
+func (o *sessionOccupancy) hasFreePod(cluster string, template *sessionv1alpha1.ClientPodTemplate) bool {
+	// client pods are named after the session and their template
+	prefix := o.name + "-" + template.Name + "-"
+
+	for podName, clients := range o.podClients[cluster] {
+		if strings.HasPrefix(podName, prefix) && clients < template.MaxClients {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkClusterCapacity rejects a new client of the session when its cluster cannot fit the client pods it needs.
+// Clusters whose capacity was not probed yet are assumed to have room.
+func (h *Handler) checkClusterCapacity(cluster string, occupancy *sessionOccupancy) error {
+	if !h.limits.ClusterCapacity {
+		return nil
+	}
+
+	capacity := h.prober.capacity(cluster)
+	if capacity == nil {
+		return nil
+	}
+
+	required := occupancy.requiredResources(cluster)
+
+	for _, name := range capacityResources {
+		quantity, ok := required[name]
+		if !ok || quantity.IsZero() {
+			continue
+		}
+
+		free := capacity.Allocatable[name].DeepCopy()
+		free.Sub(capacity.Requested[name])
+
+		if free.Cmp(quantity) < 0 {
+			return reject(api.InsufficientCapacity, "cluster %s has %s %s left, the client pods request %s",
+				cluster, free.String(), name, quantity.String())
+		}
+	}
+
+	return nil
+}
+
+// podRequests returns the resources requested by a pod, the largest of its init containers and the sum of its
+// containers, plus its overhead
+func podRequests(spec *corev1.PodSpec) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+
+	for _, container := range spec.Containers {
+		addResources(requests, container.Resources.Requests)
+	}
+
+	for _, container := range spec.InitContainers {
+		for name, quantity := range container.Resources.Requests {
+			if current, ok := requests[name]; !ok || quantity.Cmp(current) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+
+	addResources(requests, spec.Overhead)
+	return requests
+}
+
+func addResources(total corev1.ResourceList, resources corev1.ResourceList) {
+	for name, quantity := range resources {
+		sum := total[name]
+		sum.Add(quantity)
+		total[name] = sum
+	}
+}
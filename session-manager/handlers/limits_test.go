@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"mr.telepresence/session-manager/api"
+	"mr.telepresence/session-manager/auth"
+	k8sClient "mr.telepresence/session-manager/k8s-client"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+func quotaSession(name string, template string, tenant string) *sessionv1alpha1.Session {
+	session := &sessionv1alpha1.Session{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       sessionv1alpha1.SessionSpec{Clients: map[string]bool{}},
+	}
+	session.Labels = map[string]string{templateLabel: template, tenantLabel: tenant}
+
+	return session
+}
+
+// newQuotaRouter serves POST /session for the demo template, limited to 2 sessions, and the open template, with
+// every tenant limited to 2 sessions but acme limited to 1
+func newQuotaRouter(t *testing.T, sessions ...*sessionv1alpha1.Session) *gin.Engine {
+	apiServer := httptest.NewServer(newFakeAPIServer(t, sessions...))
+	t.Cleanup(apiServer.Close)
+
+	handler := newTestHandler(t, apiServer)
+	handler.limits = &LimitsConfig{MaxSessionsPerTenant: 2, Tenants: map[string]TenantLimits{"acme": {MaxSessions: 1}}}
+	handler.config.Store(&clusterConfig{
+		clusterClientMap: map[string]*k8sClient.SessionClient{mainCluster: newTestClient(t, apiServer)},
+		fileTemplates: map[string]*SessionTemplate{
+			"demo": {Name: "demo", Version: 1, SessionTemplateSpec: sessionv1alpha1.SessionTemplateSpec{
+				MaxSessions: 2,
+			}},
+			"open": {Name: "open", Version: 1},
+		},
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(auth.Authenticate([]auth.Authenticator{tenantAuthenticator{}}))
+	router.POST("/session", handler.CreateSession)
+
+	return router
+}
+
+// createSession creates a session of the template as the tenant, and returns the response status and error
+func createSession(
+	router *gin.Engine,
+	tenant string,
+	key string,
+	body api.RegisterSessionBody,
+) (int, api.ErrorResponse) {
+
+	data, _ := json.Marshal(body)
+
+	request := httptest.NewRequest(http.MethodPost, "/session", bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", tenant)
+	if key != "" {
+		request.Header.Set(api.IdempotencyKeyHeader, key)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	var response api.ErrorResponse
+	_ = json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response
+}
+
+func TestSessionQuotas(t *testing.T) {
+	existing := []*sessionv1alpha1.Session{
+		quotaSession("demo-a", "demo", "globex"),
+		quotaSession("demo-b", "demo", "initech"),
+		quotaSession("open-a", "open", "acme"),
+		quotaSession("open-b", "open", "initech"),
+	}
+
+	tests := []struct {
+		name     string
+		tenant   string
+		template string
+		code     int
+		reason   api.RejectionReason
+	}{
+		{"template with its maxSessions", "hooli", "demo", http.StatusTooManyRequests, api.TemplateQuotaExceeded},
+		{"tenant with its own limit", "acme", "open", http.StatusTooManyRequests, api.TenantQuotaExceeded},
+		{"tenant with the default limit", "initech", "open", http.StatusTooManyRequests, api.TenantQuotaExceeded},
+		{"tenant below the default limit", "globex", "open", http.StatusCreated, ""},
+		{"tenant without sessions", "hooli", "open", http.StatusCreated, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := newQuotaRouter(t, existing...)
+
+			code, response := createSession(router, test.tenant, "",
+				api.RegisterSessionBody{TemplateName: test.template, SessionPodsCluster: mainCluster})
+
+			if code != test.code || response.Reason != test.reason {
+				t.Errorf("expected %d %s, got %d %s %s", test.code, test.reason, code, response.Reason, response.Error)
+			}
+		})
+	}
+}
+
+// A repeated creation is not rejected by the quota its own session uses
+func TestSessionQuotasIdempotentReplay(t *testing.T) {
+	router := newQuotaRouter(t)
+	body := api.RegisterSessionBody{TemplateName: "open", SessionPodsCluster: mainCluster}
+
+	if code, response := createSession(router, "acme", "key-1", body); code != http.StatusCreated {
+		t.Fatalf("expected the session to be created, got %d %s", code, response.Error)
+	}
+	if code, response := createSession(router, "acme", "key-1", body); code != http.StatusCreated {
+		t.Errorf("expected the creation to be replayed, got %d %s", code, response.Error)
+	}
+	if code, response := createSession(router, "acme", "key-2", body); response.Reason != api.TenantQuotaExceeded {
+		t.Errorf("expected another session to exceed the quota of acme, got %d %s", code, response.Error)
+	}
+}
+
+func cpuRequests(cpu string) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}}
+}
+
+func TestClusterCapacity(t *testing.T) {
+	viewer := sessionv1alpha1.ClientPodTemplate{MaxClients: 2, PodTemplate: corev1.PodTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "viewer"},
+		Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "viewer", Resources: cpuRequests("500m")}},
+		}},
+	}}
+
+	capacity := func(allocatable string, requested string) *api.ClusterCapacity {
+		return &api.ClusterCapacity{
+			Allocatable: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(allocatable)},
+			Requested:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(requested)},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		capacity *api.ClusterCapacity
+		// clients of the existing client pods
+		pods     map[string]int
+		rejected bool
+	}{
+		{"room left", true, capacity("4", "3"), nil, false},
+		{"exactly enough", true, capacity("4", "3500m"), nil, false},
+		{"not enough", true, capacity("4", "3600m"), nil, true},
+		{"free client pod", true, capacity("4", "4"), map[string]int{"demo-viewer-aaaa": 1}, false},
+		{"full client pod", true, capacity("4", "4"), map[string]int{"demo-viewer-aaaa": 2}, true},
+		{"pod of another session", true, capacity("4", "4"), map[string]int{"lobby-viewer-aaaa": 0}, true},
+		{"not probed", true, nil, nil, false},
+		{"disabled", false, capacity("4", "4"), nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := &Handler{limits: &LimitsConfig{ClusterCapacity: test.enabled}, prober: newClusterProber()}
+			if test.capacity != nil {
+				handler.prober.results[mainCluster] = api.ClusterHealth{Cluster: mainCluster, Healthy: true,
+					Capacity: test.capacity}
+			}
+
+			occupancy := &sessionOccupancy{
+				name:       "demo",
+				templates:  []sessionv1alpha1.ClientPodTemplate{viewer},
+				podClients: map[string]map[string]int{mainCluster: test.pods},
+			}
+
+			err := handler.checkClusterCapacity(mainCluster, occupancy)
+			if !test.rejected {
+				if err != nil {
+					t.Errorf("expected the client to fit, got %v", err)
+				}
+				return
+			}
+
+			if reason := rejectionReason(err); reason != api.InsufficientCapacity {
+				t.Fatalf("expected %s, got %v", api.InsufficientCapacity, err)
+			}
+			if status := err.(*rejection).status; status != http.StatusTooManyRequests {
+				t.Errorf("expected 429, got %d", status)
+			}
+		})
+	}
+}
+
+// A join the cluster cannot fit is answered with a 429 and its reason
+func TestCreateClientInsufficientCapacity(t *testing.T) {
+	apiServer := httptest.NewServer(newFakeAPIServer(t, &sessionv1alpha1.Session{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec: sessionv1alpha1.SessionSpec{
+			Clients: map[string]bool{},
+			ClientPodTemplates: sessionv1alpha1.ClientPodTemplateList{Items: []sessionv1alpha1.ClientPodTemplate{{
+				MaxClients: 1,
+				PodTemplate: corev1.PodTemplate{
+					ObjectMeta: metav1.ObjectMeta{Name: "viewer"},
+					Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "viewer", Resources: cpuRequests("2")}},
+					}},
+				},
+			}}},
+		},
+	}))
+	defer apiServer.Close()
+
+	handler := newTestHandler(t, apiServer)
+	handler.limits = &LimitsConfig{ClusterCapacity: true}
+	handler.prober.results[mainCluster] = api.ClusterHealth{Cluster: mainCluster, Healthy: true,
+		Capacity: &api.ClusterCapacity{
+			Allocatable: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")},
+			Requested:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("3")},
+		}}
+
+	data, _ := json.Marshal(api.CreateClientBody{ClientId: "alice", Cluster: mainCluster})
+	request := httptest.NewRequest(http.MethodPost, "/session/demo/client", bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	newTestRouter(handler).ServeHTTP(recorder, request)
+
+	var response api.ErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusTooManyRequests || response.Reason != api.InsufficientCapacity {
+		t.Errorf("expected 429 %s, got %d %s %s", api.InsufficientCapacity, recorder.Code, response.Reason,
+			response.Error)
+	}
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	stdErrors "errors"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"mr.telepresence/session-manager/api"
+	k8sClient "mr.telepresence/session-manager/k8s-client"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+// Label holding the name of the template a session was created from
+const templateLabel = "mr.telepresence/template"
+
+// Label holding the version of the template a session was created from
+const templateVersionLabel = "mr.telepresence/template-version"
+
+var errInvalidContinue = stdErrors.New("invalid continue token")
+
+func errorIsInvalidContinue(err error) bool {
+	return stdErrors.Is(err, errInvalidContinue)
+}
+
+// clusterCursor is the position of a listing in one cluster: the Kubernetes continue token of the page to list next,
+// and the last session name already returned from that page
+type clusterCursor struct {
+	Continue string `json:"continue,omitempty"`
+	After    string `json:"after,omitempty"`
+	Done     bool   `json:"done,omitempty"`
+}
+
+func encodeContinue(cursor interface{}) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeContinue(token string, cursor interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return errInvalidContinue
+	}
+
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return errInvalidContinue
+	}
+
+	return nil
+}
+
+// listSelector combines the label selector of the query with the template filter
+func listSelector(query api.ListSessionsQuery) (string, error) {
+	selector, err := labels.Parse(query.LabelSelector)
+	if err != nil {
+		return "", err
+	}
+
+	if query.Template != "" {
+		requirement, err := labels.NewRequirement(templateLabel, selection.Equals, []string{query.Template})
+		if err != nil {
+			return "", err
+		}
+		selector = selector.Add(*requirement)
+	}
+
+	return selector.String(), nil
+}
+
+// listSessionsPage lists a page of the sessions of every cluster, grouped by name. Kubernetes returns sessions in
+// name order, so the page stops at the lowest last name among the clusters with more to list, and the clusters that
+// listed past it list the same page again next time, skipping what was already returned. The returned continue token
+// is empty on the last page.
+func listSessionsPage(
+	ctx context.Context,
+	clusterClientMap map[string]*k8sClient.SessionClient,
+	limit int64,
+	token string,
+	selector string,
+) (map[string]map[string]*sessionv1alpha1.Session, string, error) {
+
+	cursors := make(map[string]clusterCursor)
+	if token != "" {
+		if err := decodeContinue(token, &cursors); err != nil {
+			return nil, "", err
+		}
+	}
+
+	pages := make(map[string]*sessionv1alpha1.SessionList, len(clusterClientMap))
+	cutoff := ""
+	bounded := false
+
+	for cluster, clusterClient := range clusterClientMap {
+		if cursors[cluster].Done {
+			continue
+		}
+
+		opts := metav1.ListOptions{LabelSelector: selector, Limit: limit, Continue: cursors[cluster].Continue}
+		sessions, err := clusterClient.Sessions("default").List(opts, ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		pages[cluster] = sessions
+
+		if sessions.Continue != "" {
+			last := ""
+			if n := len(sessions.Items); n > 0 {
+				last = sessions.Items[n-1].Name
+			}
+
+			if !bounded || last < cutoff {
+				cutoff = last
+				bounded = true
+			}
+		}
+	}
+
+	sessionsCopies := make(map[string]map[string]*sessionv1alpha1.Session)
+	next := make(map[string]clusterCursor, len(clusterClientMap))
+	more := false
+
+	for cluster := range clusterClientMap {
+		cursor := cursors[cluster]
+
+		sessions, ok := pages[cluster]
+		if !ok {
+			next[cluster] = cursor
+			continue
+		}
+
+		remaining := false
+		for i := range sessions.Items {
+			session := &sessions.Items[i]
+
+			if session.Name <= cursor.After {
+				continue
+			}
+			if bounded && session.Name > cutoff {
+				remaining = true
+				continue
+			}
+
+			if _, ok := sessionsCopies[session.Name]; !ok {
+				sessionsCopies[session.Name] = make(map[string]*sessionv1alpha1.Session)
+			}
+			sessionsCopies[session.Name][cluster] = session
+		}
+
+		switch {
+		case remaining:
+			after := cutoff
+			if cursor.After > after {
+				after = cursor.After
+			}
+			next[cluster] = clusterCursor{Continue: cursor.Continue, After: after}
+
+		case sessions.Continue != "":
+			next[cluster] = clusterCursor{Continue: sessions.Continue}
+
+		default:
+			next[cluster] = clusterCursor{Done: true}
+		}
+
+		more = more || !next[cluster].Done
+	}
+
+	if !more {
+		return sessionsCopies, "", nil
+	}
+
+	nextToken, err := encodeContinue(next)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return sessionsCopies, nextToken, nil
+}
+
+// listError answers a failed listing: a bad continue token is the caller's fault, an expired one must be dropped.
+// The API server rejects the Kubernetes continue tokens carried by the token as bad requests when they were tampered
+// with.
+func listError(ctx *gin.Context, err error) {
+	if errorIsInvalidContinue(err) || errors.IsBadRequest(err) {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+
+	} else if errors.IsResourceExpired(err) || errors.IsGone(err) {
+		ctx.JSON(http.StatusGone, api.ErrorResponse{Error: err.Error()})
+
+	} else {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+	}
+}
+
+// sessionLocation renders a listed session, returning false when it is filtered out by its phase
+func sessionLocation(
+	ctx *gin.Context,
+	query api.ListSessionsQuery,
+	session *sessionv1alpha1.Session,
+	placement api.SessionPlacement,
+) (api.SessionLocation, bool) {
+
+	summary := api.SummarizeSession(session)
+	if query.Phase != "" && summary.Phase != query.Phase {
+		return api.SessionLocation{}, false
+	}
+
+	location := api.SessionLocation{
+		Session:            session.Name,
+		URI:                ctx.Request.URL.Path + "/" + session.Name,
+		Clusters:           placement.Clusters,
+		SessionPodsCluster: placement.SessionPodsCluster,
+		Divergent:          len(placement.Divergences) > 0,
+	}
+
+	if query.IncludeStatus {
+		location.Status = &summary
+	}
+
+	return location, true
+}
+
+// renderClientsPage answers GET /v1/session/:sessionId/client with a page of the clients of a session in id order.
+// The continue token holds the last id returned.
+func renderClientsPage(ctx *gin.Context, session *sessionv1alpha1.Session) {
+	var query api.ListClientsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	after := ""
+	if query.Continue != "" {
+		if err := decodeContinue(query.Continue, &after); err != nil {
+			listError(ctx, err)
+			return
+		}
+	}
+
+	clientIds := make([]string, 0, len(session.Spec.Clients))
+	for clientId := range session.Spec.Clients {
+		if clientId > after {
+			clientIds = append(clientIds, clientId)
+		}
+	}
+	sort.Strings(clientIds)
+
+	if query.Limit > 0 && int64(len(clientIds)) > query.Limit {
+		clientIds = clientIds[:query.Limit]
+
+		next, err := encodeContinue(clientIds[len(clientIds)-1])
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+		ctx.Header(api.ContinueHeader, next)
+	}
+
+	clientsLocation := make([]api.ClientLocation, 0, len(clientIds))
+	for _, clientId := range clientIds {
+		location := api.ClientLocation{
+			Client: clientId,
+			URI:    ctx.Request.URL.Path + "/" + clientId,
+		}
+
+		if query.IncludeStatus {
+			location.Status = &api.ClientSummary{
+				Connected: session.Spec.Clients[clientId],
+				Ready:     session.Status.Clients[clientId].Ready,
+			}
+		}
+
+		clientsLocation = append(clientsLocation, location)
+	}
+
+	ctx.JSON(http.StatusOK, clientsLocation)
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"mr.telepresence/session-manager/api"
+	k8sClient "mr.telepresence/session-manager/k8s-client"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+// listedSession is a session of the demo template, or of the other template when other is set. Sessions with a
+// connected client that is not ready yet are Pending.
+func listedSession(name string, other bool, pending bool) *sessionv1alpha1.Session {
+	template := "demo"
+	if other {
+		template = "other"
+	}
+
+	session := &sessionv1alpha1.Session{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       sessionv1alpha1.SessionSpec{Clients: map[string]bool{}},
+	}
+	session.Labels = map[string]string{templateLabel: template}
+	if pending {
+		session.Spec.Clients["headset-1"] = true
+	}
+
+	return session
+}
+
+// newListingRouter serves GET /session from a main and an edge cluster holding the given sessions
+func newListingRouter(t *testing.T, main []*sessionv1alpha1.Session, edge []*sessionv1alpha1.Session) *gin.Engine {
+	mainServer := httptest.NewServer(newFakeAPIServer(t, main...))
+	t.Cleanup(mainServer.Close)
+	edgeServer := httptest.NewServer(newFakeAPIServer(t, edge...))
+	t.Cleanup(edgeServer.Close)
+
+	handler := newTestHandler(t, mainServer)
+	handler.config.Store(&clusterConfig{clusterClientMap: map[string]*k8sClient.SessionClient{
+		mainCluster: newTestClient(t, mainServer),
+		"edge":      newTestClient(t, edgeServer),
+	}})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/session", handler.GetSessions)
+
+	return router
+}
+
+// listAll pages through the sessions with the query, and returns the sessions listed and the continue tokens
+func listAll(t *testing.T, router *gin.Engine, query url.Values) ([]api.SessionLocation, []string) {
+	var locations []api.SessionLocation
+	var tokens []string
+
+	for page := 0; ; page++ {
+		if page > 20 {
+			t.Fatal("the listing does not end")
+		}
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/session?"+query.Encode(), nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%d %s", recorder.Code, recorder.Body.String())
+		}
+
+		var pageLocations []api.SessionLocation
+		if err := json.Unmarshal(recorder.Body.Bytes(), &pageLocations); err != nil {
+			t.Fatal(err)
+		}
+		locations = append(locations, pageLocations...)
+
+		token := recorder.Header().Get(api.ContinueHeader)
+		if token == "" {
+			return locations, tokens
+		}
+		tokens = append(tokens, token)
+		query.Set("continue", token)
+	}
+}
+
+func sessionNames(locations []api.SessionLocation) []string {
+	names := make([]string, 0, len(locations))
+	for _, location := range locations {
+		names = append(names, location.Session)
+	}
+	return names
+}
+
+func TestListSessionsPaging(t *testing.T) {
+	main := []*sessionv1alpha1.Session{
+		listedSession("alpha", false, false), listedSession("bravo", false, false),
+		listedSession("charlie", true, false), listedSession("delta", false, true),
+		listedSession("echo", true, true), listedSession("foxtrot", false, false),
+	}
+
+	tests := []struct {
+		name     string
+		edge     []*sessionv1alpha1.Session
+		limit    string
+		expected []string
+	}{
+		{"uneven clusters", []*sessionv1alpha1.Session{listedSession("bravo", false, false),
+			listedSession("golf", false, false)}, "2",
+			[]string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf"}},
+		{"one at a time", []*sessionv1alpha1.Session{listedSession("bravo", false, false),
+			listedSession("golf", false, false)}, "1",
+			[]string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf"}},
+		{"cluster exhausted mid-page", []*sessionv1alpha1.Session{listedSession("bravo", false, false)}, "3",
+			[]string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot"}},
+		{"empty cluster", nil, "4", []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot"}},
+		{"without limit", []*sessionv1alpha1.Session{listedSession("golf", false, false)}, "",
+			[]string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := newListingRouter(t, main, test.edge)
+
+			query := url.Values{}
+			if test.limit != "" {
+				query.Set("limit", test.limit)
+			}
+
+			locations, tokens := listAll(t, router, query)
+			if names := sessionNames(locations); !reflect.DeepEqual(names, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, names)
+			}
+
+			// the copies of a session are merged even when the clusters list them in different pages
+			for _, location := range locations {
+				if location.Session == "bravo" && len(test.edge) != 0 && test.edge[0].Name == "bravo" &&
+					len(location.Clusters) != 2 {
+
+					t.Errorf("expected bravo to be found in both clusters, got %v", location.Clusters)
+				}
+			}
+
+			if test.limit == "" && len(tokens) != 0 {
+				t.Errorf("expected a single page, got %d continue tokens", len(tokens))
+			}
+		})
+	}
+}
+
+// An edge cluster listed entirely in the first page is not listed again
+func TestListSessionsExhaustedCluster(t *testing.T) {
+	router := newListingRouter(t, []*sessionv1alpha1.Session{
+		listedSession("alpha", false, false), listedSession("bravo", false, false),
+		listedSession("charlie", false, false), listedSession("delta", false, false),
+	}, []*sessionv1alpha1.Session{listedSession("bravo", false, false)})
+
+	_, tokens := listAll(t, router, url.Values{"limit": {"2"}})
+	if len(tokens) == 0 {
+		t.Fatal("expected several pages")
+	}
+
+	cursors := make(map[string]clusterCursor)
+	if err := decodeContinue(tokens[0], &cursors); err != nil {
+		t.Fatal(err)
+	}
+	if !cursors["edge"].Done || cursors[mainCluster].Done {
+		t.Errorf("expected only edge to be done after the first page, got %+v", cursors)
+	}
+}
+
+func TestListSessionsFiltersAndPaging(t *testing.T) {
+	router := newListingRouter(t, []*sessionv1alpha1.Session{
+		listedSession("alpha", false, false), listedSession("bravo", true, false),
+		listedSession("charlie", false, true), listedSession("delta", true, true),
+		listedSession("echo", false, false),
+	}, []*sessionv1alpha1.Session{
+		listedSession("bravo", true, false), listedSession("foxtrot", false, true),
+		listedSession("golf", true, false),
+	})
+
+	tests := []struct {
+		name     string
+		query    url.Values
+		expected []string
+	}{
+		{"template", url.Values{"template": {"demo"}}, []string{"alpha", "charlie", "echo", "foxtrot"}},
+		{"label selector", url.Values{"labelSelector": {templateLabel + "=other"}},
+			[]string{"bravo", "delta", "golf"}},
+		{"phase", url.Values{"phase": {"Pending"}}, []string{"charlie", "delta", "foxtrot"}},
+		{"template and phase", url.Values{"template": {"demo"}, "phase": {"Ready"}}, []string{"alpha", "echo"}},
+	}
+
+	for _, test := range tests {
+		for _, limit := range []string{"1", "2", ""} {
+			t.Run(test.name+" limit "+limit, func(t *testing.T) {
+				query := url.Values{}
+				for key, values := range test.query {
+					query[key] = values
+				}
+				if limit != "" {
+					query.Set("limit", limit)
+				}
+
+				locations, _ := listAll(t, router, query)
+				if names := sessionNames(locations); !reflect.DeepEqual(names, test.expected) {
+					t.Errorf("expected %v, got %v", test.expected, names)
+				}
+			})
+		}
+	}
+}
+
+func TestListSessionsInvalidContinue(t *testing.T) {
+	router := newListingRouter(t, []*sessionv1alpha1.Session{listedSession("alpha", false, false)}, nil)
+
+	encode := func(value string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"not base64", "not a token!"},
+		{"not json", encode("alpha")},
+		{"not cursors", encode(`["alpha"]`)},
+		{"tampered kubernetes token", encode(`{"` + mainCluster + `":{"continue":"%%%"}}`)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			path := "/session?" + url.Values{"limit": {"1"}, "continue": {test.token}}.Encode()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d %s", recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"mr.telepresence/session-manager/api"
+)
+
+func GetOpenAPISpec(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "application/json", api.OpenAPISpec)
+}
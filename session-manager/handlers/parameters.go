@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+
+	stdErrors "errors"
+
+	corev1 "k8s.io/api/core/v1"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+// Template parameters are substituted for ${params.<name>} in the env values, args, images and annotations of the
+// pod templates when a session is created. The values a session was created with are kept in an annotation, so the
+// session can be rolled onto another version of its template with the same values.
+
+// Annotation holding the JSON encoded parameter values of a session
+const parametersAnnotation = "mr.telepresence/template-parameters"
+
+var parameterPattern = regexp.MustCompile(`\$\{params\.([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+var parameterNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var errInvalidParameters = stdErrors.New("invalid template parameters")
+
+func invalidParameters(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", errInvalidParameters, fmt.Sprintf(format, args...))
+}
+
+func parameterType(parameter *sessionv1alpha1.TemplateParameter) sessionv1alpha1.TemplateParameterType {
+	if parameter.Type == "" {
+		return sessionv1alpha1.StringParameter
+	}
+
+	return parameter.Type
+}
+
+// validateParameterValue checks a string value against the type of the parameter
+func validateParameterValue(parameter *sessionv1alpha1.TemplateParameter, value string) error {
+	switch parameterType(parameter) {
+	case sessionv1alpha1.IntegerParameter:
+		if _, err := strconv.Atoi(value); err != nil {
+			return invalidParameters("parameter %s must be an integer, got %q", parameter.Name, value)
+		}
+
+	case sessionv1alpha1.BooleanParameter:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return invalidParameters("parameter %s must be a boolean, got %q", parameter.Name, value)
+		}
+
+	case sessionv1alpha1.StringParameter:
+
+	default:
+		return invalidParameters("parameter %s has unknown type %s", parameter.Name, parameter.Type)
+	}
+
+	return nil
+}
+
+// validateTemplateParameters checks that the parameters of a template are declared once with valid defaults, and
+// that its pod templates only refer to declared parameters
+func validateTemplateParameters(spec *sessionv1alpha1.SessionTemplateSpec) error {
+	declared := make(map[string]*sessionv1alpha1.TemplateParameter, len(spec.Parameters))
+
+	for i := range spec.Parameters {
+		parameter := &spec.Parameters[i]
+
+		if !parameterNamePattern.MatchString(parameter.Name) {
+			return invalidParameters("invalid parameter name %q", parameter.Name)
+		}
+		if _, ok := declared[parameter.Name]; ok {
+			return invalidParameters("parameter %s is declared twice", parameter.Name)
+		}
+		declared[parameter.Name] = parameter
+
+		if parameter.Default != nil {
+			if err := validateParameterValue(parameter, *parameter.Default); err != nil {
+				return err
+			}
+		}
+	}
+
+	var err error
+	visitParameterFields(spec, func(field string) string {
+		for _, match := range parameterPattern.FindAllStringSubmatch(field, -1) {
+			if _, ok := declared[match[1]]; !ok && err == nil {
+				err = invalidParameters("parameter %s is used but not declared", match[1])
+			}
+		}
+		return field
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, template := range spec.ClientPodTemplates.Items {
+		if template.MaxClientsParameter == "" {
+			continue
+		}
+
+		parameter, ok := declared[template.MaxClientsParameter]
+		if !ok || parameterType(parameter) != sessionv1alpha1.IntegerParameter {
+			return invalidParameters("maxClientsParameter of client pod template %s must be an integer parameter",
+				template.Name)
+		}
+	}
+
+	return nil
+}
+
+// resolveParameters returns the value of every parameter of the template, taken from the given values or from the
+// defaults. Values may be strings, numbers or booleans.
+func resolveParameters(
+	spec *sessionv1alpha1.SessionTemplateSpec,
+	values map[string]interface{},
+) (map[string]string, error) {
+
+	resolved := make(map[string]string, len(spec.Parameters))
+	declared := make(map[string]struct{}, len(spec.Parameters))
+
+	for i := range spec.Parameters {
+		parameter := &spec.Parameters[i]
+		declared[parameter.Name] = struct{}{}
+
+		raw, ok := values[parameter.Name]
+		if !ok || raw == nil {
+			if parameter.Default == nil {
+				return nil, invalidParameters("missing required parameter %s", parameter.Name)
+			}
+
+			resolved[parameter.Name] = *parameter.Default
+			continue
+		}
+
+		value, err := formatParameterValue(parameter, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := validateParameterValue(parameter, value); err != nil {
+			return nil, err
+		}
+
+		resolved[parameter.Name] = value
+	}
+
+	unknown := []string{}
+	for name := range values {
+		if _, ok := declared[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) != 0 {
+		sort.Strings(unknown)
+		return nil, invalidParameters("unknown parameters %v", unknown)
+	}
+
+	return resolved, nil
+}
+
+func formatParameterValue(parameter *sessionv1alpha1.TemplateParameter, raw interface{}) (string, error) {
+	switch value := raw.(type) {
+	case string:
+		return value, nil
+
+	case bool:
+		return strconv.FormatBool(value), nil
+
+	case float64:
+		// only integer parameters require a whole number, validateParameterValue checks the rest of their type
+		if parameterType(parameter) == sessionv1alpha1.IntegerParameter && value != math.Trunc(value) {
+			return "", invalidParameters("parameter %s must be an integer, got %v", parameter.Name, value)
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+
+	case json.Number:
+		return value.String(), nil
+
+	default:
+		return "", invalidParameters("parameter %s must be a string, a number or a boolean", parameter.Name)
+	}
+}
+
+// applyParameters returns a copy of the template spec with the parameters substituted
+func applyParameters(
+	spec *sessionv1alpha1.SessionTemplateSpec,
+	values map[string]string,
+) *sessionv1alpha1.SessionTemplateSpec {
+
+	applied := spec.DeepCopy()
+
+	visitParameterFields(applied, func(field string) string {
+		return parameterPattern.ReplaceAllStringFunc(field, func(placeholder string) string {
+			return values[parameterPattern.FindStringSubmatch(placeholder)[1]]
+		})
+	})
+
+	for i := range applied.ClientPodTemplates.Items {
+		template := &applied.ClientPodTemplates.Items[i]
+
+		if template.MaxClientsParameter != "" {
+			// the value was validated as an integer when resolved
+			template.MaxClients, _ = strconv.Atoi(values[template.MaxClientsParameter])
+			template.MaxClientsParameter = ""
+		}
+	}
+
+	return applied
+}
+
+// visitParameterFields calls visit on every field parameters may be substituted in, replacing it with the result
+func visitParameterFields(spec *sessionv1alpha1.SessionTemplateSpec, visit func(string) string) {
+	for i := range spec.SessionPodTemplates.Items {
+		visitPodTemplateFields(&spec.SessionPodTemplates.Items[i], visit)
+	}
+
+	for i := range spec.ClientPodTemplates.Items {
+		visitPodTemplateFields(&spec.ClientPodTemplates.Items[i].PodTemplate, visit)
+	}
+}
+
+func visitPodTemplateFields(template *corev1.PodTemplate, visit func(string) string) {
+	for key, value := range template.Template.Annotations {
+		template.Template.Annotations[key] = visit(value)
+	}
+
+	podSpec := &template.Template.Spec
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for i := range containers {
+			container := &containers[i]
+			container.Image = visit(container.Image)
+
+			for j := range container.Args {
+				container.Args[j] = visit(container.Args[j])
+			}
+
+			for j := range container.Env {
+				container.Env[j].Value = visit(container.Env[j].Value)
+			}
+		}
+	}
+}
+
+// parametersAnnotationValue encodes the values a session is created with
+func parametersAnnotationValue(values map[string]string) (string, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// sessionParameters decodes the values a session was created with, sessions created before parameters existed have
+// none
+func sessionParameters(annotations map[string]string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	encoded, ok := annotations[parametersAnnotation]
+	if !ok {
+		return values, nil
+	}
+
+	if err := json.Unmarshal([]byte(encoded), &values); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", parametersAnnotation, err)
+	}
+
+	return values, nil
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	stdErrors "errors"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"mr.telepresence/session-manager/api"
+	k8sClient "mr.telepresence/session-manager/k8s-client"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+func parameterizedSpec() *sessionv1alpha1.SessionTemplateSpec {
+	return &sessionv1alpha1.SessionTemplateSpec{
+		Parameters: []sessionv1alpha1.TemplateParameter{
+			{Name: "map"},
+			{Name: "players", Type: sessionv1alpha1.IntegerParameter, Default: stringPointer("4")},
+			{Name: "debug", Type: sessionv1alpha1.BooleanParameter, Default: stringPointer("false")},
+			{Name: "tag", Default: stringPointer("latest")},
+		},
+		SessionPodTemplates: corev1.PodTemplateList{Items: []corev1.PodTemplate{{
+			ObjectMeta: metav1.ObjectMeta{Name: "server"},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"map": "${params.map}"}},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "fetch", Image: "fetch:1",
+						Args: []string{"--map=${params.map}"}}},
+					Containers: []corev1.Container{{
+						Name:  "server",
+						Image: "server:${params.tag}",
+						Args:  []string{"--players", "${params.players}", "--unchanged"},
+						Env:   []corev1.EnvVar{{Name: "DEBUG", Value: "${params.debug}"}},
+					}},
+				},
+			},
+		}}},
+		ClientPodTemplates: sessionv1alpha1.ClientPodTemplateList{Items: []sessionv1alpha1.ClientPodTemplate{{
+			MaxClientsParameter: "players",
+			PodTemplate: corev1.PodTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "viewer"},
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "viewer", Image: "viewer:${params.tag}"}},
+				}},
+			},
+		}}},
+	}
+}
+
+func TestResolveParameters(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[string]interface{}
+		expected map[string]string
+	}{
+		{"defaults", map[string]interface{}{"map": "harbor"},
+			map[string]string{"map": "harbor", "players": "4", "debug": "false", "tag": "latest"}},
+		{"given values", map[string]interface{}{"map": "harbor", "players": float64(8), "debug": true, "tag": "v2"},
+			map[string]string{"map": "harbor", "players": "8", "debug": "true", "tag": "v2"}},
+		{"integer as a string", map[string]interface{}{"map": "harbor", "players": "8"},
+			map[string]string{"map": "harbor", "players": "8", "debug": "false", "tag": "latest"}},
+		{"null value takes the default", map[string]interface{}{"map": "harbor", "players": nil},
+			map[string]string{"map": "harbor", "players": "4", "debug": "false", "tag": "latest"}},
+		{"number for a string parameter", map[string]interface{}{"map": float64(1.5), "tag": float64(2)},
+			map[string]string{"map": "1.5", "players": "4", "debug": "false", "tag": "2"}},
+		{"missing required parameter", map[string]interface{}{"players": float64(8)}, nil},
+		{"fractional integer", map[string]interface{}{"map": "harbor", "players": float64(1.5)}, nil},
+		{"integer too large", map[string]interface{}{"map": "harbor", "players": float64(1e21)}, nil},
+		{"string for an integer parameter", map[string]interface{}{"map": "harbor", "players": "many"}, nil},
+		{"string for a boolean parameter", map[string]interface{}{"map": "harbor", "debug": "yes"}, nil},
+		{"object value", map[string]interface{}{"map": map[string]interface{}{"name": "harbor"}}, nil},
+		{"unknown parameter", map[string]interface{}{"map": "harbor", "mode": "ranked"}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolved, err := resolveParameters(parameterizedSpec(), test.values)
+			if test.expected == nil {
+				if !stdErrors.Is(err, errInvalidParameters) {
+					t.Fatalf("expected the values to be rejected, got %v and %v", resolved, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(resolved, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, resolved)
+			}
+		})
+	}
+}
+
+func TestApplyParameters(t *testing.T) {
+	spec := parameterizedSpec()
+	applied := applyParameters(spec, map[string]string{"map": "harbor", "players": "8", "debug": "true", "tag": "v2"})
+
+	server := applied.SessionPodTemplates.Items[0].Template
+	if annotation := server.Annotations["map"]; annotation != "harbor" {
+		t.Errorf("expected the annotation to be substituted, got %s", annotation)
+	}
+	if args := server.Spec.InitContainers[0].Args; !reflect.DeepEqual(args, []string{"--map=harbor"}) {
+		t.Errorf("expected the args of init containers to be substituted, got %v", args)
+	}
+
+	container := server.Spec.Containers[0]
+	if container.Image != "server:v2" {
+		t.Errorf("expected the image to be substituted, got %s", container.Image)
+	}
+	if !reflect.DeepEqual(container.Args, []string{"--players", "8", "--unchanged"}) {
+		t.Errorf("expected the args to be substituted, got %v", container.Args)
+	}
+	if container.Env[0].Value != "true" {
+		t.Errorf("expected the env value to be substituted, got %s", container.Env[0].Value)
+	}
+
+	viewer := applied.ClientPodTemplates.Items[0]
+	if image := viewer.Template.Spec.Containers[0].Image; image != "viewer:v2" {
+		t.Errorf("expected the image of client pods to be substituted, got %s", image)
+	}
+	if viewer.MaxClients != 8 || viewer.MaxClientsParameter != "" {
+		t.Errorf("expected maxClients to be resolved to 8, got %d from %q", viewer.MaxClients,
+			viewer.MaxClientsParameter)
+	}
+
+	// the template itself is left untouched
+	if !reflect.DeepEqual(spec, parameterizedSpec()) {
+		t.Error("expected the template spec not to be modified")
+	}
+}
+
+// Invalid parameter values are rejected before anything is created
+func TestCreateSessionInvalidParameters(t *testing.T) {
+	apiServer := httptest.NewServer(newFakeAPIServer(t))
+	defer apiServer.Close()
+
+	handler := newTestHandler(t, apiServer)
+	handler.config.Store(&clusterConfig{
+		clusterClientMap: map[string]*k8sClient.SessionClient{mainCluster: newTestClient(t, apiServer)},
+		fileTemplates: map[string]*SessionTemplate{
+			"demo": {Name: "demo", Version: 1, SessionTemplateSpec: *parameterizedSpec()},
+		},
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/session", handler.CreateSession)
+
+	for _, parameters := range []map[string]interface{}{
+		{},
+		{"map": "harbor", "players": 1.5},
+		{"map": "harbor", "debug": "yes"},
+		{"map": "harbor", "mode": "ranked"},
+	} {
+		code, err := serve(router, http.MethodPost, "/session", api.RegisterSessionBody{
+			TemplateName:       "demo",
+			SessionPodsCluster: mainCluster,
+			Parameters:         parameters,
+		})
+		if code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d %v", parameters, code, err)
+		}
+	}
+}
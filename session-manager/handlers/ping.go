@@ -1,33 +1,74 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	"mr.telepresence/session-manager/api"
 )
 
+// pingServerSelector selects the services exposing the ping server in each cluster
+const pingServerSelector = "mr.telepresence/ping-server=true"
+
+// GetPingServers returns the ping server of every healthy cluster, as found by the last probe, reached over the
+// transport given by the transport query parameter (udp by default)
 func (h *Handler) GetPingServers(ctx *gin.Context) {
-	pingServers := make(map[string]string)
+	var query api.GetPingServersQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
 
-	fmt.Printf("length %d", len(h.clusterClientsetMap))
-	for cluster, clientset := range h.clusterClientsetMap {
-		svc, err := clientset.CoreV1().Services("default").Get(ctx, "udp-ping", v1.GetOptions{})
-		pingServers[cluster] = "problem getting ip"
+	pingServers := make(api.PingServersResponse)
 
-		if err != nil {
-			log.Println("cluster: ", cluster)
-			log.Println(err.Error())
+	for _, result := range h.prober.snapshot() {
+		address := result.PingServer
+		if query.Transport == api.PingTransportWebSocket {
+			address = result.PingServerWebSocket
 		}
 
-		if err == nil && len(svc.Status.LoadBalancer.Ingress) > 0 {
-			ipAddress := svc.Status.LoadBalancer.Ingress[0].IP
-
-			pingServers[cluster] = fmt.Sprintf("udp://%s:%d", ipAddress, 8080)
+		if result.Healthy && address != "" {
+			pingServers[result.Cluster] = address
 		}
 	}
 
 	ctx.JSON(http.StatusOK, pingServers)
 }
+
+// loadBalancerHost returns the IP of a load balancer, or its hostname for the load balancers only reporting one
+func loadBalancerHost(ingress corev1.LoadBalancerIngress) string {
+	if ingress.IP != "" {
+		return ingress.IP
+	}
+	return ingress.Hostname
+}
+
+// pingServerAddress returns the udp://host:port address of the first load balanced ping server service, and the
+// ws://host:port address of its WebSocket port if it exposes one
+func pingServerAddress(svcs []corev1.Service) (string, string, error) {
+	for _, svc := range svcs {
+		if len(svc.Status.LoadBalancer.Ingress) == 0 {
+			continue
+		}
+
+		host := loadBalancerHost(svc.Status.LoadBalancer.Ingress[0])
+
+		var udpAddress, wsAddress string
+		for _, port := range svc.Spec.Ports {
+			if port.Protocol == corev1.ProtocolUDP && (port.Name == "udp" || len(svc.Spec.Ports) == 1) {
+				udpAddress = fmt.Sprintf("udp://%s:%d", host, port.Port)
+			} else if port.Protocol == corev1.ProtocolTCP && port.Name == "ws" {
+				wsAddress = fmt.Sprintf("ws://%s:%d", host, port.Port)
+			}
+		}
+
+		if udpAddress != "" {
+			return udpAddress, wsAddress, nil
+		}
+	}
+
+	return "", "", errors.New("no ping server address found")
+}
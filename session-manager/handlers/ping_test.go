@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	"mr.telepresence/session-manager/api"
+)
+
+func pingService(ingress corev1.LoadBalancerIngress, ports ...corev1.ServicePort) corev1.Service {
+	svc := corev1.Service{Spec: corev1.ServiceSpec{Ports: ports}}
+	svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{ingress}
+	return svc
+}
+
+func TestPingServerAddress(t *testing.T) {
+	udp := corev1.ServicePort{Name: "udp", Protocol: corev1.ProtocolUDP, Port: 8080}
+	ws := corev1.ServicePort{Name: "ws", Protocol: corev1.ProtocolTCP, Port: 8081}
+	metrics := corev1.ServicePort{Name: "metrics", Protocol: corev1.ProtocolTCP, Port: 9090}
+	echo := corev1.ServicePort{Protocol: corev1.ProtocolUDP, Port: 7}
+	ip := corev1.LoadBalancerIngress{IP: "10.0.0.1"}
+
+	tests := []struct {
+		name      string
+		svcs      []corev1.Service
+		address   string
+		wsAddress string
+	}{
+		{"udp and ws", []corev1.Service{pingService(ip, udp, ws)}, "udp://10.0.0.1:8080", "ws://10.0.0.1:8081"},
+		{"udp only", []corev1.Service{pingService(ip, udp, metrics)}, "udp://10.0.0.1:8080", ""},
+		{"unnamed udp port", []corev1.Service{pingService(ip, echo)}, "udp://10.0.0.1:7", ""},
+		{"hostname", []corev1.Service{pingService(corev1.LoadBalancerIngress{Hostname: "ping.example"}, udp, ws)},
+			"udp://ping.example:8080", "ws://ping.example:8081"},
+		{"first load balanced service", []corev1.Service{{Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{udp}}},
+			pingService(ip, udp)}, "udp://10.0.0.1:8080", ""},
+		{"ws only", []corev1.Service{pingService(ip, ws)}, "", ""},
+		{"none", nil, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			address, wsAddress, err := pingServerAddress(test.svcs)
+			if test.address == "" {
+				if err == nil {
+					t.Fatalf("expected no address to be found, got %s and %s", address, wsAddress)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if address != test.address || wsAddress != test.wsAddress {
+				t.Errorf("expected %q and %q, got %q and %q", test.address, test.wsAddress, address, wsAddress)
+			}
+		})
+	}
+}
+
+func TestGetPingServers(t *testing.T) {
+	handler := &Handler{prober: newClusterProber()}
+	handler.prober.results = map[string]api.ClusterHealth{
+		"main": {Cluster: "main", Healthy: true, PingServer: "udp://10.0.0.1:8080",
+			PingServerWebSocket: "ws://10.0.0.1:8081"},
+		"edge-1": {Cluster: "edge-1", Healthy: true, PingServer: "udp://10.0.0.2:8080"},
+		"edge-2": {Cluster: "edge-2", PingServer: "udp://10.0.0.3:8080", PingServerWebSocket: "ws://10.0.0.3:8081"},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ping", handler.GetPingServers)
+
+	tests := []struct {
+		query    string
+		code     int
+		expected api.PingServersResponse
+	}{
+		{"", http.StatusOK, api.PingServersResponse{"main": "udp://10.0.0.1:8080", "edge-1": "udp://10.0.0.2:8080"}},
+		{"?transport=udp", http.StatusOK,
+			api.PingServersResponse{"main": "udp://10.0.0.1:8080", "edge-1": "udp://10.0.0.2:8080"}},
+		{"?transport=websocket", http.StatusOK, api.PingServersResponse{"main": "ws://10.0.0.1:8081"}},
+		{"?transport=tcp", http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ping"+test.query, nil))
+
+			if recorder.Code != test.code {
+				t.Fatalf("expected %d, got %d %s", test.code, recorder.Code, recorder.Body.String())
+			}
+			if test.expected == nil {
+				return
+			}
+
+			var pingServers api.PingServersResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &pingServers); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(pingServers, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, pingServers)
+			}
+		})
+	}
+}
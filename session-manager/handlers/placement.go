@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	stdErrors "errors"
+	"math"
+	"os"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const placementPath = "conf/placement/placement.yaml"
+
+type PlacementPolicy string
+
+const (
+	// LowestLatencyPolicy places the client in the cluster with the lowest reported RTT
+	LowestLatencyPolicy PlacementPolicy = "lowestLatency"
+	// LeastLoadedPolicy places the client in the cluster with the fewest connected clients among the ones
+	// whose reported RTT is under the latency threshold
+	LeastLoadedPolicy PlacementPolicy = "leastLoaded"
+	// ColocatePolicy places the client in the cluster that hosts the session pods
+	ColocatePolicy PlacementPolicy = "colocate"
+)
+
+type PlacementConfig struct {
+	Policy             PlacementPolicy `json:"policy"`
+	LatencyThresholdMs int             `json:"latencyThresholdMs"`
+}
+
+var errNoPlacement = stdErrors.New("no cluster satisfies the placement policy")
+
+func errorIsNoPlacement(err error) bool {
+	return stdErrors.Is(err, errNoPlacement)
+}
+
+func readPlacementConfig() (*PlacementConfig, error) {
+	config := &PlacementConfig{Policy: LowestLatencyPolicy}
+
+	f, err := os.ReadFile(placementPath)
+	if err != nil && stdErrors.Is(err, os.ErrNotExist) {
+		return config, nil
+
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(f, config); err != nil {
+		return nil, err
+	}
+
+	switch config.Policy {
+	case LowestLatencyPolicy, ColocatePolicy:
+	case LeastLoadedPolicy:
+		if config.LatencyThresholdMs <= 0 {
+			return nil, stdErrors.New("leastLoaded placement requires a positive latencyThresholdMs")
+		}
+	default:
+		return nil, stdErrors.New("unknown placement policy " + string(config.Policy))
+	}
+
+	return config, nil
+}
+
+// placeClient picks the cluster for a client that did not choose one, given the RTTs (in milliseconds) it
+// measured against the ping servers of each cluster
+func (h *Handler) placeClient(ctx context.Context, sessionId string, latencies map[string]int) (string, error) {
+	candidates := h.latencyCandidates(latencies)
+
+	switch h.placement.Policy {
+	case ColocatePolicy:
+		cluster, err := h.findSessionPodsCluster(ctx, sessionId)
+		if err != nil {
+			return "", err
+		}
+
+		if cluster != "" && h.prober.isHealthy(cluster) {
+			return cluster, nil
+		}
+
+	case LeastLoadedPolicy:
+		underThreshold := []string{}
+		for _, cluster := range candidates {
+			if latencies[cluster] <= h.placement.LatencyThresholdMs {
+				underThreshold = append(underThreshold, cluster)
+			}
+		}
+
+		if len(underThreshold) > 0 {
+			return h.leastLoadedCluster(ctx, underThreshold)
+		}
+	}
+
+	// lowest latency, also the fallback of the other policies
+	if len(candidates) == 0 {
+		return "", errNoPlacement
+	}
+
+	return candidates[0], nil
+}
+
+// latencyCandidates returns the configured healthy clusters with a reported RTT, sorted by RTT
+func (h *Handler) latencyCandidates(latencies map[string]int) []string {
+	candidates := []string{}
+
+	for cluster, rtt := range latencies {
+		if _, ok := h.clusterClientMap()[cluster]; ok && rtt >= 0 && h.prober.isHealthy(cluster) {
+			candidates = append(candidates, cluster)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if latencies[candidates[i]] == latencies[candidates[j]] {
+			return candidates[i] < candidates[j]
+		}
+		return latencies[candidates[i]] < latencies[candidates[j]]
+	})
+
+	return candidates
+}
+
+// findSessionPodsCluster returns the cluster holding the session pod templates, or an empty string when the
+// session has no session pods
+func (h *Handler) findSessionPodsCluster(ctx context.Context, sessionId string) (string, error) {
+	if h.federated {
+		return h.findFederatedSessionPodsCluster(ctx, sessionId)
+	}
+
+	found := false
+
+	for cluster, clusterClient := range h.clusterClientMap() {
+		session, err := clusterClient.Sessions("default").Get(ctx, sessionId, metav1.GetOptions{})
+		if err != nil && errors.IsNotFound(err) {
+			continue
+
+		} else if err != nil {
+			return "", err
+		}
+
+		found = true
+		if len(session.Spec.SessionPodTemplates.Items) != 0 {
+			return cluster, nil
+		}
+	}
+
+	if !found {
+		return "", stdErrors.New("session not found")
+	}
+
+	return "", nil
+}
+
+// leastLoadedCluster returns the cluster with the fewest connected clients across all of its sessions
+func (h *Handler) leastLoadedCluster(ctx context.Context, clusters []string) (string, error) {
+	bestCluster := ""
+	bestLoad := math.MaxInt
+
+	for _, cluster := range clusters {
+		clusterClient, ok := h.clusterClientMap()[cluster]
+		if !ok {
+			// removed by a config reload
+			continue
+		}
+
+		sessions, err := clusterClient.Sessions("default").List(metav1.ListOptions{}, ctx)
+		if err != nil {
+			return "", err
+		}
+
+		load := 0
+		for _, session := range sessions.Items {
+			load += countConnectedClients(session.Spec.Clients)
+		}
+
+		if load < bestLoad {
+			bestCluster = cluster
+			bestLoad = load
+		}
+	}
+
+	return bestCluster, nil
+}
+
+func countConnectedClients(clients map[string]bool) int {
+	count := 0
+
+	for _, connected := range clients {
+		if connected {
+			count++
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	stdErrors "errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"mr.telepresence/session-manager/api"
+)
+
+const (
+	probeInterval = 10 * time.Second
+	probeTimeout  = 5 * time.Second
+
+	ingressServiceName      = "ingress-nginx-controller"
+	ingressServiceNamespace = "ingress-nginx"
+)
+
+var errClusterUnhealthy = stdErrors.New("cluster unhealthy")
+
+func errorIsClusterUnhealthy(err error) bool {
+	return stdErrors.Is(err, errClusterUnhealthy)
+}
+
+type clusterProber struct {
+	mu      sync.RWMutex
+	results map[string]api.ClusterHealth
+}
+
+func newClusterProber() *clusterProber {
+	return &clusterProber{results: make(map[string]api.ClusterHealth)}
+}
+
+// isHealthy reports whether a cluster can take new placements. Clusters that were not probed yet are assumed healthy.
+func (p *clusterProber) isHealthy(cluster string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result, ok := p.results[cluster]
+	return !ok || result.Healthy
+}
+
+// checkHealthy returns an error carrying the reason of the last probe when the cluster is known to be unhealthy
+func (p *clusterProber) checkHealthy(cluster string) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result, ok := p.results[cluster]
+	if !ok || result.Healthy {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s: %s", errClusterUnhealthy, cluster, strings.Join(result.Errors, "; "))
+}
+
+// capacity returns the last capacity probed for a cluster, nil when it is not tracked or was not probed yet
+func (p *clusterProber) capacity(cluster string) *api.ClusterCapacity {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.results[cluster].Capacity
+}
+
+func (p *clusterProber) snapshot() []api.ClusterHealth {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	results := make([]api.ClusterHealth, 0, len(p.results))
+	for _, result := range p.results {
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Cluster < results[j].Cluster })
+	return results
+}
+
+// retain drops the results of the clusters no longer configured
+func (p *clusterProber) retain(clusters map[string]*kubernetes.Clientset) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for cluster := range p.results {
+		if _, ok := clusters[cluster]; !ok {
+			delete(p.results, cluster)
+		}
+	}
+}
+
+func (p *clusterProber) store(result api.ClusterHealth) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.results[result.Cluster] = result
+}
+
+// ProbeClusters periodically checks the API server, ingress and ping server of every cluster and caches the results
+func (h *Handler) ProbeClusters(ctx context.Context) {
+	ticker := time.NewTicker(probeInterval)
+	defer ticker.Stop()
+
+	for {
+		h.probeClusters(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Handler) probeClusters(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for cluster, clientset := range h.clusterClientsetMap() {
+		wg.Add(1)
+		go func(cluster string, clientset *kubernetes.Clientset) {
+			defer wg.Done()
+
+			result := probeCluster(ctx, cluster, clientset, h.limits.ClusterCapacity)
+			if !result.Healthy {
+				slog.Warn("cluster is unhealthy", "cluster", cluster, "errors", result.Errors)
+			}
+			h.prober.store(result)
+		}(cluster, clientset)
+	}
+
+	wg.Wait()
+}
+
+func probeCluster(
+	ctx context.Context,
+	cluster string,
+	clientset *kubernetes.Clientset,
+	trackCapacity bool,
+) api.ClusterHealth {
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	result := api.ClusterHealth{Cluster: cluster}
+
+	if _, err := clientset.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(ctx); err != nil {
+		result.Errors = append(result.Errors, "api server: "+err.Error())
+	} else {
+		result.APIServer = true
+	}
+
+	if result.APIServer {
+		svc, err := clientset.CoreV1().Services(ingressServiceNamespace).Get(ctx, ingressServiceName, metav1.GetOptions{})
+		if err != nil {
+			result.Errors = append(result.Errors, "ingress: "+err.Error())
+		} else if len(svc.Status.LoadBalancer.Ingress) == 0 {
+			result.Errors = append(result.Errors, "ingress: no external address")
+		} else {
+			result.IngressIP = loadBalancerHost(svc.Status.LoadBalancer.Ingress[0])
+		}
+
+		svcs, err := clientset.CoreV1().Services("default").List(ctx, metav1.ListOptions{LabelSelector: pingServerSelector})
+		if err != nil {
+			result.Errors = append(result.Errors, "ping server: "+err.Error())
+		} else if address, wsAddress, err := pingServerAddress(svcs.Items); err != nil {
+			result.Errors = append(result.Errors, "ping server: "+err.Error())
+		} else {
+			result.PingServer = address
+			result.PingServerWebSocket = wsAddress
+		}
+	}
+
+	// capacity is informative, a cluster whose capacity could not be read is still healthy
+	if result.APIServer && trackCapacity {
+		if capacity, err := probeCapacity(ctx, clientset); err != nil {
+			result.Errors = append(result.Errors, "capacity: "+err.Error())
+		} else {
+			result.Capacity = capacity
+		}
+	}
+
+	result.Healthy = result.APIServer && result.IngressIP != ""
+	result.LastChecked = time.Now().UTC()
+	return result
+}
+
+// probeCapacity sums the resources allocatable on the schedulable nodes and requested by the pods that did not
+// terminate, pending pods included since they are about to take their share
+func probeCapacity(ctx context.Context, clientset *kubernetes.Clientset) (*api.ClusterCapacity, error) {
+	capacity := &api.ClusterCapacity{Allocatable: corev1.ResourceList{}, Requested: corev1.ResourceList{}}
+
+	// served from the watch cache of the API server rather than etcd
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{ResourceVersion: "0"})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range nodes.Items {
+		if !node.Spec.Unschedulable {
+			addResources(capacity.Allocatable, filterCapacityResources(node.Status.Allocatable))
+		}
+	}
+
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		ResourceVersion: "0",
+		FieldSelector:   "status.phase!=Succeeded,status.phase!=Failed",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pod := range pods.Items {
+		addResources(capacity.Requested, filterCapacityResources(podRequests(&pod.Spec)))
+	}
+
+	return capacity, nil
+}
+
+func filterCapacityResources(resources corev1.ResourceList) corev1.ResourceList {
+	filtered := corev1.ResourceList{}
+
+	for _, name := range capacityResources {
+		if quantity, ok := resources[name]; ok {
+			filtered[name] = quantity
+		}
+	}
+
+	return filtered
+}
+
+func (h *Handler) GetClusters(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, h.prober.snapshot())
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"mr.telepresence/session-manager/api"
+	k8sClient "mr.telepresence/session-manager/k8s-client"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+const unhealthyCluster = "unhealthy"
+
+// newUnhealthyClusterRouter serves session creation and joins, with a second cluster the last probe found unhealthy
+func newUnhealthyClusterRouter(t *testing.T) *gin.Engine {
+	apiServer := httptest.NewServer(newFakeAPIServer(t, &sessionv1alpha1.Session{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec:       sessionv1alpha1.SessionSpec{Clients: map[string]bool{}},
+	}))
+	t.Cleanup(apiServer.Close)
+
+	handler := newTestHandler(t, apiServer)
+	handler.config.Store(&clusterConfig{
+		clusterClientMap: map[string]*k8sClient.SessionClient{
+			mainCluster:      newTestClient(t, apiServer),
+			unhealthyCluster: newTestClient(t, apiServer),
+		},
+		fileTemplates: map[string]*SessionTemplate{
+			"demo": {Name: "demo", Version: 1, SessionTemplateSpec: sessionv1alpha1.SessionTemplateSpec{
+				SessionPodTemplates: corev1.PodTemplateList{Items: []corev1.PodTemplate{{
+					ObjectMeta: metav1.ObjectMeta{Name: "server"},
+				}}},
+			}},
+		},
+	})
+	handler.prober.results[unhealthyCluster] = api.ClusterHealth{Cluster: unhealthyCluster, Healthy: false,
+		Errors: []string{"api server not ready"}}
+
+	router := newTestRouter(handler)
+	router.POST("/session", handler.CreateSession)
+
+	return router
+}
+
+// An explicit cluster the last probe found unhealthy is rejected up front with a 503 and the reason of the probe
+func TestUnhealthyExplicitCluster(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"join an unhealthy cluster", "/session/demo/client",
+			api.CreateClientBody{ClientId: "alice", Cluster: unhealthyCluster}, http.StatusServiceUnavailable},
+		{"join a healthy cluster", "/session/demo/client",
+			api.CreateClientBody{ClientId: "bob", Cluster: mainCluster}, http.StatusOK},
+		{"create a session in an unhealthy cluster", "/session",
+			api.RegisterSessionBody{TemplateName: "demo", SessionPodsCluster: unhealthyCluster},
+			http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := newUnhealthyClusterRouter(t)
+
+			data, _ := json.Marshal(test.body)
+			request := httptest.NewRequest(http.MethodPost, test.path, bytes.NewReader(data))
+			request.Header.Set("Content-Type", "application/json")
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.status {
+				t.Fatalf("expected %d, got %d %s", test.status, recorder.Code, recorder.Body.String())
+			}
+			if test.status != http.StatusServiceUnavailable {
+				return
+			}
+
+			var response api.ErrorResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(response.Error, unhealthyCluster) ||
+				!strings.Contains(response.Error, "api server not ready") {
+				t.Errorf("expected the cluster and the reason of the probe, got %q", response.Error)
+			}
+		})
+	}
+}
+
+// newProbedAPIServer serves the readiness of the API server, the ingress service with the given load balancer
+// ingresses and no ping server
+func newProbedAPIServer(t *testing.T, ingresses []corev1.LoadBalancerIngress) *httptest.Server {
+	ingress := corev1.Service{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{Name: ingressServiceName, Namespace: ingressServiceNamespace},
+		Status:     corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: ingresses}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/readyz":
+			_, _ = w.Write([]byte("ok"))
+		case "/api/v1/namespaces/" + ingressServiceNamespace + "/services/" + ingressServiceName:
+			_ = json.NewEncoder(w).Encode(ingress)
+		case "/api/v1/namespaces/default/services":
+			_ = json.NewEncoder(w).Encode(corev1.ServiceList{TypeMeta: metav1.TypeMeta{APIVersion: "v1",
+				Kind: "ServiceList"}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// The ingress is reachable through the IP of its load balancer, or its hostname when it only reports one
+func TestProbeClusterIngress(t *testing.T) {
+	tests := []struct {
+		name      string
+		ingresses []corev1.LoadBalancerIngress
+		address   string
+	}{
+		{"ip", []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}}, "203.0.113.10"},
+		{"ip and hostname", []corev1.LoadBalancerIngress{{IP: "203.0.113.10", Hostname: "lb.example.com"}},
+			"203.0.113.10"},
+		{"hostname only", []corev1.LoadBalancerIngress{{Hostname: "lb.example.com"}}, "lb.example.com"},
+		{"no external address", nil, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			apiServer := newProbedAPIServer(t, test.ingresses)
+
+			clientset, err := kubernetes.NewForConfig(&rest.Config{Host: apiServer.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := probeCluster(context.Background(), mainCluster, clientset, false)
+
+			if result.IngressIP != test.address {
+				t.Errorf("expected the ingress address %q, got %q", test.address, result.IngressIP)
+			}
+			if healthy := test.address != ""; result.Healthy != healthy {
+				t.Errorf("expected healthy to be %t, got %t with errors %v", healthy, result.Healthy, result.Errors)
+			}
+		})
+	}
+}
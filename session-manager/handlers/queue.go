@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"mr.telepresence/session-manager/api"
+)
+
+// Clients that join with queue set are put in the waiting room of the session when it is full or their cluster lacks
+// the capacity for their pods, instead of being rejected. The queue of each session is admitted in order by
+// AdmitQueuedClients as clients leave and pods are freed. Queued clients poll their join request or their client to
+// learn their position, and leave the queue when they stop polling. The waiting room is kept in memory, a restart of
+// the session-manager empties it.
+
+const (
+	admissionInterval   = 5 * time.Second
+	defaultQueueTimeout = 30 * time.Second
+)
+
+type queueEntry struct {
+	body api.CreateClientBody
+	// request is the value of the client request annotation set once the client is admitted
+	request    string
+	reason     api.RejectionReason
+	lastPolled time.Time
+}
+
+type waitingRoom struct {
+	mu     sync.Mutex
+	queues map[string][]*queueEntry
+	// signalled when room may have been freed, so the queues do not wait for the next admission round
+	wake chan struct{}
+}
+
+func newWaitingRoom() *waitingRoom {
+	return &waitingRoom{queues: make(map[string][]*queueEntry), wake: make(chan struct{}, 1)}
+}
+
+// queueTimeout is how long a queued client keeps its place without polling
+func (c *LimitsConfig) queueTimeout() time.Duration {
+	if c.QueueTimeoutSeconds <= 0 {
+		return defaultQueueTimeout
+	}
+
+	return time.Duration(c.QueueTimeoutSeconds) * time.Second
+}
+
+// queueable reports whether a rejection may clear up once clients leave or pods are freed
+func queueable(err error) bool {
+	reason := rejectionReason(err)
+	return reason == api.SessionFull || reason == api.InsufficientCapacity
+}
+
+// enqueue puts the client at the end of the queue of the session, and returns false when the queue is full
+func (w *waitingRoom) enqueue(
+	sessionId string,
+	body api.CreateClientBody,
+	request string,
+	reason api.RejectionReason,
+	maxLength int,
+	now time.Time,
+) bool {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if maxLength > 0 && len(w.queues[sessionId]) >= maxLength {
+		return false
+	}
+
+	w.queues[sessionId] = append(w.queues[sessionId], &queueEntry{
+		body:       body,
+		request:    request,
+		reason:     reason,
+		lastPolled: now,
+	})
+	return true
+}
+
+// poll refreshes the entry of a queued client and returns its place in the queue, false when it is not queued
+func (w *waitingRoom) poll(
+	sessionId string,
+	clientId string,
+	now time.Time,
+	timeout time.Duration,
+) (*api.ClientQueueStatus, bool) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for i, entry := range w.queues[sessionId] {
+		if entry.body.ClientId == clientId {
+			entry.lastPolled = now
+
+			return &api.ClientQueueStatus{
+				Position:  i + 1,
+				Reason:    entry.reason,
+				ExpiresAt: now.Add(timeout).UTC(),
+			}, true
+		}
+	}
+
+	return nil, false
+}
+
+// leave removes a client from the queue of the session, and returns false when it was not queued
+func (w *waitingRoom) leave(sessionId string, clientId string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	queue := w.queues[sessionId]
+	for i, entry := range queue {
+		if entry.body.ClientId == clientId {
+			w.queues[sessionId] = append(queue[:i:i], queue[i+1:]...)
+			if len(w.queues[sessionId]) == 0 {
+				delete(w.queues, sessionId)
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+// head returns the first client of the queue of the session, dropping the clients that stopped polling
+func (w *waitingRoom) head(sessionId string, now time.Time, timeout time.Duration) (*queueEntry, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for len(w.queues[sessionId]) != 0 {
+		entry := w.queues[sessionId][0]
+		if now.Sub(entry.lastPolled) < timeout {
+			return entry, true
+		}
+
+		slog.Info("client left the queue, it stopped polling", "session", sessionId, "client", entry.body.ClientId)
+		w.queues[sessionId] = w.queues[sessionId][1:]
+	}
+
+	delete(w.queues, sessionId)
+	return nil, false
+}
+
+// waitingReason returns the limit the first queued client of the session waits on, false when nobody is queued
+func (w *waitingRoom) waitingReason(sessionId string) (api.RejectionReason, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.queues[sessionId]) == 0 {
+		return "", false
+	}
+
+	return w.queues[sessionId][0].reason, true
+}
+
+// setReason records the limit a queued client is still waiting on
+func (w *waitingRoom) setReason(entry *queueEntry, reason api.RejectionReason) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entry.reason = reason
+}
+
+// drop empties the queue of a session that no longer exists
+func (w *waitingRoom) drop(sessionId string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.queues, sessionId)
+}
+
+func (w *waitingRoom) sessions() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sessions := make([]string, 0, len(w.queues))
+	for sessionId := range w.queues {
+		sessions = append(sessions, sessionId)
+	}
+
+	return sessions
+}
+
+// notify wakes AdmitQueuedClients up, without blocking when it is already awake
+func (w *waitingRoom) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// AdmitQueuedClients periodically admits the queued clients for which room was freed, and right away when a client
+// leaves a session
+func (h *Handler) AdmitQueuedClients(ctx context.Context) {
+	ticker := time.NewTicker(admissionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-h.waiting.wake:
+		}
+
+		for _, sessionId := range h.waiting.sessions() {
+			h.admitQueue(ctx, sessionId)
+		}
+	}
+}
+
+// admitQueue admits the clients of the queue of the session in order, until one still does not fit
+func (h *Handler) admitQueue(ctx context.Context, sessionId string) {
+	for {
+		entry, ok := h.waiting.head(sessionId, time.Now(), h.limits.queueTimeout())
+		if !ok {
+			return
+		}
+
+		err := h.admitQueuedClient(ctx, sessionId, entry)
+		if err != nil && errorIsSessionNotFound(err) {
+			h.waiting.drop(sessionId)
+			return
+
+		} else if err != nil && errorIsRejection(err) {
+			h.waiting.setReason(entry, rejectionReason(err))
+			return
+
+		} else if err != nil && (errorIsNoPlacement(err) || errorIsClusterNotConfigured(err) ||
+			errorIsClusterUnhealthy(err)) {
+			// the clusters may become healthy or be configured again
+			return
+
+		} else if err != nil && !errorIsClientExists(err) {
+			slog.Warn("unable to admit client", "session", sessionId, "client", entry.body.ClientId, "error", err.Error())
+			return
+		}
+
+		h.waiting.leave(sessionId, entry.body.ClientId)
+	}
+}
+
+func (h *Handler) admitQueuedClient(ctx context.Context, sessionId string, entry *queueEntry) error {
+	occupancy, err := h.findSessionOccupancy(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+
+	// the client may have joined on its own in the meantime
+	if _, ok := occupancy.clientClusters[entry.body.ClientId]; ok {
+		return errClientExists
+	}
+
+	body := entry.body
+	if body.Cluster, err = h.admitClient(ctx, sessionId, body, occupancy); err != nil {
+		return err
+	}
+
+	slog.Info("admitting queued client", "session", sessionId, "client", body.ClientId, "cluster", body.Cluster)
+	return h.addClient(ctx, sessionId, body, entry.request)
+}
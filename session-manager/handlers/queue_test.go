@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+// A client queued in a full session is admitted once another client leaves, ahead of the clients joining after it
+func TestQueuedClientAdmission(t *testing.T) {
+	fakeServer := newFakeAPIServer(t, &sessionv1alpha1.Session{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec:       sessionv1alpha1.SessionSpec{MaxClients: 1, Clients: map[string]bool{"first": true}},
+	})
+	apiServer := httptest.NewServer(fakeServer)
+	defer apiServer.Close()
+
+	handler := newTestHandler(t, apiServer)
+	router := newTestRouter(handler)
+
+	join := map[string]interface{}{"clientId": "second", "cluster": mainCluster, "queue": true}
+	if code, _ := serve(router, http.MethodPost, "/session/demo/client", join); code != http.StatusAccepted {
+		t.Fatalf("expected the client to be queued with 202, got %d", code)
+	}
+
+	if _, err := serve(router, http.MethodDelete, "/session/demo/client/first", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the room left by the first client goes to the queued one
+	late := map[string]interface{}{"clientId": "third", "cluster": mainCluster}
+	if code, _ := serve(router, http.MethodPost, "/session/demo/client", late); code != http.StatusConflict {
+		t.Errorf("expected the late client to be rejected with 409, got %d", code)
+	}
+
+	handler.admitQueue(context.Background(), "demo")
+
+	clients := fakeServer.session(t, "demo").Spec.Clients
+	if _, ok := clients["second"]; !ok || len(clients) != 1 {
+		t.Errorf("expected only the queued client to be admitted, got %v", clients)
+	}
+
+	if _, ok := handler.waiting.waitingReason("demo"); ok {
+		t.Error("the admitted client is still queued")
+	}
+}
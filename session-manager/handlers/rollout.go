@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"mr.telepresence/session-manager/api"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+// A rollout replaces the templates embedded in the outdated sessions of a template with its latest version, along with
+// the upgrade strategy. The session controller then replaces the pods running the previous spec following it.
+
+// RolloutTemplate rolls the outdated sessions of a template onto its latest version
+func (h *Handler) RolloutTemplate(ctx *gin.Context) {
+	var body api.RolloutTemplateBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	name := ctx.Param("templateName")
+
+	versions, err := h.lookupTemplate(ctx.Request.Context(), name)
+	if err != nil && errorIsTemplateNotFound(err) {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
+		return
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := validateUpgrade(&body.Upgrade); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	latest := versions.latest()
+
+	outdatedSessions, err := h.outdatedSessions(ctx.Request.Context(), name, latest.Version)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	selected, err := selectRolloutSessions(outdatedSessions, body.Sessions)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	rollouts := make([]api.SessionRollout, 0, len(selected))
+
+	for _, outdatedSession := range selected {
+		rollout := api.SessionRollout{
+			Session:     outdatedSession.Session,
+			URI:         outdatedSession.URI,
+			FromVersion: outdatedSession.Version,
+			Version:     latest.Version,
+		}
+
+		if err := h.rolloutSession(ctx.Request.Context(), outdatedSession.Session, latest, &body.Upgrade); err != nil {
+			rollout.Error = err.Error()
+			status = http.StatusBadGateway
+		}
+
+		rollouts = append(rollouts, rollout)
+	}
+
+	ctx.JSON(status, rollouts)
+}
+
+// selectRolloutSessions keeps the outdated sessions listed in the body, every outdated session when none is listed
+func selectRolloutSessions(outdatedSessions []api.OutdatedSession, names []string) ([]api.OutdatedSession, error) {
+	if len(names) == 0 {
+		return outdatedSessions, nil
+	}
+
+	outdatedMap := make(map[string]api.OutdatedSession, len(outdatedSessions))
+	for _, outdatedSession := range outdatedSessions {
+		outdatedMap[outdatedSession.Session] = outdatedSession
+	}
+
+	selected := make([]api.OutdatedSession, 0, len(names))
+	for _, name := range names {
+		outdatedSession, ok := outdatedMap[name]
+		if !ok {
+			return nil, fmt.Errorf("session %s does not run an outdated version of the template", name)
+		}
+
+		selected = append(selected, outdatedSession)
+	}
+
+	return selected, nil
+}
+
+// validateUpgrade checks the window of the strategy, the API server would reject it in every session otherwise
+func validateUpgrade(upgrade *sessionv1alpha1.UpgradeStrategy) error {
+	if upgrade.Window == nil {
+		return nil
+	}
+
+	for _, boundary := range []string{upgrade.Window.Start, upgrade.Window.End} {
+		if _, err := time.Parse("15:04", boundary); err != nil {
+			return fmt.Errorf("invalid upgrade window time %q, expected HH:MM", boundary)
+		}
+	}
+
+	return nil
+}
+
+// rolloutPatchData is the merge patch replacing the templates of a session copy with the given version of the
+// template, its parameters already applied. The session pod templates are given apart since only the copy in the
+// session pods cluster holds them.
+func rolloutPatchData(
+	template *SessionTemplate,
+	spec *sessionv1alpha1.SessionTemplateSpec,
+	parameters map[string]string,
+	upgrade *sessionv1alpha1.UpgradeStrategy,
+	sessionPodTemplates corev1.PodTemplateList,
+) ([]byte, error) {
+
+	annotations := map[string]interface{}{parametersAnnotation: nil}
+	if len(parameters) != 0 {
+		annotation, err := parametersAnnotationValue(parameters)
+		if err != nil {
+			return nil, err
+		}
+		annotations[parametersAnnotation] = annotation
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{
+				templateVersionLabel: strconv.Itoa(template.Version),
+			},
+			"annotations": annotations,
+		},
+		"spec": map[string]interface{}{
+			"sessionPodTemplates":     sessionPodTemplates,
+			"clientPodTemplates":      spec.ClientPodTemplates,
+			"timeoutSeconds":          spec.TimeoutSeconds,
+			"reutilizeTimeoutSeconds": spec.ReutilizeTimeoutSeconds,
+			"heartbeatTimeoutSeconds": spec.HeartbeatTimeoutSeconds,
+			"maxClients":              spec.MaxClients,
+			"upgrade":                 upgrade,
+		},
+	})
+}
+
+// rolloutParameters resolves the parameters of the new version of the template with the values the session was
+// created with. Values of parameters the new version no longer declares are dropped.
+func rolloutParameters(template *SessionTemplate, annotations map[string]string) (map[string]string, error) {
+	values, err := sessionParameters(annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	declared := make(map[string]interface{}, len(template.Parameters))
+	for _, parameter := range template.Parameters {
+		if value, ok := values[parameter.Name]; ok {
+			declared[parameter.Name] = value
+		}
+	}
+
+	return resolveParameters(&template.SessionTemplateSpec, declared)
+}
+
+// rolloutSession patches every copy of the session, or the FederatedSession in federated mode
+func (h *Handler) rolloutSession(
+	ctx context.Context,
+	sessionId string,
+	template *SessionTemplate,
+	upgrade *sessionv1alpha1.UpgradeStrategy,
+) error {
+
+	if h.federated {
+		federatedSession, err := h.federatedSessions().Get(ctx, sessionId, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		parameters, err := rolloutParameters(template, federatedSession.Annotations)
+		if err != nil {
+			return err
+		}
+		spec := applyParameters(&template.SessionTemplateSpec, parameters)
+
+		patchData, err := rolloutPatchData(template, spec, parameters, upgrade, spec.SessionPodTemplates)
+		if err != nil {
+			return err
+		}
+
+		_, err = h.federatedSessions().Patch(ctx, sessionId, types.MergePatchType, patchData, metav1.PatchOptions{})
+		return err
+	}
+
+	clusterClientMap := h.clusterClientMap()
+
+	sessionCopies, err := findSessionCopies(ctx, sessionId, clusterClientMap)
+	if err != nil {
+		return err
+	}
+
+	parameters, err := rolloutParameters(template, sessionCopies[referenceCluster(sessionCopies)].Annotations)
+	if err != nil {
+		return err
+	}
+	spec := applyParameters(&template.SessionTemplateSpec, parameters)
+
+	sessionPodsCluster := sessionPlacement(sessionCopies, nil).SessionPodsCluster
+	if sessionPodsCluster == "" && len(spec.SessionPodTemplates.Items) != 0 {
+		return fmt.Errorf("session %s has no session pods cluster to run the session pods of the template", sessionId)
+	}
+
+	for _, cluster := range sortedClusters(sessionCopies) {
+		sessionPodTemplates := corev1.PodTemplateList{Items: []corev1.PodTemplate{}}
+		if cluster == sessionPodsCluster {
+			sessionPodTemplates = spec.SessionPodTemplates
+		}
+
+		patchData, err := rolloutPatchData(template, spec, parameters, upgrade, sessionPodTemplates)
+		if err != nil {
+			return err
+		}
+
+		sessions := clusterClientMap[cluster].Sessions("default")
+		_, err = sessions.Patch(ctx, sessionId, types.MergePatchType, patchData, metav1.PatchOptions{})
+		if err != nil {
+			return fmt.Errorf("cluster %s: %w", cluster, err)
+		}
+	}
+
+	return nil
+}
@@ -1,87 +1,273 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
-	stdErrors "errors"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	corev1 "k8s.io/api/core/v1"
+	"mr.telepresence/session-manager/api"
+	"mr.telepresence/session-manager/auth"
 	k8sClient "mr.telepresence/session-manager/k8s-client"
+	"mr.telepresence/session-manager/telemetry"
 	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
 )
 
+const rollbackTimeout = 30 * time.Second
+
 func (h *Handler) CreateSession(ctx *gin.Context) {
-	var body RegisterSessionBody
+	var body api.RegisterSessionBody
 	if err := ctx.ShouldBindJSON(&body); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	template, err := h.resolveTemplate(ctx.Request.Context(), body.TemplateName, body.TemplateVersion)
+	if err != nil && errorIsTemplateNotFound(err) {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	template, ok := h.sessionTemplates[body.TemplateName]
-	if !ok {
-		message := "template name not configured"
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": message})
+	parameters, err := resolveParameters(&template.SessionTemplateSpec, body.Parameters)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
+	spec := applyParameters(&template.SessionTemplateSpec, parameters)
 
-	sessionName := body.TemplateName + "-" + uuid.New().String()[:4]
+	key, err := idempotencyKey(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	name, generated, err := sessionName(&body, key, spec)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
 
 	session := &sessionv1alpha1.Session{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: sessionName,
+			Name: name,
+			Labels: map[string]string{
+				templateLabel:        body.TemplateName,
+				templateVersionLabel: strconv.Itoa(template.Version),
+			},
 		},
 		Spec: sessionv1alpha1.SessionSpec{
-			SessionPodTemplates:     template.SessionPodTemplates,
-			ClientPodTemplates:      template.ClientPodTemplates,
-			TimeoutSeconds:          template.TimeoutSeconds,
-			ReutilizeTimeoutSeconds: template.ReutilizeTimeoutSeconds,
+			SessionPodTemplates:     spec.SessionPodTemplates,
+			ClientPodTemplates:      spec.ClientPodTemplates,
+			TimeoutSeconds:          spec.TimeoutSeconds,
+			ReutilizeTimeoutSeconds: spec.ReutilizeTimeoutSeconds,
+			HeartbeatTimeoutSeconds: spec.HeartbeatTimeoutSeconds,
+			MaxClients:              spec.MaxClients,
 			Clients:                 make(map[string]bool),
 		},
 	}
 
+	if principal := auth.GetPrincipal(ctx); principal != nil && principal.Tenant != "" {
+		session.Labels[tenantLabel] = principal.Tenant
+	}
+
+	if len(parameters) != 0 {
+		annotation, err := parametersAnnotationValue(parameters)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+		session.Annotations = map[string]string{parametersAnnotation: annotation}
+	}
+
+	if err := setIdempotencyAnnotations(session, key, &body); err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	setTraceParentAnnotation(ctx.Request.Context(), session)
+
 	if len(session.Spec.SessionPodTemplates.Items) != 0 {
-		sessionClient, ok := h.clusterClientMap[body.SessionPodsCluster]
-		if !ok {
+		if _, ok := h.clusterClientMap()[body.SessionPodsCluster]; !ok {
 			message := "cluster not configured"
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": message})
+			ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: message})
 			return
 		}
 
-		if _, err := sessionClient.Sessions("default").Create(session, ctx); err != nil && !errors.IsAlreadyExists(err) {
-			ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		if err := h.prober.checkHealthy(body.SessionPodsCluster); err != nil {
+			ctx.JSON(http.StatusServiceUnavailable, api.ErrorResponse{Error: err.Error()})
 			return
 		}
 	}
 
-	session.Spec.SessionPodTemplates = corev1.PodTemplateList{Items: []corev1.PodTemplate{}}
+	err = h.checkSessionQuotas(ctx.Request.Context(), session, spec.MaxSessions)
+	if err != nil && errorIsRejection(err) {
+		writeRejection(ctx, err)
+		return
 
-	for _, sessionClient := range h.clusterClientMap {
-		if _, err := sessionClient.Sessions("default").Create(session, ctx); err != nil && !errors.IsAlreadyExists(err) {
-			ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
-			return
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if h.federated {
+		h.createFederatedSession(ctx, session, body.SessionPodsCluster, generated)
+		return
+	}
+
+	response, replayed, err := h.createSessionInClusters(ctx.Request.Context(), session, body.SessionPodsCluster)
+
+	// generated names may collide with existing sessions, another one is tried then
+	for attempt := 1; generated && errorIsSessionConflict(err) && attempt < generatedNameAttempts; attempt++ {
+		session.Name = generateSessionName(body.TemplateName)
+		response, replayed, err = h.createSessionInClusters(ctx.Request.Context(), session, body.SessionPodsCluster)
+	}
+
+	if err != nil {
+		status := http.StatusBadGateway
+		if errorIsSessionConflict(err) {
+			status = http.StatusConflict
 		}
+
+		response.Error = err.Error()
+		ctx.JSON(status, response)
+		return
 	}
 
-	ctx.Header("Location", ctx.Request.URL.Path+"/"+sessionName)
-	ctx.JSON(http.StatusCreated, nil)
+	location := ctx.Request.URL.Path + "/" + session.Name
+	if replayed {
+		ctx.Header(api.IdempotentReplayedHeader, "true")
+	}
+
+	response.URI = location
+	ctx.Header("Location", location)
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// createSessionInClusters creates the session in every cluster, the copy in the session pods cluster being the only
+// one holding the session pod templates. Creation is all-or-nothing: when a cluster fails, the copies created so far
+// are deleted again and the outcome of each cluster is reported. Copies left by a previous attempt of the same request
+// are kept and reported as created, replayed is set when every copy was.
+func (h *Handler) createSessionInClusters(
+	ctx context.Context,
+	session *sessionv1alpha1.Session,
+	sessionPodsCluster string,
+) (response *api.CreateSessionResponse, replayed bool, err error) {
+
+	response = &api.CreateSessionResponse{Session: session.Name, Clusters: make(map[string]api.ClusterResult)}
+
+	// the clients are taken once, so a config reload cannot change them in the middle of the creation
+	clusterClientMap := h.clusterClientMap()
+
+	clusters := make([]string, 0, len(clusterClientMap))
+	for cluster := range clusterClientMap {
+		clusters = append(clusters, cluster)
+	}
+
+	// the session pods cluster goes first since it is the only one holding the full spec
+	sort.Slice(clusters, func(i, j int) bool {
+		if (clusters[i] == sessionPodsCluster) != (clusters[j] == sessionPodsCluster) {
+			return clusters[i] == sessionPodsCluster
+		}
+		return clusters[i] < clusters[j]
+	})
+
+	strippedSession := session.DeepCopy()
+	strippedSession.Spec.SessionPodTemplates = corev1.PodTemplateList{Items: []corev1.PodTemplate{}}
+
+	created := []string{}
+	var createErr error
+
+	for _, cluster := range clusters {
+		if createErr != nil {
+			response.Clusters[cluster] = api.ClusterResult{Outcome: api.ClusterSkipped}
+			continue
+		}
+
+		clusterSession := strippedSession
+		if cluster == sessionPodsCluster {
+			clusterSession = session
+		}
+
+		sessions := clusterClientMap[cluster].Sessions("default")
+		_, err := sessions.Create(clusterSession, ctx)
+
+		if err != nil && errors.IsAlreadyExists(err) {
+			existing, err := sessions.Get(ctx, session.Name, metav1.GetOptions{})
+			if err != nil {
+				response.Clusters[cluster] = api.ClusterResult{Outcome: api.ClusterFailed, Error: err.Error()}
+				createErr = fmt.Errorf("unable to create session in cluster %s: %w", cluster, err)
+
+			} else if err := checkSameRequest(existing, session); err != nil {
+				response.Clusters[cluster] = api.ClusterResult{Outcome: api.ClusterAlreadyExists, Error: err.Error()}
+				createErr = err
+
+			} else {
+				response.Clusters[cluster] = api.ClusterResult{Outcome: api.ClusterCreated}
+			}
+
+		} else if err != nil {
+			response.Clusters[cluster] = api.ClusterResult{Outcome: api.ClusterFailed, Error: err.Error()}
+			createErr = fmt.Errorf("unable to create session in cluster %s: %w", cluster, err)
+
+		} else {
+			response.Clusters[cluster] = api.ClusterResult{Outcome: api.ClusterCreated}
+			created = append(created, cluster)
+		}
+	}
+
+	if createErr == nil {
+		return response, len(created) == 0 && len(clusters) != 0, nil
+	}
+
+	// the request context may already be cancelled, the rollback must still go through
+	rollbackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	for _, cluster := range created {
+		err := clusterClientMap[cluster].Sessions("default").Delete(session.Name, metav1.DeleteOptions{}, rollbackCtx)
+
+		if err != nil && !errors.IsNotFound(err) {
+			telemetry.Logger(ctx).Error("unable to roll back session", "session", session.Name, "cluster", cluster,
+				"error", err.Error())
+			response.Clusters[cluster] = api.ClusterResult{Outcome: api.ClusterRollbackFailed, Error: err.Error()}
+		} else {
+			response.Clusters[cluster] = api.ClusterResult{Outcome: api.ClusterRolledBack}
+		}
+	}
+
+	return response, false, createErr
 }
 
 func (h *Handler) GetSession(ctx *gin.Context) {
+	if h.federated {
+		h.getFederatedSessionView(ctx)
+		return
+	}
+
 	sessionId := ctx.Param("sessionId")
-	session, err := findSession(ctx, sessionId, h.clusterClientMap)
+	sessionCopies, err := findSessionCopies(ctx.Request.Context(), sessionId, h.clusterClientMap())
 	if err != nil && errorIsSessionNotFound(err) {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
 		return
 	} else if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, session)
+	ctx.JSON(http.StatusOK, api.SessionView{
+		Session:   *mergeSessions(sessionId, sessionCopies),
+		Placement: sessionPlacement(sessionCopies, h.configuredClusters()),
+	})
 }
 
 func findSession(
@@ -90,85 +276,79 @@ func findSession(
 	clusterClientMap map[string]*k8sClient.SessionClient,
 ) (*sessionv1alpha1.Session, error) {
 
-	sessionSum := &sessionv1alpha1.Session{
-		ObjectMeta: metav1.ObjectMeta{Name: sessionId},
-		Spec: sessionv1alpha1.SessionSpec{
-			Clients: make(map[string]bool),
-		},
-		Status: sessionv1alpha1.SessionStatus{
-			SessionPods: sessionv1alpha1.SessionPodsStatus{
-				Conditions: []metav1.Condition{},
-				PodsStatus: map[string]sessionv1alpha1.PodStatus{},
-			},
-			Clients: make(map[string]sessionv1alpha1.ClientStatus),
-		},
+	sessionCopies, err := findSessionCopies(ctx.Request.Context(), sessionId, clusterClientMap)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, cluterClient := range clusterClientMap {
-		session, err := cluterClient.Sessions("default").Get(ctx, sessionId, metav1.GetOptions{})
-		if err != nil && errors.IsNotFound(err) {
-			return nil, stdErrors.New("session not found")
-
-		} else if err != nil {
-			return nil, err
-		}
-
-		sessionSum.Spec.TimeoutSeconds = session.Spec.TimeoutSeconds
-		sessionSum.Spec.ReutilizeTimeoutSeconds = session.Spec.ReutilizeTimeoutSeconds
+	return mergeSessions(sessionId, sessionCopies), nil
+}
 
-		if len(session.Spec.SessionPodTemplates.Items) != 0 {
-			sessionSum.Spec.SessionPodTemplates = session.Spec.SessionPodTemplates
-			sessionSum.Status.SessionPods = session.Status.SessionPods
-		}
+// GetSessions lists the union of the sessions found in every cluster, sorted by name. The listing can be paginated,
+// filtered by template, label selector and phase, and include a status summary of each session.
+func (h *Handler) GetSessions(ctx *gin.Context) {
+	var query api.ListSessionsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
 
-		if len(sessionSum.Spec.ClientPodTemplates.Items) == 0 {
-			sessionSum.Spec.ClientPodTemplates = session.Spec.ClientPodTemplates
-		}
+	selector, err := listSelector(query)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
 
-		for specClient, connected := range session.Spec.Clients {
-			sessionSum.Spec.Clients[specClient] = connected
-		}
+	if h.federated {
+		h.getFederatedSessions(ctx, query, selector)
+		return
+	}
 
-		for statusClient, status := range session.Status.Clients {
-			sessionSum.Status.Clients[statusClient] = status
-		}
+	sessionsCopies, next, err := listSessionsPage(ctx.Request.Context(), h.clusterClientMap(), query.Limit,
+		query.Continue, selector)
+	if err != nil {
+		listError(ctx, err)
+		return
 	}
 
-	return sessionSum, nil
-}
+	names := make([]string, 0, len(sessionsCopies))
+	for name := range sessionsCopies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-func (h *Handler) GetSessions(ctx *gin.Context) {
-	sessionsLocation := []map[string]string{}
+	configuredClusters := h.configuredClusters()
+	sessionsLocation := make([]api.SessionLocation, 0, len(names))
 
-	for _, sessionClient := range h.clusterClientMap {
-		sessions, err := sessionClient.Sessions("default").List(metav1.ListOptions{}, ctx)
-		if err != nil {
-			ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
-			return
-		}
+	for _, name := range names {
+		session := mergeSessions(name, sessionsCopies[name])
+		placement := sessionPlacement(sessionsCopies[name], configuredClusters)
 
-		for _, session := range sessions.Items {
-			location := make(map[string]string)
-			location["session"] = session.Name
-			location["uri"] = ctx.Request.URL.Path + "/" + session.Name
+		if location, ok := sessionLocation(ctx, query, session, placement); ok {
 			sessionsLocation = append(sessionsLocation, location)
 		}
+	}
 
-		break
+	if next != "" {
+		ctx.Header(api.ContinueHeader, next)
 	}
 
 	ctx.JSON(http.StatusOK, sessionsLocation)
 }
 
 func (h *Handler) DeleteSession(ctx *gin.Context) {
+	if h.federated {
+		h.deleteFederatedSession(ctx)
+		return
+	}
+
 	sessionId := ctx.Param("sessionId")
 
 	deleted := false
-	for _, sessionClient := range h.clusterClientMap {
-		if err := sessionClient.Sessions("default").Delete(sessionId, metav1.DeleteOptions{}, ctx); err != nil &&
-			!errors.IsNotFound(err) {
-
-			ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	for _, sessionClient := range h.clusterClientMap() {
+		err := sessionClient.Sessions("default").Delete(sessionId, metav1.DeleteOptions{}, ctx.Request.Context())
+		if err != nil && !errors.IsNotFound(err) {
+			ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
 			return
 		} else if err == nil {
 			deleted = true
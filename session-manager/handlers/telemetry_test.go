@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"mr.telepresence/session-manager/api"
+	"mr.telepresence/session-manager/auth"
+	k8sClient "mr.telepresence/session-manager/k8s-client"
+	"mr.telepresence/session-manager/telemetry"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+// requestIDRecorder records the request id of every call reaching the API server
+type requestIDRecorder struct {
+	next http.Handler
+
+	mu  sync.Mutex
+	ids []string
+}
+
+func (r *requestIDRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.ids = append(r.ids, req.Header.Get(telemetry.RequestIDHeader))
+	r.mu.Unlock()
+
+	r.next.ServeHTTP(w, req)
+}
+
+func (r *requestIDRecorder) reset() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := r.ids
+	r.ids = nil
+	return ids
+}
+
+// The Kubernetes API calls made by the handlers carry the id of the request and are traced as children of its span
+func TestKubernetesCallsBelongToRequest(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	recorder := &requestIDRecorder{next: newFakeAPIServer(t, &sessionv1alpha1.Session{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec:       sessionv1alpha1.SessionSpec{Clients: map[string]bool{}},
+	})}
+	apiServer := httptest.NewServer(recorder)
+	defer apiServer.Close()
+
+	handler := newTestHandler(t, apiServer)
+
+	cfg := &rest.Config{Host: apiServer.URL, QPS: 1000, Burst: 1000}
+	telemetry.InstrumentConfig(cfg, mainCluster)
+	client, err := k8sClient.NewForConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.config.Store(&clusterConfig{
+		clusterClientMap: map[string]*k8sClient.SessionClient{mainCluster: client},
+		fileTemplates:    map[string]*SessionTemplate{"open": {Name: "open", Version: 1}},
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(telemetry.Requests())
+	router.Use(auth.Authenticate(nil))
+	router.POST("/session", handler.CreateSession)
+	router.GET("/session/:sessionId", handler.GetSession)
+
+	tests := []struct {
+		name   string
+		method string
+		route  string
+		path   string
+		body   interface{}
+	}{
+		{"create session", http.MethodPost, "/session", "/session",
+			api.RegisterSessionBody{TemplateName: "open", SessionPodsCluster: mainCluster}},
+		{"get session", http.MethodGet, "/session/:sessionId", "/session/demo", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder.reset()
+			spansBefore := len(spans.Ended())
+
+			var body []byte
+			if test.body != nil {
+				body, _ = json.Marshal(test.body)
+			}
+
+			id := "request-" + strings.ReplaceAll(test.name, " ", "-")
+			request := httptest.NewRequest(test.method, test.path, bytes.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set(telemetry.RequestIDHeader, id)
+
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			if response.Code >= http.StatusBadRequest {
+				t.Fatalf("expected the request to succeed, got %d %s", response.Code, response.Body.String())
+			}
+
+			ids := recorder.reset()
+			if len(ids) == 0 {
+				t.Fatal("expected the request to call the API server")
+			}
+			for _, forwarded := range ids {
+				if forwarded != id {
+					t.Errorf("expected the request id %q in the API call, got %q", id, forwarded)
+				}
+			}
+
+			ended := spans.Ended()[spansBefore:]
+
+			var requestSpan sdktrace.ReadOnlySpan
+			var kubernetesSpans []sdktrace.ReadOnlySpan
+			for _, span := range ended {
+				if strings.HasPrefix(span.Name(), "kubernetes ") {
+					kubernetesSpans = append(kubernetesSpans, span)
+				} else if span.Name() == test.method+" "+test.route {
+					requestSpan = span
+				}
+			}
+
+			if requestSpan == nil || len(kubernetesSpans) != len(ids) {
+				t.Fatalf("expected the request span and %d kubernetes spans, got %d spans", len(ids), len(ended))
+			}
+			for _, span := range kubernetesSpans {
+				if span.Parent().SpanID() != requestSpan.SpanContext().SpanID() {
+					t.Errorf("expected %s to be a child of the request span %s, got parent %s", span.Name(),
+						requestSpan.SpanContext().SpanID(), span.Parent().SpanID())
+				}
+			}
+		})
+	}
+}
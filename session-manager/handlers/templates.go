@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	stdErrors "errors"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"mr.telepresence/session-manager/api"
+	k8sClient "mr.telepresence/session-manager/k8s-client"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+// Templates are either SessionTemplate resources in the main cluster, managed through the API, or read from
+// conf/templates.yaml at startup. A resource takes precedence over a file template with the same name.
+
+var errTemplateNotFound = stdErrors.New("template name not configured")
+
+var errTemplateVersionNotFound = stdErrors.New("template version not found")
+
+func errorIsTemplateNotFound(err error) bool {
+	return stdErrors.Is(err, errTemplateNotFound) || stdErrors.Is(err, errTemplateVersionNotFound)
+}
+
+func (h *Handler) templateResources() (k8sClient.SessionTemplateInterface, bool) {
+	clusterClient, ok := h.clusterClientMap()[mainCluster]
+	if !ok {
+		return nil, false
+	}
+
+	return clusterClient.SessionTemplates(), true
+}
+
+// templateVersions holds every version of a template in ascending order, the last one being the latest
+type templateVersions struct {
+	source   api.TemplateSource
+	versions []*SessionTemplate
+}
+
+func (t *templateVersions) latest() *SessionTemplate {
+	return t.versions[len(t.versions)-1]
+}
+
+// version returns the requested version, or the latest one when version is zero
+func (t *templateVersions) version(version int) (*SessionTemplate, bool) {
+	if version == 0 {
+		return t.latest(), true
+	}
+
+	for _, template := range t.versions {
+		if template.Version == version {
+			return template, true
+		}
+	}
+
+	return nil, false
+}
+
+func (t *templateVersions) numbers() []int {
+	numbers := make([]int, 0, len(t.versions))
+	for _, template := range t.versions {
+		numbers = append(numbers, template.Version)
+	}
+
+	return numbers
+}
+
+// templateResourceVersion is the version of the spec of a template resource, resources created without going
+// through the API start at version 1
+func templateResourceVersion(resource *sessionv1alpha1.SessionTemplate) int {
+	if resource.Version == 0 {
+		return 1
+	}
+
+	return resource.Version
+}
+
+func templateResourceVersions(resource *sessionv1alpha1.SessionTemplate) *templateVersions {
+	versions := make([]*SessionTemplate, 0, len(resource.History)+1)
+
+	for _, previous := range resource.History {
+		versions = append(versions, &SessionTemplate{
+			Name:                resource.Name,
+			Version:             previous.Version,
+			SessionTemplateSpec: previous.Spec,
+		})
+	}
+
+	versions = append(versions, &SessionTemplate{
+		Name:                resource.Name,
+		Version:             templateResourceVersion(resource),
+		SessionTemplateSpec: resource.Spec,
+	})
+
+	sort.SliceStable(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+
+	return &templateVersions{source: api.TemplateResource, versions: versions}
+}
+
+// lookupTemplate reads the template live, so templates published through the API are used right away
+func (h *Handler) lookupTemplate(ctx context.Context, name string) (*templateVersions, error) {
+	if templates, ok := h.templateResources(); ok {
+		resource, err := templates.Get(ctx, name, metav1.GetOptions{})
+
+		if err == nil {
+			return templateResourceVersions(resource), nil
+
+		} else if !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	if template, ok := h.fileTemplates()[name]; ok {
+		return &templateVersions{source: api.TemplateFile, versions: []*SessionTemplate{template}}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", errTemplateNotFound, name)
+}
+
+// resolveTemplate returns the requested version of a template, or its latest version when version is zero
+func (h *Handler) resolveTemplate(ctx context.Context, name string, version int) (*SessionTemplate, error) {
+	versions, err := h.lookupTemplate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	template, ok := versions.version(version)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s version %d", errTemplateVersionNotFound, name, version)
+	}
+
+	return template, nil
+}
+
+func (h *Handler) CreateTemplate(ctx *gin.Context) {
+	var body api.CreateTemplateBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := validateTemplateParameters(&body.Spec); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := validateTemplateLimits(&body.Spec); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	templates, ok := h.templateResources()
+	if !ok {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "main cluster not configured"})
+		return
+	}
+
+	resource := &sessionv1alpha1.SessionTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: body.Name},
+		Spec:       body.Spec,
+		Version:    1,
+	}
+
+	_, err := templates.Create(resource, ctx.Request.Context())
+	if err != nil && errors.IsAlreadyExists(err) {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: err.Error()})
+		return
+
+	} else if err != nil && errors.IsInvalid(err) {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	location := ctx.Request.URL.Path + "/" + body.Name
+	ctx.Header("Location", location)
+	ctx.JSON(http.StatusCreated, api.TemplateLocation{
+		Template: body.Name,
+		URI:      location,
+		Source:   api.TemplateResource,
+	})
+}
+
+// GetTemplates lists the template resources and the file templates they do not override, sorted by name
+func (h *Handler) GetTemplates(ctx *gin.Context) {
+	sources := make(map[string]api.TemplateSource, len(h.fileTemplates()))
+
+	for name := range h.fileTemplates() {
+		sources[name] = api.TemplateFile
+	}
+
+	if templates, ok := h.templateResources(); ok {
+		resources, err := templates.List(metav1.ListOptions{}, ctx.Request.Context())
+		if err != nil && !errors.IsNotFound(err) {
+			ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		for _, resource := range resources.Items {
+			sources[resource.Name] = api.TemplateResource
+		}
+	}
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	templatesLocation := make([]api.TemplateLocation, 0, len(names))
+	for _, name := range names {
+		templatesLocation = append(templatesLocation, api.TemplateLocation{
+			Template: name,
+			URI:      ctx.Request.URL.Path + "/" + name,
+			Source:   sources[name],
+		})
+	}
+
+	ctx.JSON(http.StatusOK, templatesLocation)
+}
+
+// GetTemplate returns the latest version of a template, or the one given by the version query parameter
+func (h *Handler) GetTemplate(ctx *gin.Context) {
+	var query api.GetTemplateQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	versions, err := h.lookupTemplate(ctx.Request.Context(), ctx.Param("templateName"))
+	if err != nil && errorIsTemplateNotFound(err) {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
+		return
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	template, ok := versions.version(query.Version)
+	if !ok {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: errTemplateVersionNotFound.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, api.TemplateResponse{
+		Name:          template.Name,
+		Source:        versions.source,
+		Version:       template.Version,
+		LatestVersion: versions.latest().Version,
+		Versions:      versions.numbers(),
+		Spec:          template.SessionTemplateSpec,
+	})
+}
+
+// UpdateTemplate publishes a new version of a template resource, the previous spec being kept in its history.
+// Sessions already created from it are left untouched.
+func (h *Handler) UpdateTemplate(ctx *gin.Context) {
+	var body api.UpdateTemplateBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := validateTemplateParameters(&body.Spec); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := validateTemplateLimits(&body.Spec); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resource := h.getTemplateResource(ctx, ctx.Param("templateName"))
+	if resource == nil {
+		return
+	}
+
+	if equality.Semantic.DeepEqual(resource.Spec, body.Spec) {
+		ctx.JSON(http.StatusOK, nil)
+		return
+	}
+
+	resource.History = append(resource.History, sessionv1alpha1.SessionTemplateVersion{
+		Version: templateResourceVersion(resource),
+		Spec:    resource.Spec,
+	})
+	resource.Version = templateResourceVersion(resource) + 1
+	resource.Spec = body.Spec
+
+	templates, _ := h.templateResources()
+	_, err := templates.Update(resource, ctx.Request.Context())
+
+	if err != nil && errors.IsConflict(err) {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: err.Error()})
+
+	} else if err != nil && errors.IsInvalid(err) {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+
+	} else {
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+func (h *Handler) DeleteTemplate(ctx *gin.Context) {
+	name := ctx.Param("templateName")
+	if h.getTemplateResource(ctx, name) == nil {
+		return
+	}
+
+	templates, _ := h.templateResources()
+	err := templates.Delete(name, metav1.DeleteOptions{}, ctx.Request.Context())
+
+	if err != nil && errors.IsNotFound(err) {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+
+	} else {
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+// getTemplateResource writes the error response itself and returns nil when there is no template resource with that
+// name. File templates can only be changed by editing conf/templates.yaml.
+func (h *Handler) getTemplateResource(ctx *gin.Context, name string) *sessionv1alpha1.SessionTemplate {
+	templates, ok := h.templateResources()
+	if !ok {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "main cluster not configured"})
+		return nil
+	}
+
+	resource, err := templates.Get(ctx.Request.Context(), name, metav1.GetOptions{})
+	if err != nil && errors.IsNotFound(err) {
+		message := "template not found"
+		if _, ok := h.fileTemplates()[name]; ok {
+			message = "template is defined in " + templatesPath + " and cannot be changed through the API"
+		}
+
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: message})
+		return nil
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	return resource
+}
+
+// GetOutdatedSessions lists the sessions created from a template on a version older than its latest one, sorted by
+// name
+func (h *Handler) GetOutdatedSessions(ctx *gin.Context) {
+	name := ctx.Param("templateName")
+
+	versions, err := h.lookupTemplate(ctx.Request.Context(), name)
+	if err != nil && errorIsTemplateNotFound(err) {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: err.Error()})
+		return
+
+	} else if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	outdatedSessions, err := h.outdatedSessions(ctx.Request.Context(), name, versions.latest().Version)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, outdatedSessions)
+}
+
+// outdatedSessions lists the sessions created from a template on a version older than the latest one
+func (h *Handler) outdatedSessions(ctx context.Context, name string, latest int) ([]api.OutdatedSession, error) {
+	selector, err := listSelector(api.ListSessionsQuery{Template: name})
+	if err != nil {
+		return nil, err
+	}
+
+	sessionsLabels, err := h.sessionsLabels(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(sessionsLabels))
+	for sessionName := range sessionsLabels {
+		names = append(names, sessionName)
+	}
+	sort.Strings(names)
+
+	outdatedSessions := []api.OutdatedSession{}
+
+	for _, sessionName := range names {
+		// sessions created before templates were versioned have no version label
+		version, _ := strconv.Atoi(sessionsLabels[sessionName][templateVersionLabel])
+		if version >= latest {
+			continue
+		}
+
+		outdatedSessions = append(outdatedSessions, api.OutdatedSession{
+			Session:       sessionName,
+			URI:           "/v1/session/" + sessionName,
+			Template:      name,
+			Version:       version,
+			LatestVersion: latest,
+		})
+	}
+
+	return outdatedSessions, nil
+}
+
+// sessionsLabels returns the labels of every session matching the selector, across every cluster
+func (h *Handler) sessionsLabels(ctx context.Context, selector string) (map[string]map[string]string, error) {
+	sessionsLabels := make(map[string]map[string]string)
+
+	if h.federated {
+		federatedSessions, err := h.federatedSessions().List(metav1.ListOptions{LabelSelector: selector}, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, federatedSession := range federatedSessions.Items {
+			sessionsLabels[federatedSession.Name] = federatedSession.Labels
+		}
+
+		return sessionsLabels, nil
+	}
+
+	sessionsCopies, _, err := listSessionsPage(ctx, h.clusterClientMap(), 0, "", selector)
+	if err != nil {
+		return nil, err
+	}
+
+	for sessionName, sessionCopies := range sessionsCopies {
+		sessionsLabels[sessionName] = sessionCopies[referenceCluster(sessionCopies)].Labels
+	}
+
+	return sessionsLabels, nil
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+)
+
+func TestResolveTemplate(t *testing.T) {
+	handler := &Handler{}
+	handler.config.Store(&clusterConfig{fileTemplates: map[string]*SessionTemplate{
+		"demo": {Name: "demo", Version: 1},
+	}})
+
+	tests := []struct {
+		name     string
+		template string
+		version  int
+		notFound bool
+	}{
+		{"latest version", "demo", 0, false},
+		{"existing version", "demo", 1, false},
+		{"missing version", "demo", 2, true},
+		{"missing template", "other", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template, err := handler.resolveTemplate(context.Background(), test.template, test.version)
+			if test.notFound {
+				if !errorIsTemplateNotFound(err) {
+					t.Fatalf("expected the template not to be found, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if template.Name != test.template {
+				t.Errorf("expected %s, got %s", test.template, template.Name)
+			}
+		})
+	}
+}
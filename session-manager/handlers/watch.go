@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"mr.telepresence/session-manager/api"
+	k8sClient "mr.telepresence/session-manager/k8s-client"
+	"mr.telepresence/session-manager/telemetry"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+const (
+	watchRetryInterval     = 2 * time.Second
+	watchHeartbeatInterval = 30 * time.Second
+)
+
+type clusterSessionEvent struct {
+	cluster string
+	session *sessionv1alpha1.Session // nil when the session was deleted from the cluster
+}
+
+// WatchSession streams the status of a session as server-sent events whenever it changes in any cluster
+func (h *Handler) WatchSession(ctx *gin.Context) {
+	sessionId := ctx.Param("sessionId")
+
+	streamSession(ctx, h.clusterClientMap(), sessionId, func(session *sessionv1alpha1.Session) (interface{}, bool) {
+		return session.Status, true
+	})
+}
+
+// WatchClient streams the spec and status of a single client as server-sent events whenever they change
+func (h *Handler) WatchClient(ctx *gin.Context) {
+	sessionId := ctx.Param("sessionId")
+	clientId := ctx.Param("clientId")
+
+	streamSession(ctx, h.clusterClientMap(), sessionId, func(session *sessionv1alpha1.Session) (interface{}, bool) {
+		connected, ok := session.Spec.Clients[clientId]
+		if !ok {
+			return nil, false
+		}
+
+		return api.ClientResponse{
+			Admission: api.ClientAdmitted,
+			Spec:      api.ClientSpec{Connected: connected},
+			Status:    session.Status.Clients[clientId],
+		}, true
+	})
+}
+
+// streamSession sends a "status" event each time the view built by render changes, and a "deleted" event
+// once the session (or the rendered part of it) no longer exists in any cluster
+func streamSession(
+	ctx *gin.Context,
+	clusterClientMap map[string]*k8sClient.SessionClient,
+	sessionId string,
+	render func(session *sessionv1alpha1.Session) (interface{}, bool),
+) {
+	sessionCopies := make(map[string]*sessionv1alpha1.Session, len(clusterClientMap))
+	for cluster, clusterClient := range clusterClientMap {
+		session, err := clusterClient.Sessions("default").Get(ctx.Request.Context(), sessionId, metav1.GetOptions{})
+		if err != nil && errors.IsNotFound(err) {
+			continue
+
+		} else if err != nil {
+			ctx.JSON(http.StatusBadGateway, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+		sessionCopies[cluster] = session
+	}
+
+	if _, found := renderSessionCopies(sessionId, sessionCopies, render); !found {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "session not found"})
+		return
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx.Request.Context())
+	defer cancel()
+
+	events := make(chan clusterSessionEvent)
+	for cluster, clusterClient := range clusterClientMap {
+		go watchClusterSession(watchCtx, cluster, clusterClient, sessionId, events)
+	}
+
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(watchHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	var lastSent []byte
+
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case <-watchCtx.Done():
+			return false
+
+		case <-heartbeat.C:
+			ctx.SSEvent("heartbeat", time.Now().UTC().Format(time.RFC3339))
+			return true
+
+		case event := <-events:
+			if event.session == nil {
+				delete(sessionCopies, event.cluster)
+			} else {
+				sessionCopies[event.cluster] = event.session
+			}
+
+			view, found := renderSessionCopies(sessionId, sessionCopies, render)
+			if !found {
+				ctx.SSEvent("deleted", nil)
+				return false
+			}
+
+			data, err := json.Marshal(view)
+			if err != nil {
+				ctx.SSEvent("error", api.ErrorResponse{Error: err.Error()})
+				return false
+			}
+
+			if string(data) != string(lastSent) {
+				lastSent = data
+				ctx.SSEvent("status", json.RawMessage(data))
+			}
+			return true
+		}
+	})
+}
+
+func renderSessionCopies(
+	sessionId string,
+	sessionCopies map[string]*sessionv1alpha1.Session,
+	render func(session *sessionv1alpha1.Session) (interface{}, bool),
+) (interface{}, bool) {
+
+	if len(sessionCopies) == 0 {
+		return nil, false
+	}
+
+	return render(mergeSessions(sessionId, sessionCopies))
+}
+
+// watchClusterSession forwards the changes of a session in one cluster, re-establishing the watch when
+// the API server closes it
+func watchClusterSession(
+	ctx context.Context,
+	cluster string,
+	clusterClient *k8sClient.SessionClient,
+	sessionId string,
+	events chan<- clusterSessionEvent,
+) {
+	opts := metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", sessionId).String()}
+
+	for {
+		w, err := clusterClient.Sessions("default").Watch(ctx, opts)
+		if err != nil {
+			telemetry.Logger(ctx).Warn("unable to watch session", "session", sessionId, "cluster", cluster, "error", err.Error())
+		} else {
+			forwardWatchEvents(ctx, cluster, w, events)
+			w.Stop()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+func forwardWatchEvents(
+	ctx context.Context,
+	cluster string,
+	w watch.Interface,
+	events chan<- clusterSessionEvent,
+) {
+	for event := range w.ResultChan() {
+		var clusterEvent clusterSessionEvent
+
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			session, ok := event.Object.(*sessionv1alpha1.Session)
+			if !ok {
+				continue
+			}
+			clusterEvent = clusterSessionEvent{cluster: cluster, session: session}
+
+		case watch.Deleted:
+			clusterEvent = clusterSessionEvent{cluster: cluster}
+
+		case watch.Error:
+			telemetry.Logger(ctx).Warn("watch error", "cluster", cluster, "object", event.Object)
+			return
+
+		default:
+			continue
+		}
+
+		select {
+		case events <- clusterEvent:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
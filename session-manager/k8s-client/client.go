@@ -31,3 +31,15 @@ func (c *SessionClient) Sessions(namespace string) SessionInterface {
 		namespace:  namespace,
 	}
 }
+
+func (c *SessionClient) FederatedSessions(namespace string) FederatedSessionInterface {
+	return &federatedSessionClient{
+		restClient: c.restClient,
+		namespace:  namespace,
+	}
+}
+
+// SessionTemplates are cluster scoped
+func (c *SessionClient) SessionTemplates() SessionTemplateInterface {
+	return &sessionTemplateClient{restClient: c.restClient}
+}
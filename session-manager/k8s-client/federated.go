@@ -0,0 +1,123 @@
+package k8sClient
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+type FederatedSessionInterface interface {
+	List(opts metav1.ListOptions, ctx context.Context) (*sessionv1alpha1.FederatedSessionList, error)
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*sessionv1alpha1.FederatedSession, error)
+	Create(federatedSession *sessionv1alpha1.FederatedSession, ctx context.Context) (*sessionv1alpha1.FederatedSession, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, patchData []byte, opts metav1.PatchOptions) (*sessionv1alpha1.FederatedSession, error)
+	Delete(name string, opts metav1.DeleteOptions, ctx context.Context) error
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+}
+
+type federatedSessionClient struct {
+	restClient rest.Interface
+	namespace  string
+}
+
+func (c *federatedSessionClient) List(
+	opts metav1.ListOptions,
+	ctx context.Context,
+) (*sessionv1alpha1.FederatedSessionList, error) {
+
+	result := sessionv1alpha1.FederatedSessionList{}
+	err := c.restClient.
+		Get().
+		Namespace(c.namespace).
+		Resource("federatedsessions").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do(ctx).
+		Into(&result)
+
+	return &result, err
+}
+
+func (c *federatedSessionClient) Get(
+	ctx context.Context,
+	name string,
+	opts metav1.GetOptions,
+) (*sessionv1alpha1.FederatedSession, error) {
+
+	result := sessionv1alpha1.FederatedSession{}
+	err := c.restClient.
+		Get().
+		Namespace(c.namespace).
+		Resource("federatedsessions").
+		Name(name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do(ctx).
+		Into(&result)
+
+	return &result, err
+}
+
+func (c *federatedSessionClient) Create(
+	federatedSession *sessionv1alpha1.FederatedSession,
+	ctx context.Context,
+) (*sessionv1alpha1.FederatedSession, error) {
+
+	result := sessionv1alpha1.FederatedSession{}
+	err := c.restClient.
+		Post().
+		Namespace(c.namespace).
+		Resource("federatedsessions").
+		Body(federatedSession).
+		Do(ctx).
+		Into(&result)
+
+	return &result, err
+}
+
+func (c *federatedSessionClient) Patch(
+	ctx context.Context,
+	name string,
+	pt types.PatchType,
+	patchData []byte,
+	opts metav1.PatchOptions,
+) (*sessionv1alpha1.FederatedSession, error) {
+
+	result := sessionv1alpha1.FederatedSession{}
+	err := c.restClient.
+		Patch(pt).
+		Namespace(c.namespace).
+		Resource("federatedsessions").
+		Name(name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(patchData).
+		Do(ctx).
+		Into(&result)
+
+	return &result, err
+}
+
+func (c *federatedSessionClient) Delete(name string, opts metav1.DeleteOptions, ctx context.Context) error {
+	result := sessionv1alpha1.FederatedSession{}
+	return c.restClient.
+		Delete().
+		Namespace(c.namespace).
+		Resource("federatedsessions").
+		Name(name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do(ctx).
+		Into(&result)
+}
+
+func (c *federatedSessionClient) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.restClient.
+		Get().
+		Namespace(c.namespace).
+		Resource("federatedsessions").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch(ctx)
+}
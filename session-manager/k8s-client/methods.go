@@ -2,10 +2,10 @@ package k8sClient
 
 import (
 	"context"
-	"encoding/json"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
@@ -15,8 +15,9 @@ type SessionInterface interface {
 	List(opts metav1.ListOptions, ctx context.Context) (*sessionv1alpha1.SessionList, error)
 	Get(ctx context.Context, name string, opts metav1.GetOptions) (*sessionv1alpha1.Session, error)
 	Create(session *sessionv1alpha1.Session, ctx context.Context) (*sessionv1alpha1.Session, error)
-	PatchClients(ctx context.Context, sessionName string, session *sessionv1alpha1.Session, patchData []byte, opts metav1.PatchOptions) (*sessionv1alpha1.Session, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, patchData []byte, opts metav1.PatchOptions) (*sessionv1alpha1.Session, error)
 	Delete(name string, opts metav1.DeleteOptions, ctx context.Context) error
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
 }
 
 type sessionClient struct {
@@ -64,33 +65,20 @@ func (c *sessionClient) Create(session *sessionv1alpha1.Session, ctx context.Con
 	return &result, err
 }
 
-func (c *sessionClient) PatchClients(
+func (c *sessionClient) Patch(
 	ctx context.Context,
-	sessionName string,
-	session *sessionv1alpha1.Session,
+	name string,
+	pt types.PatchType,
 	patchData []byte,
 	opts metav1.PatchOptions,
 ) (*sessionv1alpha1.Session, error) {
 
-	if patchData == nil {
-		var err error
-		patchData, err = json.Marshal(map[string]interface{}{
-			"spec": map[string]interface{}{
-				"clients": session.Spec.Clients,
-			},
-		})
-
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	result := sessionv1alpha1.Session{}
 	err := c.restClient.
-		Patch(types.MergePatchType).
+		Patch(pt).
 		Namespace(c.namespace).
 		Resource("sessions").
-		Name(sessionName).
+		Name(name).
 		VersionedParams(&opts, scheme.ParameterCodec).
 		Body(patchData).
 		Do(ctx).
@@ -110,3 +98,13 @@ func (c *sessionClient) Delete(name string, opts metav1.DeleteOptions, ctx conte
 		Do(ctx).
 		Into(&result)
 }
+
+func (c *sessionClient) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.restClient.
+		Get().
+		Namespace(c.namespace).
+		Resource("sessions").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch(ctx)
+}
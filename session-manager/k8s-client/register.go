@@ -12,7 +12,9 @@ var (
 )
 
 func addKnownTypes(scheme *runtime.Scheme) error {
-	scheme.AddKnownTypes(sessionv1alpha1.GroupVersion, &sessionv1alpha1.Session{}, &sessionv1alpha1.SessionList{})
+	scheme.AddKnownTypes(sessionv1alpha1.GroupVersion, &sessionv1alpha1.Session{}, &sessionv1alpha1.SessionList{},
+		&sessionv1alpha1.FederatedSession{}, &sessionv1alpha1.FederatedSessionList{},
+		&sessionv1alpha1.SessionTemplate{}, &sessionv1alpha1.SessionTemplateList{})
 
 	metav1.AddToGroupVersion(scheme, sessionv1alpha1.GroupVersion)
 	return nil
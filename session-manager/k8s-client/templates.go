@@ -0,0 +1,100 @@
+package k8sClient
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	sessionv1alpha1 "mr.telepresence/session/api/v1alpha1"
+)
+
+type SessionTemplateInterface interface {
+	List(opts metav1.ListOptions, ctx context.Context) (*sessionv1alpha1.SessionTemplateList, error)
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*sessionv1alpha1.SessionTemplate, error)
+	Create(template *sessionv1alpha1.SessionTemplate, ctx context.Context) (*sessionv1alpha1.SessionTemplate, error)
+	Update(template *sessionv1alpha1.SessionTemplate, ctx context.Context) (*sessionv1alpha1.SessionTemplate, error)
+	Delete(name string, opts metav1.DeleteOptions, ctx context.Context) error
+}
+
+type sessionTemplateClient struct {
+	restClient rest.Interface
+}
+
+func (c *sessionTemplateClient) List(
+	opts metav1.ListOptions,
+	ctx context.Context,
+) (*sessionv1alpha1.SessionTemplateList, error) {
+
+	result := sessionv1alpha1.SessionTemplateList{}
+	err := c.restClient.
+		Get().
+		Resource("sessiontemplates").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do(ctx).
+		Into(&result)
+
+	return &result, err
+}
+
+func (c *sessionTemplateClient) Get(
+	ctx context.Context,
+	name string,
+	opts metav1.GetOptions,
+) (*sessionv1alpha1.SessionTemplate, error) {
+
+	result := sessionv1alpha1.SessionTemplate{}
+	err := c.restClient.
+		Get().
+		Resource("sessiontemplates").
+		Name(name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do(ctx).
+		Into(&result)
+
+	return &result, err
+}
+
+func (c *sessionTemplateClient) Create(
+	template *sessionv1alpha1.SessionTemplate,
+	ctx context.Context,
+) (*sessionv1alpha1.SessionTemplate, error) {
+
+	result := sessionv1alpha1.SessionTemplate{}
+	err := c.restClient.
+		Post().
+		Resource("sessiontemplates").
+		Body(template).
+		Do(ctx).
+		Into(&result)
+
+	return &result, err
+}
+
+func (c *sessionTemplateClient) Update(
+	template *sessionv1alpha1.SessionTemplate,
+	ctx context.Context,
+) (*sessionv1alpha1.SessionTemplate, error) {
+
+	result := sessionv1alpha1.SessionTemplate{}
+	err := c.restClient.
+		Put().
+		Resource("sessiontemplates").
+		Name(template.Name).
+		Body(template).
+		Do(ctx).
+		Into(&result)
+
+	return &result, err
+}
+
+func (c *sessionTemplateClient) Delete(name string, opts metav1.DeleteOptions, ctx context.Context) error {
+	result := sessionv1alpha1.SessionTemplate{}
+	return c.restClient.
+		Delete().
+		Resource("sessiontemplates").
+		Name(name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do(ctx).
+		Into(&result)
+}
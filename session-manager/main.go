@@ -1,34 +1,91 @@
 package main
 
 import (
+	"context"
+	"os"
+
+	"mr.telepresence/session-manager/auth"
 	handlers "mr.telepresence/session-manager/handlers"
+	"mr.telepresence/session-manager/telemetry"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	router := gin.Default()
+	if err := telemetry.ConfigLogger(); err != nil {
+		panic(err.Error())
+	}
+
+	shutdownTracing, err := telemetry.ConfigTracing(context.Background())
+	if err != nil {
+		panic(err.Error())
+	}
+	defer shutdownTracing(context.Background())
+
+	// the debug mode of gin prints plain text next to the JSON logs
+	if os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	// scrapes are neither logged nor measured, the middleware only applies to the routes added after it
+	router.GET("/metrics", telemetry.MetricsHandler())
+	router.Use(telemetry.Requests())
 
 	handler, err := handlers.ConfigHandler()
 	if err != nil {
 		panic(err.Error())
 	}
 
-	v1 := router.Group("v1")
+	go handler.MonitorHeartbeats(context.Background())
+	go handler.ProbeClusters(context.Background())
+	go handler.WatchConfig(context.Background())
+	go handler.AdmitQueuedClients(context.Background())
+
+	authenticators, err := auth.ConfigAuthenticators()
+	if err != nil {
+		panic(err.Error())
+	}
+
+	router.GET("/v1/openapi.json", handlers.GetOpenAPISpec)
+	registerRoutes(router, handler, authenticators)
+
+	router.Run(":8080")
+}
+
+// registerRoutes adds the routes of the API documented in api/openapi.json
+func registerRoutes(router *gin.Engine, handler *handlers.Handler, authenticators []auth.Authenticator) {
+	backendOnly := auth.RequireRole(auth.BackendRole)
+	ownClientOnly := auth.RequireClientParam("clientId")
+
+	v1 := router.Group("v1", auth.Authenticate(authenticators))
 	{
-		v1.POST("/session", handler.CreateSession)
+		v1.POST("/session", backendOnly, handler.CreateSession)
 		v1.GET("/session", handler.GetSessions)
 		v1.GET("/session/:sessionId", handler.GetSession)
-		v1.DELETE("/session/:sessionId", handler.DeleteSession)
+		v1.DELETE("/session/:sessionId", backendOnly, handler.DeleteSession)
+		v1.GET("/session/:sessionId/watch", backendOnly, handler.WatchSession)
 
 		v1.POST("/session/:sessionId/client", handler.CreateClient)
-		v1.GET("/session/:sessionId/client", handler.GetClients)
-		v1.GET("/session/:sessionId/client/:clientId", handler.GetClient)
-		v1.PATCH("/session/:sessionId/client/:clientId", handler.UpdateClient)
-		v1.DELETE("session/:sessionId/client/:clientId", handler.DeleteClient)
+		v1.GET("/session/:sessionId/client", backendOnly, handler.GetClients)
+		v1.GET("/session/:sessionId/client/:clientId", ownClientOnly, handler.GetClient)
+		v1.PATCH("/session/:sessionId/client/:clientId", ownClientOnly, handler.UpdateClient)
+		v1.DELETE("session/:sessionId/client/:clientId", ownClientOnly, handler.DeleteClient)
+		v1.GET("/session/:sessionId/client/:clientId/watch", ownClientOnly, handler.WatchClient)
+		v1.POST("/session/:sessionId/client/:clientId/heartbeat", ownClientOnly, handler.Heartbeat)
+
+		v1.POST("/template", backendOnly, handler.CreateTemplate)
+		v1.GET("/template", handler.GetTemplates)
+		v1.GET("/template/:templateName", handler.GetTemplate)
+		v1.GET("/template/:templateName/outdated", handler.GetOutdatedSessions)
+		v1.POST("/template/:templateName/rollout", backendOnly, handler.RolloutTemplate)
+		v1.PUT("/template/:templateName", backendOnly, handler.UpdateTemplate)
+		v1.DELETE("/template/:templateName", backendOnly, handler.DeleteTemplate)
 
 		v1.GET("/ping", handler.GetPingServers)
+		v1.GET("/clusters", handler.GetClusters)
+		v1.POST("/config/reload", backendOnly, handler.ReloadConfig)
 	}
-
-	router.Run(":8080")
 }
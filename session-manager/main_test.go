@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"mr.telepresence/session-manager/api"
+	"mr.telepresence/session-manager/auth"
+	handlers "mr.telepresence/session-manager/handlers"
+)
+
+// pathParam matches the gin path parameters, written {name} in the OpenAPI paths
+var pathParam = regexp.MustCompile(`:([^/]+)`)
+
+// routeOperations returns the operations served under /v1, as "METHOD /path" in the notation of the OpenAPI paths
+func routeOperations() map[string]bool {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	registerRoutes(router, &handlers.Handler{}, nil)
+
+	operations := make(map[string]bool)
+	for _, route := range router.Routes() {
+		path := pathParam.ReplaceAllString(strings.TrimPrefix(route.Path, "/v1"), "{$1}")
+		operations[route.Method+" "+path] = true
+	}
+	return operations
+}
+
+// specOperations returns the operations of the OpenAPI spec, as "METHOD /path"
+func specOperations(t *testing.T) map[string]bool {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(api.OpenAPISpec, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	operations := make(map[string]bool)
+	for path, item := range spec.Paths {
+		for method := range item {
+			// the parameters shared by the operations of a path are not an operation
+			if method == "parameters" {
+				continue
+			}
+			operations[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	return operations
+}
+
+// missing returns the operations of want that are not in got, sorted
+func missing(want map[string]bool, got map[string]bool) []string {
+	var operations []string
+	for operation := range want {
+		if !got[operation] {
+			operations = append(operations, operation)
+		}
+	}
+
+	sort.Strings(operations)
+	return operations
+}
+
+// Every route has an operation in the OpenAPI spec, and every operation of the spec is served
+func TestRoutesMatchOpenAPISpec(t *testing.T) {
+	routes := routeOperations()
+	spec := specOperations(t)
+
+	if len(routes) == 0 {
+		t.Fatal("no route registered")
+	}
+	for _, operation := range missing(routes, spec) {
+		t.Errorf("%s is served but not documented in api/openapi.json", operation)
+	}
+	for _, operation := range missing(spec, routes) {
+		t.Errorf("%s is documented in api/openapi.json but not served", operation)
+	}
+}
+
+// clientAuthenticator authenticates every request as the client named by the Authorization header
+type clientAuthenticator struct{}
+
+func (clientAuthenticator) Authenticate(header string) (*auth.Principal, error) {
+	return &auth.Principal{Role: auth.ClientRole, ClientId: header}, nil
+}
+
+// Clients may not read the other clients of a session, whether by listing or by watching it
+func TestSessionWideRoutesForbiddenToClients(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	registerRoutes(router, &handlers.Handler{}, []auth.Authenticator{clientAuthenticator{}})
+
+	for _, path := range []string{"/v1/session/demo/watch", "/v1/session/demo/client"} {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set("Authorization", "headset-1")
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusForbidden {
+			t.Errorf("GET %s: expected 403 for a client, got %d", path, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const logLevelEnv = "LOG_LEVEL"
+
+// ConfigLogger makes the default logger write JSON lines to stdout, at the level in LOG_LEVEL (debug, info, warn or
+// error, info when unset). The standard log package goes through it as well.
+func ConfigLogger() error {
+	var level slog.Level
+
+	if value := os.Getenv(logLevelEnv); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return err
+		}
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})))
+	return nil
+}
+
+// Logger returns the default logger, carrying the request id when the context belongs to a request and the trace id
+// when it holds a recorded span
+func Logger(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+
+	if id := RequestID(ctx); id != "" {
+		logger = logger.With("requestId", id)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsSampled() {
+		logger = logger.With("traceId", spanContext.TraceID().String())
+	}
+
+	return logger
+}
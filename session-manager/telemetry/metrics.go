@@ -0,0 +1,30 @@
+package telemetry
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "session_manager",
+		Name:      "http_request_duration_seconds",
+		Help: "Latency of the API requests, by method, route, status and the cluster serving them for the requests " +
+			"bound to a single one.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status", "cluster"})
+
+	kubernetesErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "session_manager",
+		Name:      "kubernetes_api_errors_total",
+		Help: "Kubernetes API calls that failed, by cluster and status code, the code being \"error\" when no " +
+			"response was received.",
+	}, []string{"cluster", "code"})
+)
+
+// MetricsHandler serves the metrics in the Prometheus text format
+func MetricsHandler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
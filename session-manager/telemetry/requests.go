@@ -0,0 +1,117 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Every request gets an id, the one sent in X-Request-ID when it is valid. It is returned in the response, logged
+// with everything done for the request and sent along with the Kubernetes API calls made for it. Every request is
+// traced as well, its span being the parent of the spans of the Kubernetes API calls.
+
+const RequestIDHeader = "X-Request-ID"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestInfoKey struct{}
+
+// requestInfo is shared through the request context by the middleware and the handlers
+type requestInfo struct {
+	id string
+
+	mu      sync.Mutex
+	cluster string
+}
+
+// RequestID returns the id of the request the context belongs to, empty for any other context
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.id
+	}
+
+	return ""
+}
+
+// SetCluster records the cluster a request was served by, for the requests bound to a single cluster
+func SetCluster(ctx context.Context, cluster string) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.mu.Lock()
+		info.cluster = cluster
+		info.mu.Unlock()
+	}
+}
+
+func (i *requestInfo) getCluster() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.cluster
+}
+
+// Requests assigns every request its id and span, then records its latency and status and logs it once it was
+// served
+func Requests() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		id := ctx.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.New().String()
+		}
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		// the span continues the trace of the caller when it sent a traceparent header
+		reqCtx := otel.GetTextMapPropagator().Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+		reqCtx, span := StartSpan(reqCtx, ctx.Request.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(ctx.Request.Method),
+				semconv.HTTPRoute(route),
+				attribute.String("request.id", id),
+			))
+		defer span.End()
+
+		info := &requestInfo{id: id}
+		ctx.Request = ctx.Request.WithContext(context.WithValue(reqCtx, requestInfoKey{}, info))
+		ctx.Header(RequestIDHeader, id)
+
+		ctx.Next()
+
+		latency := time.Since(start)
+		status := ctx.Writer.Status()
+		cluster := info.getCluster()
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status), attribute.String("cluster", cluster))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+
+		requestDuration.WithLabelValues(ctx.Request.Method, route, strconv.Itoa(status), cluster).
+			Observe(latency.Seconds())
+
+		Logger(ctx.Request.Context()).Info("request",
+			"method", ctx.Request.Method,
+			"path", ctx.Request.URL.Path,
+			"route", route,
+			"status", status,
+			"latencyMs", latency.Milliseconds(),
+			"cluster", cluster,
+			"clientIp", ctx.ClientIP())
+	}
+}
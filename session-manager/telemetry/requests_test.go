@@ -0,0 +1,88 @@
+package telemetry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/client-go/rest"
+)
+
+// TestRequestIDPropagation checks that the id of a request reaches the Kubernetes API calls made for it, and that the
+// calls that fail are counted against their cluster
+func TestRequestIDPropagation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var forwarded string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(RequestIDHeader)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer apiServer.Close()
+
+	cfg := &rest.Config{Host: apiServer.URL}
+	InstrumentConfig(cfg, "edge")
+
+	httpClient, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(Requests())
+	router.GET("/session/:sessionId", func(ctx *gin.Context) {
+		SetCluster(ctx.Request.Context(), "edge")
+
+		req, err := http.NewRequestWithContext(ctx.Request.Context(), http.MethodGet, apiServer.URL+"/api", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		ctx.Status(http.StatusNoContent)
+	})
+
+	errorsBefore := testutil.ToFloat64(kubernetesErrors.WithLabelValues("edge", "404"))
+
+	for _, test := range []struct {
+		name   string
+		sent   string
+		reused bool
+	}{
+		{name: "valid id", sent: "join-42", reused: true},
+		{name: "missing id"},
+		{name: "invalid id", sent: "bad id\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/session/abc", nil)
+			if test.sent != "" {
+				req.Header.Set(RequestIDHeader, test.sent)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if id == "" || (id == test.sent) != test.reused {
+				t.Fatalf("unexpected request id %q for %q", id, test.sent)
+			}
+			if forwarded != id {
+				t.Fatalf("expected the request id %q in the API call, got %q", id, forwarded)
+			}
+		})
+	}
+
+	if errors := testutil.ToFloat64(kubernetesErrors.WithLabelValues("edge", "404")) - errorsBefore; errors != 3 {
+		t.Fatalf("expected 3 API errors in cluster edge, got %v", errors)
+	}
+	if count := testutil.CollectAndCount(requestDuration, "session_manager_http_request_duration_seconds"); count == 0 {
+		t.Fatal("expected the requests to be measured")
+	}
+}
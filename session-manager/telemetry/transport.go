@@ -0,0 +1,53 @@
+package telemetry
+
+import (
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/client-go/rest"
+)
+
+// InstrumentConfig makes the clients built from the config count the failed calls to the API server of the
+// cluster, send the id of the request they are made for, and trace every call
+func InstrumentConfig(cfg *rest.Config, cluster string) {
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		traced := otelhttp.NewTransport(rt,
+			otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+				return "kubernetes " + req.Method + " " + cluster
+			}),
+			otelhttp.WithSpanOptions(trace.WithAttributes(attribute.String("cluster", cluster))),
+		)
+
+		return &clusterTransport{cluster: cluster, next: traced}
+	})
+}
+
+type clusterTransport struct {
+	cluster string
+	next    http.RoundTripper
+}
+
+func (t *clusterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := RequestID(req.Context()); id != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(RequestIDHeader, id)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+
+	if err != nil {
+		kubernetesErrors.WithLabelValues(t.cluster, "error").Inc()
+		Logger(req.Context()).Warn("kubernetes api call failed",
+			"cluster", t.cluster, "method", req.Method, "path", req.URL.Path, "error", err.Error())
+
+	} else if resp.StatusCode >= http.StatusBadRequest {
+		kubernetesErrors.WithLabelValues(t.cluster, strconv.Itoa(resp.StatusCode)).Inc()
+		Logger(req.Context()).Debug("kubernetes api call rejected",
+			"cluster", t.cluster, "method", req.Method, "path", req.URL.Path, "status", resp.StatusCode)
+	}
+
+	return resp, err
+}